@@ -1,6 +1,69 @@
 package appInfo
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildDate may be set at build time with -ldflags -X. Otherwise, the
+// commit is taken from the version control information Go records, if any.
 var (
-	Name    = "go-baton"
-	Version = "0.0.0"
+	Name      = "go-baton"
+	Version   = "0.0.0"
+	Commit    = ""
+	BuildDate = ""
 )
+
+// irodsClientModule is the module of the iRODS client library, whose version is
+// reported along with that of the application.
+const irodsClientModule = "github.com/cyverse/go-irodsclient"
+
+// Build describes the build of the running binary.
+type Build struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	CommitTime  string `json:"commit_time,omitempty"`
+	Modified    bool   `json:"modified,omitempty"` // Built with uncommitted changes
+	BuildDate   string `json:"build_date,omitempty"`
+	GoVersion   string `json:"go_version"`
+	IRODSClient string `json:"go_irodsclient_version,omitempty"`
+}
+
+// CurrentBuild returns a description of the build of the running binary.
+func CurrentBuild() Build {
+	build := Build{
+		Name:      Name,
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == irodsClientModule {
+			build.IRODSClient = dep.Version
+			if dep.Replace != nil {
+				build.IRODSClient = dep.Replace.Version
+			}
+		}
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if build.Commit == "" {
+				build.Commit = setting.Value
+			}
+		case "vcs.time":
+			build.CommitTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+
+	return build
+}
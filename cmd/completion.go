@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/wtsi-npg/go-baton/irods"
+)
+
+// completionCommand returns a command that writes a completion script for a
+// shell to stdout.
+func completionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate a shell completion script",
+		Long: `Generate a completion script for go-baton for the named shell.
+
+To load completions in the current bash session:
+  source <(go-baton completion bash)
+and similarly for the other shells. Completions include the choices of flags,
+such as metamod's --operation, that take one of a fixed set of values.`,
+		Annotations: map[string]string{
+			noSetupAnnotation: "",
+		},
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, out := cmd.Root(), cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return fmt.Errorf("unsupported shell '%s': %w", args[0], irods.ErrInvalidArgument)
+			}
+		},
+	}
+}
+
+// isCompletionRequest returns true if cmd is the hidden command through which
+// a completion script asks for the completions of a command line.
+func isCompletionRequest(cmd *cobra.Command) bool {
+	return cmd.Name() == cobra.ShellCompRequestCmd ||
+		cmd.Name() == cobra.ShellCompNoDescRequestCmd
+}
+
+// registerChoiceCompletions makes the choices of every flag of cmd and its
+// subcommands that takes one of a fixed set of values its completions.
+func registerChoiceCompletions(cmd *cobra.Command) error {
+	var err error
+	cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+		choice, ok := flag.Value.(*choiceValue)
+		if !ok || err != nil {
+			return
+		}
+		err = cmd.RegisterFlagCompletionFunc(flag.Name,
+			cobra.FixedCompletions(choice.choices, cobra.ShellCompDirectiveNoFileComp))
+	})
+	if err != nil {
+		return err
+	}
+	for _, sub := range cmd.Commands() {
+		if err = registerChoiceCompletions(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
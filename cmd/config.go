@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/wtsi-npg/go-baton/irods"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the path, under the user's configuration directory, of the
+// config file read when --config is not given.
+var configFile = filepath.Join("go-baton", "config.yaml")
+
+// defaultConfigFile returns the path of the config file read when --config is
+// not given, or "" if the user has no configuration directory.
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configFile)
+}
+
+// applyConfigFile sets the flags of cmd from a YAML config file mapping flag
+// names to values, e.g. "max-connections: 8". Flags given on the command line
+// take precedence over the file, which takes precedence over the flag defaults.
+// A key that names no flag of any command is an error, so that a misspelling is
+// not silently ignored, while one naming a flag of another command is skipped.
+// If required is false, a file that does not exist is not an error.
+func applyConfigFile(logger zerolog.Logger, cmd *cobra.Command, file string,
+	required bool) (err error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	var config map[string]interface{}
+	if err = yaml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	known := make(map[string]bool)
+	var addFlags func(c *cobra.Command)
+	addFlags = func(c *cobra.Command) {
+		c.LocalFlags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		for _, sub := range c.Commands() {
+			addFlags(sub)
+		}
+	}
+	addFlags(cmd.Root())
+	delete(known, "config")
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("config file %s: unknown flag '%s': %w",
+				file, name, irods.ErrInvalidArgument)
+		}
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			logger.Debug().Msgf("Config file flag '%s' does not apply to %s",
+				name, cmd.CommandPath())
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if err = setConfigFlag(flag, config[name]); err != nil {
+			return fmt.Errorf("config file %s: flag '%s': %w", file, name, err)
+		}
+		logger.Debug().Msgf("Set flag '%s' to '%s' from config file %s",
+			name, flag.Value, file)
+	}
+
+	return nil
+}
+
+// setConfigFlag sets a flag to a value decoded from a config file, which may be
+// a list for a flag that may be repeated.
+func setConfigFlag(flag *pflag.Flag, value interface{}) (err error) {
+	switch v := value.(type) {
+	case []interface{}:
+		sv, ok := flag.Value.(pflag.SliceValue)
+		if !ok {
+			return fmt.Errorf("takes a single value, not a list: %w", irods.ErrInvalidArgument)
+		}
+		values := make([]string, 0, len(v))
+		for _, elt := range v {
+			if _, ok := elt.(map[string]interface{}); ok {
+				return fmt.Errorf("invalid list element %v: %w", elt, irods.ErrInvalidArgument)
+			}
+			values = append(values, fmt.Sprint(elt))
+		}
+		if err = sv.Replace(values); err != nil {
+			return err
+		}
+	case map[string]interface{}, nil:
+		return fmt.Errorf("invalid value %v: %w", value, irods.ErrInvalidArgument)
+	default:
+		if err = flag.Value.Set(fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+	// Counts as given, so that a required flag may be supplied by the file
+	flag.Changed = true
+
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// choiceValue is a string flag value restricted to a fixed set of choices. An
+// invalid value is rejected when the flag is parsed, before any input is read.
+type choiceValue struct {
+	value   *string
+	choices []string
+}
+
+func newChoiceValue(value *string, choices ...string) *choiceValue {
+	return &choiceValue{value: value, choices: choices}
+}
+
+func (c *choiceValue) String() string {
+	if c.value == nil {
+		return ""
+	}
+	return *c.value
+}
+
+func (c *choiceValue) Set(s string) error {
+	if !slices.Contains(c.choices, s) {
+		return fmt.Errorf("invalid value '%s', must be one of [%s]", s,
+			strings.Join(c.choices, ", "))
+	}
+	*c.value = s
+	return nil
+}
+
+func (c *choiceValue) Type() string {
+	return "string"
+}
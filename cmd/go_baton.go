@@ -19,11 +19,15 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/cyverse/go-irodsclient/icommands"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/pkgerrors"
@@ -36,37 +40,171 @@ import (
 
 type contextKey string
 
+const (
+	jsonKey    = contextKey("json key")
+	accountKey = contextKey("account key")
+	managerKey = contextKey("manager key")
+	sourceKey  = contextKey("source key")
+)
+
+// Command annotations used to skip parts of the common setup in the root
+// command's PersistentPreRunE.
+const (
+	// noInputAnnotation marks a command that does not read JSON from stdin
+	noInputAnnotation = "no-input"
+	// noVerifyAnnotation marks a command that does not verify the iRODS account
+	noVerifyAnnotation = "no-verify"
+	// noSetupAnnotation marks a command that needs none of the setup
+	noSetupAnnotation = "no-setup"
+)
+
+// Exit statuses. Failures that monitoring may need to tell apart from others
+// have their own.
+const (
+	exitFailure          = 1
+	exitReplicaMismatch  = 3
+	exitNotFound         = 4
+	exitPermissionDenied = 5
+)
+
+// exitCode returns the exit status for an error returned by a command. A
+// refused ticket is a kind of permission denied.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, irods.ErrReplicaMismatch):
+		return exitReplicaMismatch
+	case errors.Is(err, irods.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, irods.ErrPermissionDenied):
+		return exitPermissionDenied
+	default:
+		return exitFailure
+	}
+}
+
 var mainLogger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr})
 
 type cliFlags struct {
-	checksum  bool
-	coll      bool
-	level     string
-	obj       bool
-	operation string
-	recurse   bool
-	zone      string
+	all                 bool
+	allZones            bool
+	caCert              string
+	checksum            bool
+	checksumRetry       int
+	checksumWorkers     int
+	coll                bool
+	config              string
+	connectionWait      time.Duration
+	contents            bool
+	copies              int
+	count               bool
+	dedupe              bool
+	defaultUnits        string
+	destination         string
+	dryRun              bool
+	emptyTrash          bool
+	encryptionAlgorithm string
+	exclude             []string
+	failFast            bool
+	followRedirect      bool
+	force               bool
+	followSymlinks      bool
+	forceRecompute      bool
+	ignoreCase          bool
+	include             []string
+	includeChecksum     bool
+	input               []string
+	jsonOutput          bool
+	keepGoing           bool
+	level               string
+	maxConnections      int
+	maxConnectionsHost  int
+	maxDepth            int
+	maxInlineSize       int
+	maxObjectSize       int
+	metadataFile        string
+	minReplicas         int
+	noChecksum          bool
+	noTrash             bool
+	noVerifyAccount     bool
+	normaliseMetadata   bool
+	obj                 bool
+	onConflict          string
+	operation           string
+	operationTimeout    time.Duration
+	output              string
+	outputFormat        string
+	outputMode          string
+	overwrite           bool
+	passwordFD          int
+	passwordFile        string
+	postHook            string
+	postHookStrict      bool
+	preserve            bool
+	preserveACLs        bool
+	pruneEmpty          bool
+	putChecksum         bool
+	quiet               bool
+	queryPageSize       int
+	recurse             bool
+	redirectFallback    bool
+	replica             int
+	requireChecksum     bool
+	resource            string
+	resourcePool        []string
+	size                bool
+	skipUnchanged       bool
+	sort                string
+	sslNegotiation      string
+	strict              bool
+	summary             bool
+	ticket              string
+	totalSize           bool
+	updateCatalog       bool
+	verify              bool
+	verifyPath          string
+	zone                string
 }
 
 var flags cliFlags
 
-func configureRootLogger(flags *cliFlags) zerolog.Logger {
-	var level zerolog.Level
-
-	switch strings.ToLower(flags.level) {
+// logLevel returns the log level named by a --log-level value, which is info
+// for a name that is not recognised.
+func logLevel(name string) zerolog.Level {
+	switch strings.ToLower(name) {
 	case "trace":
-		level = zerolog.TraceLevel
+		return zerolog.TraceLevel
 	case "debug":
-		level = zerolog.DebugLevel
+		return zerolog.DebugLevel
 	case "info":
-		level = zerolog.InfoLevel
+		return zerolog.InfoLevel
 	case "warn":
-		level = zerolog.WarnLevel
+		return zerolog.WarnLevel
 	case "error":
-		level = zerolog.ErrorLevel
+		return zerolog.ErrorLevel
 	default:
-		level = zerolog.InfoLevel
+		return zerolog.InfoLevel
 	}
+}
+
+// setLogLevel sets the level of all logging from the flags, once they have been
+// parsed. --quiet raises it to error, whatever --log-level says, with a warning
+// if that asked for more logging.
+func setLogLevel(logger zerolog.Logger, cmd *cobra.Command) {
+	level := logLevel(flags.level)
+	if flags.quiet {
+		if cmd.Flags().Changed("log-level") && level < zerolog.ErrorLevel {
+			logger.Warn().Msgf("--quiet overrides --log-level %s; logging only errors",
+				flags.level)
+		}
+		level = zerolog.ErrorLevel
+	}
+	zerolog.SetGlobalLevel(level)
+}
+
+func configureRootLogger(flags *cliFlags) zerolog.Logger {
+	// The flags have yet to be parsed, so the level set here is only the
+	// default, until setLogLevel applies them
+	zerolog.SetGlobalLevel(logLevel(flags.level))
 
 	var writer io.Writer
 	if term.IsTerminal(int(os.Stdout.Fd())) {
@@ -82,7 +220,7 @@ func configureRootLogger(flags *cliFlags) zerolog.Logger {
 		Str("app", appInfo.Name).
 		Str("version", appInfo.Version).
 		Int("pid", os.Getpid()).
-		Logger().Level(level)
+		Logger()
 }
 
 func printHelp(cmd *cobra.Command, args []string) {
@@ -92,10 +230,47 @@ func printHelp(cmd *cobra.Command, args []string) {
 	}
 }
 
+// forEachInput calls fn for each JSON object read from stdin or the input files,
+// in order. With --fail-fast, it stops at the first error and returns it.
+// Otherwise, it carries on with the remaining inputs, logs a summary of those
+// that failed at the end and returns an error wrapping the first failure, so
+// that the exit status is that of a failed run.
+func forEachInput(logger zerolog.Logger, cmd *cobra.Command,
+	fn func(account *types.IRODSAccount, jsonContents map[string]interface{}) error) error {
+	account := cmd.Context().Value(accountKey).(*types.IRODSAccount)
+	sources, _ := cmd.Context().Value(sourceKey).([]inputSource)
+	inputs := cmd.Context().Value(jsonKey).([]map[string]interface{})
+
+	var failed []string
+	var firstErr error
+	for i, jsonContents := range inputs {
+		input := fmt.Sprintf("input %d", i+1)
+		if i < len(sources) {
+			input = fmt.Sprintf("input %d of %s", sources[i].index, sources[i].file)
+			logger.Debug().Msgf("Processing %s", input)
+		}
+		if err := fn(account, jsonContents); err != nil {
+			if flags.failFast {
+				return err
+			}
+			logger.Err(err).Msgf("Failed to process %s; continuing", input)
+			failed = append(failed, input)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		logger.Error().Strs("failed", failed).
+			Msgf("%d of %d inputs failed", len(failed), len(inputs))
+		return fmt.Errorf("%d of %d inputs failed, the first with: %w",
+			len(failed), len(inputs), firstErr)
+	}
+	return nil
+}
+
 func CLI() {
 	logger := configureRootLogger(&flags)
-	jsonKey := contextKey("json key")
-	accountKey := contextKey("account key")
 	rootCmd := &cobra.Command{
 		Use:     "go-baton",
 		Short:   "A go equivalent of baton for testing the go iRODS clients.",
@@ -107,19 +282,125 @@ func CLI() {
 				printHelp(cmd, args)
 				os.Exit(0)
 			}
-			inputContents := parsing.ParseStdin(logger, args)
+			if _, ok := cmd.Annotations[noSetupAnnotation]; ok || isCompletionRequest(cmd) {
+				return nil
+			}
+			configFile, required := flags.config, cmd.Flags().Changed("config")
+			if !required {
+				configFile = defaultConfigFile()
+			}
+			if configFile != "" {
+				if err = applyConfigFile(logger, cmd, configFile, required); err != nil {
+					return err
+				}
+			}
+			setLogLevel(logger, cmd)
+			// Cobra checks these only after this function, so check them here
+			// to report a missing flag before waiting for stdin
+			if err = cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+			if err = cmd.ValidateFlagGroups(); err != nil {
+				return err
+			}
+			if err = irods.SetQueryPageSize(flags.queryPageSize); err != nil {
+				return err
+			}
+			if err = irods.SetMaxConnections(flags.maxConnections); err != nil {
+				return err
+			}
+			if err = irods.SetMaxConnectionsPerHost(flags.maxConnectionsHost); err != nil {
+				return err
+			}
+			if err = irods.SetOperationTimeout(flags.operationTimeout); err != nil {
+				return err
+			}
+			if err = irods.SetConnectionWait(flags.connectionWait); err != nil {
+				return err
+			}
+			parsing.SetNormaliseMetadata(flags.normaliseMetadata)
+			results.format = flags.outputFormat
+			if err = results.setOutputFile(flags.output, flags.outputMode); err != nil {
+				return err
+			}
+			var inputContents []map[string]interface{}
+			var sources []inputSource
+			_, noInput := cmd.Annotations[noInputAnnotation]
+			if len(flags.input) > 0 && (noInput || flags.metadataFile != "") {
+				return fmt.Errorf("%s does not read JSON input from --input files: %w",
+					cmd.CommandPath(), irods.ErrInvalidArgument)
+			}
+			if len(flags.input) > 0 {
+				if inputContents, sources, err = readInputFiles(logger, flags.input); err != nil {
+					return err
+				}
+				noInput = true
+			} else if flags.metadataFile != "" {
+				if inputContents, err = readMetadataFile(logger, flags.metadataFile, flags.operation); err != nil {
+					return err
+				}
+				noInput = true
+			} else if !noInput {
+				// Reading a terminal would wait, without any prompt, for input
+				// that the user most likely meant to pipe in
+				if term.IsTerminal(int(os.Stdin.Fd())) {
+					return fmt.Errorf("%s reads JSON input from stdin, which is a terminal; "+
+						"pipe the input in, e.g. echo '{\"collection\": \"/zone/home\"}' | %s, "+
+						"or give it with --input: %w",
+						cmd.CommandPath(), cmd.CommandPath(), irods.ErrMissingArgument)
+				}
+				inputContents = parsing.ParseStdin(logger, args)
+			}
+			if flags.dedupe && len(inputContents) > 0 {
+				var skipped int
+				if inputContents, sources, skipped, err = dedupeInputs(logger,
+					inputContents, sources); err != nil {
+					return err
+				}
+				logger.Info().Msgf("Skipped %d duplicate inputs", skipped)
+			}
+			// A password supplied out-of-band takes precedence over any other
+			getPassword := passwordPrompt(noInput)
+			password, err := readPassword(logger, flags.passwordFile, flags.passwordFD, noInput)
+			if err != nil {
+				return err
+			}
+			if password != "" {
+				getPassword = func() (string, error) { return password, nil }
+			}
 			envFile := irods.IRODSEnvFilePath()
-			manager, err := irods.NewICommandsEnvironmentManager(logger, envFile)
+			manager, err := irods.NewICommandsEnvironmentManager(logger, envFile, getPassword)
 			if err != nil {
 				return err
 			}
+			if password != "" && manager.Environment.Username != irods.IRODSPublicUser {
+				manager.Password = password
+			}
+			if err = irods.ApplySSLOverrides(logger, manager, irods.SSLOverrides{
+				CACertificateFile:   flags.caCert,
+				CSNegotiationPolicy: flags.sslNegotiation,
+				EncryptionAlgorithm: flags.encryptionAlgorithm,
+			}); err != nil {
+				return err
+			}
 			account, err := irods.NewIRODSAccount(logger, manager)
 			if err != nil {
 				return err
 			}
+			if _, ok := cmd.Annotations[noVerifyAnnotation]; ok || flags.noVerifyAccount {
+				logger.Debug().Msg("Skipping iRODS account verification")
+			} else if err = irods.VerifyIRODSAccount(logger, account, flags.verifyPath); err != nil {
+				return err
+			}
+
+			if flags.summary {
+				summary.startSummary()
+			}
 
 			inputctx := context.WithValue(cmd.Context(), jsonKey, inputContents)
-			fullctx := context.WithValue(inputctx, accountKey, account)
+			inputctx = context.WithValue(inputctx, sourceKey, sources)
+			accountctx := context.WithValue(inputctx, accountKey, account)
+			fullctx := context.WithValue(accountctx, managerKey, manager)
 			cmd.SetContext(fullctx)
 			return nil
 		},
@@ -127,62 +408,506 @@ func CLI() {
 	rootCmd.PersistentFlags().StringVar(&flags.level,
 		"log-level", "info",
 		"Set the log level (trace, debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&flags.config,
+		"config", "",
+		"Read default flag values from this YAML file, mapping flag names to values. "+
+			"Defaults to go-baton/config.yaml in the user configuration directory, if it exists")
+	rootCmd.PersistentFlags().BoolVar(&flags.dedupe,
+		"dedupe", false,
+		"Skip any input identical to an earlier one, ignoring the order of keys, before processing any")
+	rootCmd.PersistentFlags().BoolVar(&flags.failFast,
+		"fail-fast", false,
+		"Stop at the first input that fails, exiting with its status")
+	rootCmd.PersistentFlags().BoolVar(&flags.keepGoing,
+		"keep-going", false,
+		"Process every input, even after one fails, then exit with the status of the first failure, "+
+			"if any. This is the default")
+	rootCmd.MarkFlagsMutuallyExclusive("fail-fast", "keep-going")
+	rootCmd.PersistentFlags().BoolVar(&flags.summary,
+		"summary", false,
+		"Write a JSON summary of the run to stderr once it completes: the number of results, "+
+			"those that succeeded and failed, the bytes transferred and the duration, overall and by operation")
+	rootCmd.PersistentFlags().BoolVar(&flags.quiet,
+		"quiet", false,
+		"Log only errors, overriding --log-level, while still writing the results")
+	rootCmd.PersistentFlags().StringVar(&flags.caCert,
+		"ca-cert", "",
+		"CA certificate file to use for TLS, overriding the iRODS environment")
+	rootCmd.PersistentFlags().StringVar(&flags.sslNegotiation,
+		"ssl-negotiation", "",
+		"SSL negotiation policy (CS_NEG_REQUIRE, CS_NEG_REFUSE, CS_NEG_DONT_CARE), overriding the iRODS environment")
+	rootCmd.PersistentFlags().StringVar(&flags.encryptionAlgorithm,
+		"encryption-algorithm", "",
+		"Encryption algorithm to use for TLS e.g. AES-256-CBC, overriding the iRODS environment")
+	rootCmd.PersistentFlags().StringVar(&flags.passwordFile,
+		"password-file", "",
+		"Read the iRODS password from this file, leaving stdin for JSON input")
+	rootCmd.PersistentFlags().IntVar(&flags.passwordFD,
+		"password-fd", -1,
+		"Read the iRODS password from this open file descriptor, leaving stdin for JSON input")
+	rootCmd.MarkFlagsMutuallyExclusive("password-file", "password-fd")
+	flags.outputFormat = outputNDJSON
+	rootCmd.PersistentFlags().Var(newChoiceValue(&flags.outputFormat, outputNDJSON, outputArray),
+		"output-format", "Format of the results. One of [ndjson, array]; ndjson writes each on its own line "+
+			"as it completes, array writes them all as a single JSON array")
+	rootCmd.PersistentFlags().StringVar(&flags.output,
+		"output", "",
+		"Write the results to this file rather than stdout, leaving logs apart from them")
+	flags.outputMode = outputTruncate
+	rootCmd.PersistentFlags().Var(newChoiceValue(&flags.outputMode, outputTruncate, outputAppend),
+		"output-mode", "How to write the --output file. One of [truncate, append]; truncate replaces it "+
+			"once all the results are written, append adds each result to it as it completes")
+	rootCmd.PersistentFlags().StringArrayVar(&flags.input,
+		"input", nil,
+		"Read the JSON input from this file rather than stdin. May be repeated to read several files in turn")
+	rootCmd.PersistentFlags().IntVar(&flags.maxConnections,
+		"max-concurrent-connections", 0,
+		fmt.Sprintf("Most iRODS connections to have open at once, waiting for one to close "+
+			"rather than exceeding it; at least %d, or 0 for no limit", irods.MinConnections))
+	rootCmd.PersistentFlags().IntVar(&flags.maxConnectionsHost,
+		"concurrency-per-host", 0,
+		fmt.Sprintf("Most iRODS connections to have open at once to each host, waiting for one to close "+
+			"rather than exceeding it; at least %d, or 0 for no limit", irods.MinConnections))
+	rootCmd.PersistentFlags().DurationVar(&flags.connectionWait,
+		"connection-wait", irods.DefaultConnectionWait,
+		"Longest to wait for an iRODS connection to become free when all are in use, "+
+			"before failing; 0 to fail at once")
+	rootCmd.PersistentFlags().BoolVar(&flags.normaliseMetadata,
+		"normalise-metadata", false,
+		"Normalise the attribute, value and units of each AVU given to Unicode NFC before using them")
+	rootCmd.PersistentFlags().DurationVar(&flags.operationTimeout,
+		"operation-timeout", 0,
+		"Abort an operation, e.g. a transfer, that runs for longer than this, e.g. 30m; 0 for no limit")
+	rootCmd.PersistentFlags().StringVar(&flags.postHook,
+		"post-hook", "",
+		"Run this shell command after each successful operation, with the JSON result on its stdin "+
+			"and the iRODS path as its argument, e.g. to notify a queue")
+	rootCmd.PersistentFlags().BoolVar(&flags.postHookStrict,
+		"post-hook-strict", false,
+		"Fail an operation's input if its --post-hook fails, rather than only logging the failure")
+	rootCmd.PersistentFlags().IntVar(&flags.queryPageSize,
+		"query-page-size", irods.DefaultQueryPageSize,
+		"Number of rows to request in each page of iRODS query results")
+	rootCmd.PersistentFlags().BoolVar(&flags.noVerifyAccount,
+		"no-verify-account", false,
+		"Skip checking that the iRODS account can access a collection at startup")
+	rootCmd.PersistentFlags().StringVar(&flags.verifyPath,
+		"verify-path", "/",
+		"Collection to stat when verifying the iRODS account. Use ~ for the home collection")
 	rootCmd.SetVersionTemplate(`{{printf "%s\n" .Version}}`)
-	putCmd := &cobra.Command{
-		Use:   "put",
-		Short: "Upload files to iRODS.",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return irods.Put(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount), cmd.Context().Value(jsonKey).(map[string]interface{}), flags.checksum)
-		},
+	putCmd := operationCommand(logger, parsing.JSON_PUT_OP,
+		"Upload files to iRODS.", func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_CHECKSUM:          flags.putChecksum && !flags.noChecksum,
+				parsing.JSON_OP_FOLLOW_SYMLINKS:   flags.followSymlinks,
+				parsing.JSON_OP_INCLUDE:           flags.include,
+				parsing.JSON_OP_EXCLUDE:           flags.exclude,
+				parsing.JSON_OP_SKIP_UNCHANGED:    flags.skipUnchanged,
+				parsing.JSON_OP_RECURSE:           flags.recurse,
+				parsing.JSON_OP_MAX_DEPTH:         flags.maxDepth,
+				parsing.JSON_OP_RESOURCE_POOL:     flags.resourcePool,
+				parsing.JSON_OP_CHECKSUM_RETRY:    flags.checksumRetry,
+				parsing.JSON_OP_FOLLOW_REDIRECT:   flags.followRedirect,
+				parsing.JSON_OP_REDIRECT_FALLBACK: flags.redirectFallback,
+				parsing.JSON_OP_MAX_OBJECT_SIZE:   flags.maxObjectSize,
+				parsing.JSON_OP_CHECKSUM_WORKERS:  flags.checksumWorkers,
+			}
+		})
+	rootCmd.AddCommand(putCmd)
+	putCmd.Flags().BoolVar(&flags.putChecksum, "checksum", true, "Calculate the checksum server-side")
+	putCmd.Flags().BoolVar(&flags.noChecksum, "no-checksum", false, "Do not calculate the checksum, for speed")
+	putCmd.MarkFlagsMutuallyExclusive("checksum", "no-checksum")
+	putCmd.Flags().BoolVar(&flags.followSymlinks, "follow-symlinks", false, "Upload the targets of symlinks when putting a directory, rather than skipping them")
+	putCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Upload a directory tree into a collection")
+	putCmd.Flags().StringArrayVar(&flags.include, "include", nil, "Upload files matching this glob, even if excluded. May be repeated")
+	putCmd.Flags().StringArrayVar(&flags.exclude, "exclude", nil, "Do not upload files matching this glob when putting a directory. May be repeated")
+
+	putCmd.Flags().IntVar(&flags.maxDepth, "max-depth", irods.UnlimitedDepth, "Descend at most this many levels below the target; 0 for the target only, -1 for no limit")
+	putCmd.Flags().BoolVar(&flags.skipUnchanged, "skip-unchanged", false, "Do not upload files whose data objects already have the same size and checksum")
+	putCmd.Flags().IntVar(&flags.checksumRetry, "checksum-retry", 0, "Retry an upload this many times if its checksum does not match")
+	putCmd.Flags().IntVar(&flags.checksumWorkers, "checksum-workers", 1, "Number of local files to checksum at once with --skip-unchanged when putting a directory, before uploading any; 1 to checksum each as it is uploaded")
+	putCmd.Flags().StringSliceVar(&flags.resourcePool, "resource-pool", nil, "Comma-separated resources to which to upload data objects in turn, rather than the default resource")
+	putCmd.Flags().BoolVar(&flags.followRedirect, "follow-redirect", false, "Upload files in parallel directly to the resource server, rather than through the connected server")
+	putCmd.Flags().IntVar(&flags.maxObjectSize, "max-object-size", 0, "Refuse to upload any file larger than this many bytes, as a guard against a wrong path; 0 for no limit")
+	putCmd.Flags().BoolVar(&flags.redirectFallback, "redirect-fallback", false, "Upload through the connected server, with a warning, if the resource server cannot be reached with --follow-redirect")
+
+	getCmd := operationCommand(logger, parsing.JSON_GET_OP,
+		"Download objects from iRODS.", func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_INCLUDE:           flags.include,
+				parsing.JSON_OP_EXCLUDE:           flags.exclude,
+				parsing.JSON_OP_SKIP_UNCHANGED:    flags.skipUnchanged,
+				parsing.JSON_OP_MAX_DEPTH:         flags.maxDepth,
+				parsing.JSON_OP_MAX_INLINE_SIZE:   flags.maxInlineSize,
+				parsing.JSON_OP_CHECKSUM_RETRY:    flags.checksumRetry,
+				parsing.JSON_OP_FOLLOW_REDIRECT:   flags.followRedirect,
+				parsing.JSON_OP_REDIRECT_FALLBACK: flags.redirectFallback,
+				parsing.JSON_OP_TICKET:            flags.ticket,
+				parsing.JSON_OP_ON_CONFLICT:       flags.onConflict,
+			}
+		})
+	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().StringArrayVar(&flags.include, "include", nil, "Download data objects matching this glob, even if excluded. May be repeated")
+	getCmd.Flags().StringArrayVar(&flags.exclude, "exclude", nil, "Do not download data objects matching this glob when getting a collection. May be repeated")
+	getCmd.Flags().IntVar(&flags.maxDepth, "max-depth", irods.UnlimitedDepth, "Descend at most this many levels below the target; 0 for the target only, -1 for no limit")
+	getCmd.Flags().BoolVar(&flags.skipUnchanged, "skip-unchanged", false, "Do not download data objects whose local files already have the same size and checksum")
+	getCmd.Flags().IntVar(&flags.checksumRetry, "checksum-retry", 0, "Retry a download this many times if its checksum does not match")
+	getCmd.Flags().BoolVar(&flags.followRedirect, "follow-redirect", false, "Download data objects in parallel directly from the resource server, rather than through the connected server")
+	getCmd.Flags().BoolVar(&flags.redirectFallback, "redirect-fallback", false, "Download through the connected server, with a warning, if the resource server cannot be reached with --follow-redirect")
+	getCmd.Flags().IntVar(&flags.maxInlineSize, "max-inline-size", irods.MaxInlineSize, "Largest data object, in bytes, to return inline when no local path is given")
+	getCmd.Flags().Var(newChoiceValue(&flags.onConflict, parsing.JSON_ARG_CONFLICT_OVERWRITE,
+		parsing.JSON_ARG_CONFLICT_ERROR, parsing.JSON_ARG_CONFLICT_SKIP, parsing.JSON_ARG_CONFLICT_RENAME),
+		"on-conflict", "What to do when a local file already exists, one of [overwrite, error, skip, rename], "+
+			"by default overwrite; rename downloads to the first free name with a suffix .1, .2 and so on")
+	getCmd.Flags().StringVar(&flags.ticket, "ticket", "", "Download with the access granted by this iRODS ticket, unless an input gives its own ticket")
+
+	listCmd := operationCommand(logger, parsing.JSON_LIST_OP,
+		"List objects and collections, in the shape of baton-list",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_CONTENTS:         flags.contents,
+				parsing.JSON_OP_SIZE:             flags.size,
+				parsing.JSON_OP_CHECKSUM:         flags.checksum,
+				parsing.JSON_OP_SORT:             flags.sort,
+				parsing.JSON_OP_TICKET:           flags.ticket,
+				parsing.JSON_OP_INCLUDE_CHECKSUM: flags.includeChecksum,
+				parsing.JSON_OP_REQUIRE_CHECKSUM: flags.requireChecksum,
+			}
+		})
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVar(&flags.contents, "contents", false, "List the contents of collections")
+	listCmd.Flags().BoolVar(&flags.size, "size", false, "Report the sizes of data objects")
+	listCmd.Flags().BoolVar(&flags.checksum, "checksum", false, "Report the checksums of data objects")
+	listCmd.Flags().BoolVar(&flags.includeChecksum, "include-checksum", false,
+		"Flag whether each data object has a registered checksum, warning of those that do not")
+	listCmd.Flags().BoolVar(&flags.requireChecksum, "require-checksum", false,
+		"As --include-checksum, but fail any listing where a data object has no checksum")
+	listCmd.Flags().StringVar(&flags.ticket, "ticket", "", "List with the access granted by this iRODS ticket, unless an input gives its own ticket")
+	listCmd.Flags().Var(newChoiceValue(&flags.sort, parsing.JSON_ARG_SORT_PATH,
+		parsing.JSON_ARG_SORT_SIZE, parsing.JSON_ARG_SORT_MODIFIED),
+		"sort", "Sort the contents of collections by this field, one of [path, size, modified], "+
+			"ties broken by path. The whole listing is held in memory to sort it")
+
+	metaModArgs := func() map[string]interface{} {
+		return map[string]interface{}{
+			parsing.JSON_OP_OPERATION:     flags.operation,
+			parsing.JSON_OP_DEFAULT_UNITS: flags.defaultUnits,
+		}
 	}
+	metaModCmd := operationCommand(logger, parsing.JSON_METAMOD_OP,
+		"Alter metadata on objects or collections", metaModArgs)
+	metadataFileCommand(logger, metaModCmd, metaModArgs)
+	rootCmd.AddCommand(metaModCmd)
+	metaModCmd.Flags().Var(newChoiceValue(&flags.operation, parsing.JSON_ARG_META_ADD,
+		parsing.JSON_ARG_META_REM, parsing.JSON_ARG_META_UNITS),
+		"operation", "Operation to perform on AVUs without their own operator. One of [add, rem, units]")
+	metaModCmd.Flags().StringVar(&flags.defaultUnits, "default-units", "",
+		"Units to give AVUs that are added without their own")
+	metaModCmd.Flags().StringVar(&flags.metadataFile, "metadata-file", "",
+		"Read the targets and AVUs from this CSV (*.csv) or TSV file, rather than JSON from stdin. "+
+			"Its header names the collection and data_object columns and an attribute for each other column")
 
-	rootCmd.AddCommand(putCmd)
-	putCmd.Flags().BoolVar(&flags.checksum, "checksum", false, "Calculate the checksum server-side")
+	metaQueryCmd := operationCommand(logger, parsing.JSON_METAQUERY_OP,
+		"Query object or collection metadata", func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_ZONE_KEY:       flags.zone,
+				parsing.JSON_OP_ALL_ZONES:   flags.allZones,
+				parsing.JSON_OP_COLLECTION:  flags.coll,
+				parsing.JSON_OP_OBJECT:      flags.obj,
+				parsing.JSON_OP_COUNT:       flags.count,
+				parsing.JSON_OP_IGNORE_CASE: flags.ignoreCase,
+				parsing.JSON_OP_SORT:        flags.sort,
+			}
+		})
+	rootCmd.AddCommand(metaQueryCmd)
+	metaQueryCmd.Flags().StringVar(&flags.zone, "zone", "", "Zone in which to perform queries whose input does not give one")
+	metaQueryCmd.Flags().BoolVar(&flags.allZones, "all-zones", false, "Query every zone known to the server, including federated zones, tagging each result with its zone")
+	metaQueryCmd.MarkFlagsMutuallyExclusive("zone", "all-zones")
+	metaQueryCmd.Flags().BoolVar(&flags.coll, "coll", false, "Search collection metadata. At least one of --coll and --obj is required")
+	metaQueryCmd.Flags().BoolVar(&flags.obj, "obj", false, "Search data object metadata. At least one of --coll and --obj is required")
+	metaQueryCmd.MarkFlagsOneRequired("coll", "obj")
+	metaQueryCmd.Flags().BoolVar(&flags.count, "count", false, "Report only the number of matches")
+	metaQueryCmd.Flags().BoolVar(&flags.ignoreCase, "ignore-case", false, "Match attributes and values regardless of case")
+	metaQueryCmd.Flags().Var(newChoiceValue(&flags.sort, parsing.JSON_ARG_SORT_PATH,
+		parsing.JSON_ARG_SORT_SIZE, parsing.JSON_ARG_SORT_MODIFIED),
+		"sort", "Sort the matches by this field, one of [path, size, modified], "+
+			"ties broken by path. All the matches are held in memory to sort them")
+
+	chmodCmd := operationCommand(logger, parsing.JSON_CHMOD_OP,
+		"Change ACLs of an object or collection", func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_RECURSE:   flags.recurse,
+				parsing.JSON_OP_MAX_DEPTH: flags.maxDepth,
+				parsing.JSON_ZONE_KEY:     flags.zone,
+			}
+		})
+	rootCmd.AddCommand(chmodCmd)
+	chmodCmd.Flags().IntVar(&flags.maxDepth, "max-depth", irods.UnlimitedDepth, "Descend at most this many levels below the target; 0 for the target only, -1 for no limit")
+	chmodCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Apply acl change recursively if acting on a collection")
+	chmodCmd.Flags().StringVar(&flags.zone, "zone", "", "Zone of ACL owners that do not give one, e.g. to grant access to users of a federated zone")
+
+	moveCmd := operationCommand(logger, parsing.JSON_MOVE_OP,
+		"Move or rename objects or collections within iRODS",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_PATH:          flags.destination,
+				parsing.JSON_OP_PRESERVE_ACLS: flags.preserveACLs,
+			}
+		})
+	rootCmd.AddCommand(moveCmd)
+	moveCmd.Flags().StringVar(&flags.destination, "destination", "", "iRODS path to move to. \nRequired")
+	moveCmd.MarkFlagRequired("destination")
+	moveCmd.Flags().BoolVar(&flags.preserveACLs, "preserve-acls", false, "Apply the ACLs of the source again after the move, if inheritance at the destination changed them")
+
+	copyCmd := operationCommand(logger, parsing.JSON_COPY_OP,
+		"Copy objects or collections within iRODS, server-side",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_PATH:      flags.destination,
+				parsing.JSON_OP_RECURSE:   flags.recurse,
+				parsing.JSON_OP_PRESERVE:  flags.preserve,
+				parsing.JSON_OP_MAX_DEPTH: flags.maxDepth,
+				parsing.JSON_OP_OVERWRITE: flags.overwrite || flags.force,
+			}
+		})
+	rootCmd.AddCommand(copyCmd)
+	copyCmd.Flags().StringVar(&flags.destination, "destination", "", "iRODS path to copy to. \nRequired")
+	copyCmd.MarkFlagRequired("destination")
+	copyCmd.Flags().IntVar(&flags.maxDepth, "max-depth", irods.UnlimitedDepth, "Descend at most this many levels below the target; 0 for the target only, -1 for no limit")
+	copyCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Copy collections and their contents recursively")
+	copyCmd.Flags().BoolVar(&flags.overwrite, "overwrite", false, "Replace any existing data object at the destination, rather than failing")
+	copyCmd.Flags().BoolVar(&flags.force, "force", false, "Deprecated alias of --overwrite")
+	copyCmd.Flags().MarkDeprecated("force", "use --overwrite instead")
+	copyCmd.Flags().BoolVar(&flags.preserve, "preserve", false, "Apply the metadata and ACLs of each source to its copy")
+
+	mkdirCmd := operationCommand(logger, parsing.JSON_MKCOLL_OP,
+		"Create collections and any missing parents, like mkdir -p",
+		func() map[string]interface{} {
+			return map[string]interface{}{parsing.JSON_OP_STRICT: flags.strict}
+		})
+	rootCmd.AddCommand(mkdirCmd)
+	mkdirCmd.Flags().BoolVar(&flags.strict, "strict", false, "Fail if a collection already exists")
+
+	metaCopyCmd := operationCommand(logger, parsing.JSON_METACOPY_OP,
+		"Copy the metadata of objects or collections to another",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_PATH:      flags.destination,
+				parsing.JSON_OP_OVERWRITE: flags.overwrite,
+			}
+		})
+	rootCmd.AddCommand(metaCopyCmd)
+	metaCopyCmd.Flags().StringVar(&flags.destination, "destination", "", "iRODS path to copy the metadata to. \nRequired")
+	metaCopyCmd.MarkFlagRequired("destination")
+	metaCopyCmd.Flags().BoolVar(&flags.overwrite, "overwrite", false, "Replace the destination's values of each attribute copied, rather than adding to them")
+
+	statCmd := operationCommand(logger, parsing.JSON_STAT_OP,
+		"Report whether an object or collection exists, its type and size",
+		func() map[string]interface{} {
+			return map[string]interface{}{parsing.JSON_OP_TOTAL_SIZE: flags.totalSize}
+		})
+	rootCmd.AddCommand(statCmd)
+	statCmd.Flags().BoolVar(&flags.totalSize, "total-size", false, "Report the total size of the data objects in a collection, recursively")
+
+	checksumCmd := operationCommand(logger, parsing.JSON_CHECKSUM_OP,
+		"Report the checksum of data objects, optionally verifying that all replicas agree",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_VERIFY:          flags.verify,
+				parsing.JSON_OP_FORCE_RECOMPUTE: flags.forceRecompute,
+				parsing.JSON_OP_UPDATE_CATALOG:  flags.updateCatalog,
+			}
+		})
+	rootCmd.AddCommand(checksumCmd)
+	checksumCmd.Flags().BoolVar(&flags.verify, "verify", false, "Check that the checksums of all good replicas agree, reporting any that do not")
+	checksumCmd.Flags().BoolVar(&flags.forceRecompute, "force-recompute-checksum", false, "Recompute the checksum from the data and compare it with the registered one")
+	checksumCmd.Flags().BoolVar(&flags.updateCatalog, "update-catalog", false, "Register the recomputed checksum in place of any missing or stale one")
+	checksumCmd.MarkFlagsMutuallyExclusive("verify", "force-recompute-checksum")
+
+	duplicatesCmd := operationCommand(logger, parsing.JSON_DUPLICATES_OP,
+		"Report data objects in collections that share a checksum and size", nil)
+	rootCmd.AddCommand(duplicatesCmd)
 
-	getCmd := &cobra.Command{
-		Use:   "get",
-		Short: "Download objects from iRODS.",
+	registerCmd := operationCommand(logger, parsing.JSON_REGISTER_OP,
+		"Register files already on a resource as data objects, without copying them", nil)
+	rootCmd.AddCommand(registerCmd)
+
+	findCmd := operationCommand(logger, parsing.JSON_FIND_OP,
+		"List the data objects in a collection that have the given metadata",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_RECURSE:  flags.recurse,
+				parsing.JSON_OP_SIZE:     flags.size,
+				parsing.JSON_OP_CHECKSUM: flags.checksum,
+			}
+		})
+	rootCmd.AddCommand(findCmd)
+	findCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Also list matching data objects in sub-collections")
+	findCmd.Flags().BoolVar(&flags.size, "size", false, "Report the sizes of data objects")
+	findCmd.Flags().BoolVar(&flags.checksum, "checksum", false, "Report the checksums of data objects")
+
+	attributesCmd := operationCommand(logger, parsing.JSON_ATTRIBUTES_OP,
+		"List the distinct metadata attributes in use on the data objects in a collection",
+		func() map[string]interface{} {
+			return map[string]interface{}{parsing.JSON_OP_RECURSE: flags.recurse}
+		})
+	rootCmd.AddCommand(attributesCmd)
+	attributesCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Also include data objects in sub-collections")
+
+	valuesCmd := operationCommand(logger, parsing.JSON_VALUES_OP,
+		"List the distinct values of an attribute on the data objects in a collection",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_RECURSE: flags.recurse,
+				parsing.JSON_OP_COUNT:   flags.count,
+			}
+		})
+	rootCmd.AddCommand(valuesCmd)
+	valuesCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Also include data objects in sub-collections")
+	valuesCmd.Flags().BoolVar(&flags.count, "count", false, "Report the number of data objects with each value")
+
+	manifestCmd := operationCommand(logger, parsing.JSON_MANIFEST_OP,
+		"Describe every data object in a collection tree with its size, checksum, timestamps and AVUs",
+		func() map[string]interface{} {
+			return map[string]interface{}{parsing.JSON_OP_MAX_DEPTH: flags.maxDepth}
+		})
+	rootCmd.AddCommand(manifestCmd)
+	manifestCmd.Flags().IntVar(&flags.maxDepth, "max-depth", irods.UnlimitedDepth, "Descend at most this many levels below the target; 0 for the target only, -1 for no limit")
+
+	pruneCmd := operationCommand(logger, parsing.JSON_PRUNE_OP,
+		"Remove the sub-collections of collections that hold no data objects",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_PRUNE_EMPTY: flags.pruneEmpty,
+				parsing.JSON_OP_DRY_RUN:     flags.dryRun,
+				parsing.JSON_OP_NO_TRASH:    flags.noTrash || flags.force,
+			}
+		})
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().BoolVar(&flags.pruneEmpty, "prune-empty-collections", false, "Remove the empty collections found")
+	pruneCmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "Report the empty collections found without removing them")
+	pruneCmd.MarkFlagsOneRequired("prune-empty-collections", "dry-run")
+	pruneCmd.Flags().BoolVar(&flags.noTrash, "no-trash", false, "Remove the empty collections permanently, rather than moving them to the trash")
+	pruneCmd.Flags().BoolVar(&flags.force, "force", false, "Deprecated alias of --no-trash")
+	pruneCmd.Flags().MarkDeprecated("force", "use --no-trash instead")
+
+	trashCmd := operationCommand(logger, parsing.JSON_TRASH_OP,
+		"List the data objects in your own trash, or remove them permanently",
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_EMPTY_TRASH: flags.emptyTrash,
+				parsing.JSON_OP_DRY_RUN:     flags.dryRun,
+			}
+		})
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.Flags().BoolVar(&flags.emptyTrash, "empty-trash", false, "Permanently remove the contents of the trash, or of the collection within it given")
+	trashCmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "Report what --empty-trash would remove without removing it")
+	trashCmd.MarkFlagsMutuallyExclusive("empty-trash", "dry-run")
+
+	replicateCmd := operationCommand(logger, parsing.JSON_REPLICATE_OP,
+		"Replicate data objects to the resource named in each input", func() map[string]interface{} {
+			return map[string]interface{}{parsing.JSON_OP_ALL: flags.all}
+		})
+	rootCmd.AddCommand(replicateCmd)
+	replicateCmd.Flags().BoolVar(&flags.all, "all", false,
+		"Replicate to every member of the resource, which is a resource group")
+
+	trimCmd := operationCommand(logger, parsing.JSON_TRIM_OP,
+		"Trim excess replicas of data objects", func() map[string]interface{} {
+			return map[string]interface{}{
+				parsing.JSON_OP_COPIES:       flags.copies,
+				parsing.JSON_OP_REPLICA:      flags.replica,
+				parsing.JSON_OP_RESOURCE:     flags.resource,
+				parsing.JSON_OP_MIN_REPLICAS: flags.minReplicas,
+			}
+		})
+	rootCmd.AddCommand(trimCmd)
+	trimCmd.Flags().IntVar(&flags.copies, "copies", 0, "Trim replicas down to this number")
+	trimCmd.Flags().IntVar(&flags.replica, "replica", irods.NoReplica, "Trim this replica number")
+	trimCmd.Flags().StringVar(&flags.resource, "resource", "", "Trim replicas on this resource")
+	trimCmd.Flags().IntVar(&flags.minReplicas, "min-replicas", 1, "Never trim below this number of replicas")
+	trimCmd.MarkFlagsOneRequired("copies", "replica", "resource")
+	trimCmd.MarkFlagsMutuallyExclusive("replica", "resource")
+
+	envCmd := &cobra.Command{
+		Use:     "env",
+		Aliases: []string{"whoami"},
+		Short:   "Report the iRODS account and environment in use as JSON",
+		Annotations: map[string]string{
+			noInputAnnotation:  "",
+			noVerifyAnnotation: "",
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return irods.Get(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount), cmd.Context().Value(jsonKey).(map[string]interface{}))
+			return finishResults(results.write(irods.Env(logger,
+				cmd.Context().Value(managerKey).(*icommands.ICommandsEnvironmentManager),
+				cmd.Context().Value(accountKey).(*types.IRODSAccount))))
 		},
 	}
-	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(envCmd)
 
-	metaModCmd := &cobra.Command{
-		Use:   "metamod",
-		Short: "Alter metadata on objects or collections",
+	pingCmd := &cobra.Command{
+		Use:   "ping",
+		Short: "Check that iRODS is reachable, reporting the latency as JSON",
+		Annotations: map[string]string{
+			noInputAnnotation:  "",
+			noVerifyAnnotation: "",
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return irods.MetaMod(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount), cmd.Context().Value(jsonKey).(map[string]interface{}), flags.operation)
+			// The outcome is written whether or not the ping succeeds
+			jsonOut, err := irods.Ping(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount))
+			if werr := results.write(jsonOut); err == nil {
+				err = werr
+			}
+			return finishResults(err)
 		},
 	}
-	rootCmd.AddCommand(metaModCmd)
-	metaModCmd.Flags().StringVar(&flags.operation, "operation", "", "Operation to perform. One of [add, remove]. \nRequired")
-	metaModCmd.MarkFlagRequired("operation")
+	rootCmd.AddCommand(pingCmd)
 
-	metaQueryCmd := &cobra.Command{
-		Use:   "metaquery",
-		Short: "Query object or collection metadata",
+	doCmd := &cobra.Command{
+		Use:   "do",
+		Short: "Perform the operation named in each input envelope",
+		Long: `Perform the operation named in each input envelope.
+
+Each envelope has the form used by baton-do:
+  {"operation": <name>, "arguments": {...}, "target": {...}}
+allowing a single input stream to mix operations.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return irods.MetaQuery(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount), cmd.Context().Value(jsonKey).(map[string]interface{}), flags.zone, flags.coll, flags.obj)
+			return finishResults(forEachInput(logger, cmd, func(account *types.IRODSAccount, envelope map[string]interface{}) error {
+				return doOperation(logger, account, envelope)
+			}))
 		},
 	}
-	rootCmd.AddCommand(metaQueryCmd)
-	metaQueryCmd.Flags().StringVar(&flags.zone, "zone", "", "Zone in which to perform query. \nRequired")
-	metaQueryCmd.Flags().BoolVar(&flags.coll, "coll", false, "Limit metadata search to collection metadata only")
-	metaQueryCmd.Flags().BoolVar(&flags.obj, "obj", false, "Limit metadata search to data object metadata only")
+	rootCmd.AddCommand(doCmd)
 
-	chmodCmd := &cobra.Command{
-		Use:   "chmod",
-		Short: "Change ACLs of an object or collection",
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Report the version of go-baton, with --json its build details",
+		Annotations: map[string]string{
+			noSetupAnnotation: "",
+		},
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return irods.Chmod(logger, cmd.Context().Value(accountKey).(*types.IRODSAccount), cmd.Context().Value(jsonKey).(map[string]interface{}), false)
+			if !flags.jsonOutput {
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), appInfo.Version)
+				return err
+			}
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(appInfo.CurrentBuild())
 		},
 	}
-	rootCmd.AddCommand(chmodCmd)
-	chmodCmd.Flags().BoolVar(&flags.recurse, "recurse", false, "Apply acl change recursively if acting on a collection")
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVar(&flags.jsonOutput, "json", false,
+		"Report the version, commit, build date and Go and go-irodsclient versions as JSON")
+
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCommand())
+	if err := registerChoiceCompletions(rootCmd); err != nil {
+		mainLogger.Error().Err(err).Msg("Failed to register flag completions")
+		os.Exit(exitFailure)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
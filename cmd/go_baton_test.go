@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wtsi-npg/go-baton/irods"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("failed"), exitFailure},
+		{irods.ErrInvalidArgument, exitFailure},
+		{fmt.Errorf("%w: %w", errors.New("replica 1"), irods.ErrReplicaMismatch), exitReplicaMismatch},
+		{fmt.Errorf("/zone/a: %w", irods.ErrNotFound), exitNotFound},
+		{irods.ErrLocalPathNotFound, exitNotFound},
+		{fmt.Errorf("/zone/a: %w", irods.ErrPermissionDenied), exitPermissionDenied},
+		{irods.ErrLocalPathNotReadable, exitPermissionDenied},
+		{fmt.Errorf("ticket: %w", irods.ErrInvalidTicket), exitPermissionDenied},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("exitCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/irods"
+)
+
+// runPostHook runs the --post-hook command after a successful operation, with
+// the JSON of the result on its stdin and the iRODS path of the result as its
+// first argument. The command is run by sh, so it may be a pipeline or have
+// arguments of its own, ahead of the path. Its output is logged rather than
+// being mixed with the results.
+//
+// A hook that fails is logged and otherwise ignored, unless --post-hook-strict
+// is set, in which case its error is returned, failing the operation's input.
+func runPostHook(logger zerolog.Logger, result *irods.OperationResult) error {
+	if flags.postHook == "" || result == nil || !result.Success {
+		return nil
+	}
+
+	iPath := result.IRODSPath()
+	stdin, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	hook := exec.Command("sh", "-c", flags.postHook+` "$@"`, "sh", iPath)
+	hook.Stdin = bytes.NewReader(stdin)
+	hook.Stderr = os.Stderr
+	output, err := hook.Output()
+
+	if out := strings.TrimSpace(string(output)); out != "" {
+		logger.Info().Str("path", iPath).Str("output", out).Msg("Post-hook output")
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		logger.Debug().Str("path", iPath).Msg("Post-hook succeeded")
+		return nil
+	case errors.As(err, &exitErr):
+		err = fmt.Errorf("post-hook for %s exited with status %d", iPath, exitErr.ExitCode())
+	default:
+		err = fmt.Errorf("post-hook for %s could not be run: %w", iPath, err)
+	}
+
+	if flags.postHookStrict {
+		return err
+	}
+	logger.Warn().Err(err).Msg("Ignoring failed post-hook")
+	return nil
+}
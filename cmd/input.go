@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// inputSource records the file from which an input was read and its position
+// among the inputs of that file, counting from 1.
+type inputSource struct {
+	file  string
+	index int
+}
+
+// readInputFiles returns the JSON inputs in files, as they would be read from
+// stdin, concatenated in the order the files are given, along with the source of
+// each. Every file is read before any input is processed, so that one that
+// cannot be read or decoded is reported before any work is done in iRODS.
+func readInputFiles(logger zerolog.Logger, files []string) (
+	inputContents []map[string]interface{}, sources []inputSource, err error) {
+	for _, file := range files {
+		var contents []map[string]interface{}
+		if contents, err = readInputFile(logger, file); err != nil {
+			return nil, nil, fmt.Errorf("input file %s: %w", file, err)
+		}
+		for i := range contents {
+			sources = append(sources, inputSource{file: file, index: i + 1})
+		}
+		inputContents = append(inputContents, contents...)
+		logger.Debug().Msgf("Read %d inputs from %s", len(contents), file)
+	}
+	return inputContents, sources, nil
+}
+
+// readInputFile returns the JSON inputs in a file.
+func readInputFile(logger zerolog.Logger, file string) (
+	inputContents []map[string]interface{}, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parsing.ParseInput(logger, f)
+}
+
+// dedupeInputs returns the inputs without any that are identical to one before
+// them, along with the sources of those kept, if there are any, and the number
+// of duplicates skipped. Inputs are identical if their canonical JSON encodings,
+// with the keys of every object sorted, have the same hash, so that key order
+// does not matter. The first of each set of duplicates keeps its place.
+func dedupeInputs(logger zerolog.Logger, inputs []map[string]interface{},
+	sources []inputSource) (kept []map[string]interface{}, keptSources []inputSource,
+	skipped int, err error) {
+	seen := make(map[[sha256.Size]byte]bool, len(inputs))
+	for i, input := range inputs {
+		var encoded []byte
+		if encoded, err = json.Marshal(input); err != nil {
+			return nil, nil, 0, err
+		}
+		hash := sha256.Sum256(encoded)
+		if seen[hash] {
+			logger.Debug().Msgf("Skipping input %d, which duplicates an earlier one", i+1)
+			skipped++
+			continue
+		}
+		seen[hash] = true
+		kept = append(kept, input)
+		if i < len(sources) {
+			keptSources = append(keptSources, sources[i])
+		}
+	}
+	return kept, keptSources, skipped, nil
+}
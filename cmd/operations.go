@@ -0,0 +1,743 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/wtsi-npg/go-baton/irods"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// OperationFunc performs a single operation on a target and returns its result.
+// The args carry the operation's options, taken from either the command line
+// flags of the operation's subcommand or the arguments of a baton-do style
+// envelope. Operations with many options convert the args to the options struct
+// of their irods function in one place, e.g. putOptions, where any option that
+// may also be given in the target JSON takes precedence over the args.
+type OperationFunc func(logger zerolog.Logger, account *types.IRODSAccount,
+	target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error)
+
+// operations is the registry of operations, keyed by the name used both for
+// the subcommand and for the operation field of a baton-do style envelope.
+var operations = map[string]OperationFunc{
+	parsing.JSON_PUT_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		options, err := putOptions(logger, args)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Put(logger, account, target, options)
+	},
+	parsing.JSON_GET_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		options, err := getOptions(logger, args)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Get(logger, account, target, options)
+	},
+	parsing.JSON_LIST_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		contents, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_CONTENTS)
+		if err != nil {
+			return nil, err
+		}
+		size, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_CHECKSUM)
+		if err != nil {
+			return nil, err
+		}
+		sort, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_SORT)
+		if err != nil {
+			return nil, err
+		}
+		includeChecksum, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_INCLUDE_CHECKSUM)
+		if err != nil {
+			return nil, err
+		}
+		requireChecksum, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_REQUIRE_CHECKSUM)
+		if err != nil {
+			return nil, err
+		}
+		return irods.List(logger, account, target, contents, size, checksum, sort,
+			includeChecksum || requireChecksum, requireChecksum)
+	},
+	parsing.JSON_METAMOD_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		operation, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_OPERATION)
+		if err != nil {
+			return nil, err
+		}
+		defaultUnits, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_DEFAULT_UNITS)
+		if err != nil {
+			return nil, err
+		}
+		return irods.MetaMod(logger, account, target, operation, defaultUnits)
+	},
+	parsing.JSON_METAQUERY_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		options, err := metaQueryOptions(logger, target, args)
+		if err != nil {
+			return nil, err
+		}
+		return irods.MetaQuery(logger, account, target, options)
+	},
+	parsing.JSON_CHMOD_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		options, err := chmodOptions(logger, args)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Chmod(logger, account, target, options)
+	},
+
+	parsing.JSON_MOVE_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		destination, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_PATH)
+		if err != nil {
+			return nil, err
+		}
+		preserveACLs, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_PRESERVE_ACLS)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Move(logger, account, target, destination, preserveACLs)
+	},
+	parsing.JSON_COPY_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		destination, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_PATH)
+		if err != nil {
+			return nil, err
+		}
+		recurse, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_RECURSE)
+		if err != nil {
+			return nil, err
+		}
+		preserve, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_PRESERVE)
+		if err != nil {
+			return nil, err
+		}
+		maxDepth, err := maxDepthArgument(logger, args)
+		if err != nil {
+			return nil, err
+		}
+		overwrite, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_OVERWRITE)
+		if err != nil {
+			return nil, err
+		}
+		force, err := forceArgument(logger, args, parsing.JSON_OP_OVERWRITE)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Copy(logger, account, target, destination, recurse, maxDepth, preserve,
+			overwrite || force)
+	},
+	parsing.JSON_METACOPY_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		destination, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_PATH)
+		if err != nil {
+			return nil, err
+		}
+		overwrite, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_OVERWRITE)
+		if err != nil {
+			return nil, err
+		}
+		return irods.MetaCopy(logger, account, target, destination, overwrite)
+	},
+	parsing.JSON_REPLICATE_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		all, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_ALL)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Replicate(logger, account, target, all)
+	},
+	parsing.JSON_TRIM_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		copies, err := parsing.GetIntArgument(logger, args, parsing.JSON_OP_COPIES, 0)
+		if err != nil {
+			return nil, err
+		}
+		replica, err := parsing.GetIntArgument(logger, args, parsing.JSON_OP_REPLICA, irods.NoReplica)
+		if err != nil {
+			return nil, err
+		}
+		resource, err := parsing.GetStringArgument(logger, args, parsing.JSON_OP_RESOURCE)
+		if err != nil {
+			return nil, err
+		}
+		minReplicas, err := parsing.GetIntArgument(logger, args, parsing.JSON_OP_MIN_REPLICAS, 1)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Trim(logger, account, target, copies, replica, resource, minReplicas)
+	},
+	parsing.JSON_CHECKSUM_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		verify, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_VERIFY)
+		if err != nil {
+			return nil, err
+		}
+		recompute, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_FORCE_RECOMPUTE)
+		if err != nil {
+			return nil, err
+		}
+		update, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_UPDATE_CATALOG)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Checksum(logger, account, target, verify, recompute, update)
+	},
+	parsing.JSON_ATTRIBUTES_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		recurse, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_RECURSE)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Attributes(logger, account, target, recurse)
+	},
+	parsing.JSON_VALUES_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		recurse, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_RECURSE)
+		if err != nil {
+			return nil, err
+		}
+		count, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_COUNT)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Values(logger, account, target, recurse, count)
+	},
+	parsing.JSON_REGISTER_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		return irods.Register(logger, account, target)
+	},
+	parsing.JSON_DUPLICATES_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		return irods.Duplicates(logger, account, target)
+	},
+	parsing.JSON_FIND_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		recurse, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_RECURSE)
+		if err != nil {
+			return nil, err
+		}
+		size, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_CHECKSUM)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Find(logger, account, target, recurse, size, checksum)
+	},
+	parsing.JSON_MANIFEST_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		maxDepth, err := maxDepthArgument(logger, args)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Manifest(logger, account, target, maxDepth, writeResult)
+	},
+	parsing.JSON_MKCOLL_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		strict, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_STRICT)
+		if err != nil {
+			return nil, err
+		}
+		return irods.MakeCollection(logger, account, target, strict)
+	},
+	parsing.JSON_PRUNE_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		prune, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_PRUNE_EMPTY)
+		if err != nil {
+			return nil, err
+		}
+		dryRun, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_DRY_RUN)
+		if err != nil {
+			return nil, err
+		}
+		noTrash, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_NO_TRASH)
+		if err != nil {
+			return nil, err
+		}
+		force, err := forceArgument(logger, args, parsing.JSON_OP_NO_TRASH)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Prune(logger, account, target, prune, dryRun, noTrash || force)
+	},
+	parsing.JSON_TRASH_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		empty, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_EMPTY_TRASH)
+		if err != nil {
+			return nil, err
+		}
+		dryRun, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_DRY_RUN)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Trash(logger, account, target, empty, dryRun)
+	},
+	parsing.JSON_STAT_OP: func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		totalSize, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_TOTAL_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		return irods.Stat(logger, account, target, totalSize)
+	},
+}
+
+// pathFilter returns the filter described by the include and exclude arguments
+// of a recursive transfer.
+func pathFilter(logger zerolog.Logger, args map[string]interface{}) (
+	filter irods.PathFilter, err error) {
+	if filter.Include, err = parsing.GetStringListArgument(logger, args, parsing.JSON_OP_INCLUDE); err != nil {
+		return filter, err
+	}
+	if filter.Exclude, err = parsing.GetStringListArgument(logger, args, parsing.JSON_OP_EXCLUDE); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// resourcePools holds the resource pool for each list of resources, so that
+// successive puts in a run continue around the same pool rather than each
+// starting again with its first resource.
+var resourcePools = map[string]*irods.ResourcePool{}
+
+// resourcePool returns the resource pool named by the arguments, which is nil if
+// they name none.
+func resourcePool(logger zerolog.Logger, args map[string]interface{}) (
+	pool *irods.ResourcePool, err error) {
+	var resources []string
+	if resources, err = parsing.GetStringListArgument(logger, args, parsing.JSON_OP_RESOURCE_POOL); err != nil {
+		return nil, err
+	}
+	key := strings.Join(resources, ",")
+	if pool, ok := resourcePools[key]; ok {
+		return pool, nil
+	}
+	if pool, err = irods.NewResourcePool(resources); err != nil {
+		return nil, err
+	}
+	resourcePools[key] = pool
+	return pool, nil
+}
+
+// forceArgument returns the deprecated force argument, warning that it is
+// deprecated in favour of replacement if it is set. Force once meant different
+// things to different operations, so each operation that accepts it maps it to
+// the option with the name of what it does there:
+//
+//	copy:  overwrite, replacing existing data objects at the destination
+//	prune: no-trash, removing collections permanently rather than to the trash
+func forceArgument(logger zerolog.Logger, args map[string]interface{},
+	replacement string) (bool, error) {
+	force, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_FORCE)
+	if force {
+		logger.Warn().Msgf("The %s argument is deprecated; use %s instead",
+			parsing.JSON_OP_FORCE, replacement)
+	}
+	return force, err
+}
+
+// checksumRetryArgument returns the number of times to retry a transfer whose
+// checksums do not match, which is none unless given.
+func checksumRetryArgument(logger zerolog.Logger, args map[string]interface{}) (int, error) {
+	retries, err := parsing.GetIntArgument(logger, args, parsing.JSON_OP_CHECKSUM_RETRY, 0)
+	if err != nil {
+		return 0, err
+	}
+	if retries < 0 {
+		return 0, fmt.Errorf("invalid %s %d: %w", parsing.JSON_OP_CHECKSUM_RETRY, retries,
+			irods.ErrInvalidArgument)
+	}
+	return retries, nil
+}
+
+// redirectArgument returns whether transfers follow redirects to the resource
+// server, which they do not unless asked. Falling back to the connected server
+// only makes sense when following redirects.
+func redirectArgument(logger zerolog.Logger, args map[string]interface{}) (irods.Redirect, error) {
+	follow, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_FOLLOW_REDIRECT)
+	if err != nil {
+		return irods.NoRedirect, err
+	}
+	fallback, err := parsing.GetBoolArgument(logger, args, parsing.JSON_OP_REDIRECT_FALLBACK)
+	if err != nil {
+		return irods.NoRedirect, err
+	}
+	if fallback && !follow {
+		return irods.NoRedirect, fmt.Errorf("%s requires %s: %w", parsing.JSON_OP_REDIRECT_FALLBACK,
+			parsing.JSON_OP_FOLLOW_REDIRECT, irods.ErrInvalidArgument)
+	}
+	return irods.NewRedirect(follow, fallback), nil
+}
+
+// putOptions returns the options of a put operation from its arguments.
+func putOptions(logger zerolog.Logger, args map[string]interface{}) (
+	options irods.PutOptions, err error) {
+	if options.Checksum, err = parsing.GetBoolArgumentDefault(logger, args,
+		parsing.JSON_OP_CHECKSUM, true); err != nil {
+		return options, err
+	}
+	if options.FollowSymlinks, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_FOLLOW_SYMLINKS); err != nil {
+		return options, err
+	}
+	if options.Filter, err = pathFilter(logger, args); err != nil {
+		return options, err
+	}
+	if options.SkipUnchanged, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_SKIP_UNCHANGED); err != nil {
+		return options, err
+	}
+	if options.Recurse, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_RECURSE); err != nil {
+		return options, err
+	}
+	if options.MaxDepth, err = maxDepthArgument(logger, args); err != nil {
+		return options, err
+	}
+	if options.Pool, err = resourcePool(logger, args); err != nil {
+		return options, err
+	}
+	if options.ChecksumRetries, err = checksumRetryArgument(logger, args); err != nil {
+		return options, err
+	}
+	var maxObjectSize int
+	if maxObjectSize, err = parsing.GetIntArgument(logger, args,
+		parsing.JSON_OP_MAX_OBJECT_SIZE, 0); err != nil {
+		return options, err
+	}
+	options.MaxObjectSize = int64(maxObjectSize)
+	if options.ChecksumWorkers, err = parsing.GetIntArgument(logger, args,
+		parsing.JSON_OP_CHECKSUM_WORKERS, 1); err != nil {
+		return options, err
+	}
+	if options.ChecksumWorkers < 1 {
+		return options, fmt.Errorf("invalid %s %d: %w", parsing.JSON_OP_CHECKSUM_WORKERS,
+			options.ChecksumWorkers, irods.ErrInvalidArgument)
+	}
+	options.Redirect, err = redirectArgument(logger, args)
+	return options, err
+}
+
+// getOptions returns the options of a get operation from its arguments.
+func getOptions(logger zerolog.Logger, args map[string]interface{}) (
+	options irods.GetOptions, err error) {
+	if options.Filter, err = pathFilter(logger, args); err != nil {
+		return options, err
+	}
+	if options.SkipUnchanged, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_SKIP_UNCHANGED); err != nil {
+		return options, err
+	}
+	if options.MaxDepth, err = maxDepthArgument(logger, args); err != nil {
+		return options, err
+	}
+	if options.MaxInlineSize, err = parsing.GetIntArgument(logger, args,
+		parsing.JSON_OP_MAX_INLINE_SIZE, irods.MaxInlineSize); err != nil {
+		return options, err
+	}
+	if options.ChecksumRetries, err = checksumRetryArgument(logger, args); err != nil {
+		return options, err
+	}
+	if options.OnConflict, err = parsing.GetStringArgument(logger, args,
+		parsing.JSON_OP_ON_CONFLICT); err != nil {
+		return options, err
+	}
+	options.Redirect, err = redirectArgument(logger, args)
+	return options, err
+}
+
+// chmodOptions returns the options of a chmod operation from its arguments.
+func chmodOptions(logger zerolog.Logger, args map[string]interface{}) (
+	options irods.ChmodOptions, err error) {
+	if options.Recurse, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_RECURSE); err != nil {
+		return options, err
+	}
+	if options.MaxDepth, err = maxDepthArgument(logger, args); err != nil {
+		return options, err
+	}
+	options.Zone, err = parsing.GetStringArgument(logger, args, parsing.JSON_ZONE_KEY)
+	return options, err
+}
+
+// metaQueryOptions returns the options of a metaquery operation from its
+// arguments. The zone may also be given in the target, which takes precedence
+// over the arguments, so that each query of a stream may be made in a different
+// zone while the --zone flag sets the zone of the others.
+func metaQueryOptions(logger zerolog.Logger, target map[string]interface{},
+	args map[string]interface{}) (options irods.MetaQueryOptions, err error) {
+	if options.Zone, err = parsing.GetStringArgument(logger, target,
+		parsing.JSON_ZONE_KEY); err != nil {
+		return options, err
+	}
+	if options.Zone == "" {
+		if options.Zone, err = parsing.GetStringArgument(logger, args,
+			parsing.JSON_ZONE_KEY); err != nil {
+			return options, err
+		}
+	}
+	if options.AllZones, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_ALL_ZONES); err != nil {
+		return options, err
+	}
+	if options.Collections, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_COLLECTION); err != nil {
+		return options, err
+	}
+	if options.Objects, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_OBJECT); err != nil {
+		return options, err
+	}
+	if options.Count, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_COUNT); err != nil {
+		return options, err
+	}
+	if options.IgnoreCase, err = parsing.GetBoolArgument(logger, args,
+		parsing.JSON_OP_IGNORE_CASE); err != nil {
+		return options, err
+	}
+	options.Sort, err = parsing.GetStringArgument(logger, args, parsing.JSON_OP_SORT)
+	return options, err
+}
+
+// maxDepthArgument returns the maximum depth of a recursive operation, which is
+// unlimited unless given.
+func maxDepthArgument(logger zerolog.Logger, args map[string]interface{}) (int, error) {
+	maxDepth, err := parsing.GetIntArgument(logger, args, parsing.JSON_OP_MAX_DEPTH,
+		irods.UnlimitedDepth)
+	if err != nil {
+		return 0, err
+	}
+	if maxDepth < irods.UnlimitedDepth {
+		return 0, fmt.Errorf("invalid %s %d: %w", parsing.JSON_OP_MAX_DEPTH, maxDepth,
+			irods.ErrInvalidArgument)
+	}
+	return maxDepth, nil
+}
+
+// globOperations are the operations whose targets may use wildcards in their
+// data object names; see irods.ExpandGlob.
+var globOperations = map[string]bool{
+	parsing.JSON_CHECKSUM_OP: true,
+	parsing.JSON_CHMOD_OP:    true,
+	parsing.JSON_GET_OP:      true,
+	parsing.JSON_LIST_OP:     true,
+	parsing.JSON_METAMOD_OP:  true,
+	parsing.JSON_STAT_OP:     true,
+	parsing.JSON_TRIM_OP:     true,
+}
+
+// ticketOperations are the operations that may be performed with the access
+// granted by an iRODS ticket.
+var ticketOperations = map[string]bool{
+	parsing.JSON_GET_OP:  true,
+	parsing.JSON_LIST_OP: true,
+}
+
+// ticketAccount returns the account with which to perform an operation that may
+// use a ticket: a copy of account presenting the ticket of the target or, if it
+// has none, of the args, or account itself if there is neither.
+func ticketAccount(logger zerolog.Logger, account *types.IRODSAccount,
+	target map[string]interface{}, args map[string]interface{}) (*types.IRODSAccount, error) {
+	ticket, err := parsing.GetTicketValue(target)
+	if errors.Is(err, parsing.ErrMissingKey) {
+		ticket, err = parsing.GetTicketValue(args)
+	}
+	if errors.Is(err, parsing.ErrMissingKey) {
+		return account, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug().Msg("Using an iRODS ticket")
+	return irods.WithTicket(account, ticket)
+}
+
+// runOperation performs the named operation on a target and writes its result.
+// If the operation supports wildcards, it is performed once on each data object
+// matching the target. Any post-hook is run after each success; see
+// runPostHook. The result of a failed operation is written before its error is
+// returned, as is that of a target that could not be prepared, for example
+// because it is invalid or its wildcards match nothing. Expanding wildcards
+// counts towards the operation timeout.
+func runOperation(logger zerolog.Logger, account *types.IRODSAccount, name string,
+	target map[string]interface{}, args map[string]interface{}) (err error) {
+	var result *irods.OperationResult
+
+	if event := logger.Trace(); event.Enabled() {
+		event.Interface("target", parsing.Redact(target)).
+			Interface("arguments", parsing.Redact(args)).
+			Msgf("Starting %s operation", name)
+	}
+
+	// Bad input fails before a ticket or wildcards can cause any network I/O
+	targets := []map[string]interface{}{target}
+	err = parsing.Validate(name, target)
+	if err == nil && ticketOperations[name] {
+		account, err = ticketAccount(logger, account, target, args)
+	}
+	if err == nil && globOperations[name] {
+		_, err = irods.WithOperationTimeout(logger, name, func() (*irods.OperationResult, error) {
+			var gerr error
+			targets, gerr = irods.ExpandGlob(logger, account, target)
+			return nil, gerr
+		})
+	}
+	if err != nil {
+		if werr := writeResult(failedResult(logger, name, target, err)); werr != nil {
+			return werr
+		}
+		return err
+	}
+
+	var firstErr error
+	for _, t := range targets {
+		result, err = irods.WithOperationTimeout(logger, name, func() (*irods.OperationResult, error) {
+			return performOperation(logger, account, name, t, args)
+		})
+		if err == nil {
+			err = runPostHook(logger, result)
+		}
+		if err != nil {
+			// Report every failure in the results, so that each input of a batch
+			// that carries on past it has a result
+			if result == nil {
+				result = failedResult(logger, name, t, err)
+			}
+			result.Success = false
+			result.Error = err.Error()
+		}
+		if werr := writeResult(result); werr != nil {
+			return werr
+		}
+		if err != nil {
+			if flags.failFast {
+				return err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// failedResult returns the result of an operation on target that failed with
+// err before the operation could report a result of its own, giving whatever
+// iRODS path the target has.
+func failedResult(logger zerolog.Logger, name string, target map[string]interface{},
+	err error) *irods.OperationResult {
+	result := &irods.OperationResult{Operation: name, Error: err.Error()}
+	if coll, cerr := parsing.GetCollectionValue(logger, target); cerr == nil {
+		result.Collection = coll
+	}
+	if obj, oerr := parsing.GetDataObjectValue(logger, target); oerr == nil {
+		result.DataObject = obj
+	}
+	return result
+}
+
+// performOperation performs the named operation on a single target. A panic in
+// the operation is recovered and returned as an error wrapping
+// irods.ErrOperationPanic, so that it fails only its own input rather than the
+// whole batch. The operation's deferred calls, which return its connections and
+// release its file systems, have run by the time the panic is recovered.
+func performOperation(logger zerolog.Logger, account *types.IRODSAccount, name string,
+	target map[string]interface{}, args map[string]interface{}) (result *irods.OperationResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error().
+				Str("operation", name).
+				Str("stack", string(debug.Stack())).
+				Msgf("Recovered from a panic: %v", r)
+			result, err = nil, fmt.Errorf("%s operation: %v: %w", name, r, irods.ErrOperationPanic)
+		}
+	}()
+
+	return operations[name](logger, account, target, args)
+}
+
+// operationCommand returns a subcommand that performs the named operation on
+// each input object. flagArgs converts the subcommand's flags into operation
+// arguments and is called once the flags have been parsed.
+func operationCommand(logger zerolog.Logger, name string, short string,
+	flagArgs func() map[string]interface{}) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: short,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			args := map[string]interface{}{}
+			if flagArgs != nil {
+				args = flagArgs()
+			}
+			return finishResults(forEachInput(logger, cmd, func(account *types.IRODSAccount,
+				jsonContents map[string]interface{}) error {
+				return runOperation(logger, account, name, jsonContents, args)
+			}))
+		},
+	}
+}
+
+// doOperation performs the operation named in a baton-do style envelope on
+// the envelope's target, using the envelope's arguments in place of the
+// flags the equivalent subcommand would take.
+func doOperation(logger zerolog.Logger, account *types.IRODSAccount,
+	envelope map[string]interface{}) (err error) {
+	var operation string
+	var target, args map[string]interface{}
+
+	if err = parsing.ValidateEnvelope(envelope); err != nil {
+		return err
+	}
+	if operation, err = parsing.GetOperation(logger, envelope); err != nil {
+		return err
+	}
+	if target, err = parsing.GetTarget(logger, envelope); err != nil {
+		return err
+	}
+	if args, err = parsing.GetArguments(logger, envelope); err != nil {
+		return err
+	}
+
+	if _, ok := operations[operation]; !ok {
+		return fmt.Errorf("unsupported operation '%s': %w", operation,
+			irods.ErrInvalidArgument)
+	}
+
+	logger.Debug().Msgf("Dispatching %s operation", operation)
+
+	return runOperation(logger, account, operation, target, args)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/wtsi-npg/go-baton/irods"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// captureResults directs the results written by a test to a buffer, which is
+// returned, restoring the writer when the test ends.
+func captureResults(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := results
+	results = &resultWriter{out: &buf, format: outputNDJSON}
+	t.Cleanup(func() { results = saved })
+	return &buf
+}
+
+// decodeResults returns the NDJSON results in buf.
+func decodeResults(t *testing.T, buf *bytes.Buffer) []irods.OperationResult {
+	t.Helper()
+	var decoded []irods.OperationResult
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var result irods.OperationResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("invalid result: %v", err)
+		}
+		decoded = append(decoded, result)
+	}
+	return decoded
+}
+
+func TestRunOperationReportsUnpreparedTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     string
+		target map[string]interface{}
+		want   error
+	}{
+		{"zone-wide glob", parsing.JSON_STAT_OP,
+			map[string]interface{}{"collection": "/zone", "data_object": "*.txt"},
+			irods.ErrInvalidArgument},
+		{"unterminated class", parsing.JSON_STAT_OP,
+			map[string]interface{}{"collection": "/zone/home", "data_object": "[a.txt"},
+			irods.ErrInvalidArgument},
+		{"quote in collection", parsing.JSON_STAT_OP,
+			map[string]interface{}{"collection": "/zone/o'brien", "data_object": "*.txt"},
+			irods.ErrInvalidArgument},
+		{"glob without access list", parsing.JSON_CHMOD_OP,
+			map[string]interface{}{"collection": "/zone/home", "data_object": "*.txt"},
+			parsing.ErrMissingKey},
+		{"invalid ticket", parsing.JSON_GET_OP,
+			map[string]interface{}{"collection": "/zone/home", "data_object": "a.txt",
+				"ticket": "not a ticket"},
+			irods.ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := captureResults(t)
+			err := runOperation(zerolog.Nop(), nil, test.op, test.target,
+				map[string]interface{}{})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("runOperation() error = %v, want %v", err, test.want)
+			}
+
+			got := decodeResults(t, buf)
+			if len(got) != 1 {
+				t.Fatalf("runOperation() wrote %d results, want 1", len(got))
+			}
+			result := got[0]
+			if result.Success || result.Error == "" || result.Operation != test.op {
+				t.Errorf("result = %+v, want a failed %s with an error", result, test.op)
+			}
+			if result.Collection != test.target["collection"] {
+				t.Errorf("result collection = %q, want %q",
+					result.Collection, test.target["collection"])
+			}
+		})
+	}
+}
+
+func TestPerformOperationRecoversPanic(t *testing.T) {
+	const name = "panic-test"
+	operations[name] = func(logger zerolog.Logger, account *types.IRODSAccount,
+		target map[string]interface{}, args map[string]interface{}) (*irods.OperationResult, error) {
+		coll := target[parsing.JSON_COLLECTION_KEY].(string)
+		if coll == "/zone/bad" {
+			var entries map[string]int
+			entries[coll]++ // Panics on the nil map
+		}
+		return &irods.OperationResult{Operation: name, Collection: coll, Success: true}, nil
+	}
+	t.Cleanup(func() { delete(operations, name) })
+
+	inputs := []map[string]interface{}{
+		{parsing.JSON_COLLECTION_KEY: "/zone/bad"},
+		{parsing.JSON_COLLECTION_KEY: "/zone/good"},
+	}
+	ctx := context.WithValue(context.Background(), jsonKey, inputs)
+	ctx = context.WithValue(ctx, accountKey, &types.IRODSAccount{})
+	cmd := &cobra.Command{}
+	cmd.SetContext(ctx)
+
+	buf := captureResults(t)
+	err := forEachInput(zerolog.Nop(), cmd, func(account *types.IRODSAccount,
+		target map[string]interface{}) error {
+		return runOperation(zerolog.Nop(), account, name, target, map[string]interface{}{})
+	})
+	if !errors.Is(err, irods.ErrOperationPanic) {
+		t.Fatalf("forEachInput() error = %v, want %v", err, irods.ErrOperationPanic)
+	}
+
+	got := decodeResults(t, buf)
+	if len(got) != 2 {
+		t.Fatalf("forEachInput() wrote %d results, want 2", len(got))
+	}
+	if got[0].Success || got[0].Collection != "/zone/bad" ||
+		!strings.Contains(got[0].Error, irods.ErrOperationPanic.Error()) {
+		t.Errorf("first result = %+v, want a failure reporting the panic", got[0])
+	}
+	if !got[1].Success || got[1].Collection != "/zone/good" {
+		t.Errorf("second result = %+v, want the batch to carry on to succeed", got[1])
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/wtsi-npg/go-baton/irods"
+)
+
+// Output formats for operation results.
+const (
+	// outputNDJSON writes each result as a single line of JSON
+	outputNDJSON = "ndjson"
+	// outputArray writes all the results as a single JSON array
+	outputArray = "array"
+)
+
+// Modes for writing results to an output file.
+const (
+	// outputTruncate replaces the file once all the results have been written,
+	// so that a reader never sees it partly written
+	outputTruncate = "truncate"
+	// outputAppend appends each result to the file as it is written
+	outputAppend = "append"
+)
+
+// resultWriter serialises operation results to out in one of the output formats.
+// Stdout is unbuffered, so in NDJSON format each result is written as soon as it
+// is available. In array format, finish must be called after the last result to
+// close the array.
+//
+// If path is set, the results are instead written to that file, in one of the
+// output file modes. The file is opened when the first result is written, or by
+// finish if there are none.
+type resultWriter struct {
+	out    io.Writer
+	format string
+	count  int
+	path   string
+	mode   string
+	file   *os.File
+}
+
+// results writes the results of all the operations of a run to stdout, or to an
+// output file.
+var results = &resultWriter{out: os.Stdout, format: outputNDJSON}
+
+// setOutputFile directs the results to the file at path, written in mode,
+// rather than to stdout. Appending is only possible in NDJSON format, because
+// appending to a JSON array would not give a single JSON document.
+func (w *resultWriter) setOutputFile(path string, mode string) error {
+	if path != "" && mode == outputAppend && w.format == outputArray {
+		return fmt.Errorf("results cannot be appended to %s in %s format",
+			path, outputArray)
+	}
+	w.path = path
+	w.mode = mode
+	return nil
+}
+
+// writeResult writes the result of an operation in the current output format,
+// counting it in the summary.
+func writeResult(result *irods.OperationResult) error {
+	summary.add(result)
+	return results.write(result)
+}
+
+// finishResults completes the output of the results of a run, and writes the
+// summary, returning err or, if there is none, any error completing the output.
+func finishResults(err error) error {
+	ferr := results.finish()
+	if serr := summary.write(); ferr == nil {
+		ferr = serr
+	}
+	if err == nil {
+		return ferr
+	}
+	return err
+}
+
+// write writes one result, which is an operation result or, for commands that
+// report something other than an operation, any value that encodes as JSON.
+func (w *resultWriter) write(result interface{}) error {
+	if err := w.open(); err != nil {
+		return err
+	}
+	if w.format != outputArray {
+		w.count++
+		return json.NewEncoder(w.out).Encode(result)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if w.count == 0 {
+		separator = "[\n"
+	}
+	if _, err = io.WriteString(w.out, separator); err != nil {
+		return err
+	}
+	if _, err = w.out.Write(encoded); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// finish closes the array of results in array format, writing an empty array if
+// there were none, so that the output is always a single JSON document.
+func (w *resultWriter) finish() (err error) {
+	if err = w.open(); err != nil {
+		return err
+	}
+	if w.format == outputArray {
+		if w.count == 0 {
+			_, err = io.WriteString(w.out, "[]\n")
+		} else {
+			_, err = io.WriteString(w.out, "\n]\n")
+		}
+	}
+	return w.close(err)
+}
+
+// open opens the output file, if there is one and it is not already open. In
+// truncate mode, a temporary file is opened alongside it, to be renamed over it
+// by close. It is given the permissions of the file it replaces, if any.
+func (w *resultWriter) open() (err error) {
+	if w.path == "" || w.file != nil {
+		return nil
+	}
+
+	if w.mode == outputAppend {
+		w.file, err = os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	} else {
+		perm := os.FileMode(0644)
+		if info, serr := os.Stat(w.path); serr == nil {
+			perm = info.Mode().Perm()
+		}
+		if w.file, err = os.CreateTemp(filepath.Dir(w.path), "."+filepath.Base(w.path)+".*"); err == nil {
+			err = w.file.Chmod(perm)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open output file %s: %w", w.path, err)
+	}
+	w.out = w.file
+	return nil
+}
+
+// close closes the output file, if there is one. In truncate mode, the
+// temporary file is renamed over the output file unless writing failed with
+// err, in which case it is removed and the output file left as it was.
+func (w *resultWriter) close(err error) error {
+	if w.file == nil {
+		return err
+	}
+
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	if w.mode != outputAppend {
+		if err == nil {
+			err = os.Rename(w.file.Name(), w.path)
+		}
+		if err != nil {
+			os.Remove(w.file.Name())
+		}
+	}
+	w.file = nil
+	return err
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResultWriterWritesReports checks that a report that is not an operation
+// result, such as those of env and ping, is written to the output file in the
+// output format, like any other result.
+func TestResultWriterWritesReports(t *testing.T) {
+	report := map[string]interface{}{"host": "localhost", "ok": true}
+
+	tests := []struct {
+		name   string
+		format string
+		mode   string
+		want   string
+	}{
+		{"ndjson", outputNDJSON, outputTruncate, `{"host":"localhost","ok":true}` + "\n"},
+		{"ndjson appended", outputNDJSON, outputAppend, `{"host":"localhost","ok":true}` + "\n"},
+		{"array", outputArray, outputTruncate, "[\n" + `{"host":"localhost","ok":true}` + "\n]\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results.json")
+			w := &resultWriter{out: os.Stdout, format: test.format}
+			if err := w.setOutputFile(path, test.mode); err != nil {
+				t.Fatalf("setOutputFile() error = %v", err)
+			}
+			if err := w.write(report); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if err := w.finish(); err != nil {
+				t.Fatalf("finish() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("output file %s was not written: %v", path, err)
+			}
+			if string(got) != test.want {
+				t.Errorf("output file contains %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/irods"
+	"golang.org/x/term"
+)
+
+// passwordPrompt returns a function that prompts for the iRODS password at the
+// terminal, or nil if prompting is not possible. That is the case unless stdin
+// is a terminal, and also when stdin carries the JSON input of a command.
+func passwordPrompt(noInput bool) irods.PasswordFunc {
+	if !noInput || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	return func() (string, error) {
+		fmt.Fprint(os.Stderr, "iRODS password: ")
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the iRODS password: %w", err)
+		}
+		return string(password), nil
+	}
+}
+
+// readPassword reads the iRODS password supplied out-of-band from a file or an
+// open file descriptor, so that stdin remains free to carry JSON input. A single
+// trailing newline is removed. The buffer that held the password is zeroed once
+// it has been copied. Descriptor 0 is only accepted when the command reads no
+// JSON input.
+func readPassword(logger zerolog.Logger, file string, fd int, noInput bool) (password string, err error) {
+	var f *os.File
+
+	switch {
+	case file != "":
+		var info os.FileInfo
+		if info, err = os.Stat(file); err != nil {
+			return "", err
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeNamedPipe == 0 {
+			return "", fmt.Errorf("password file %s is not a regular file or pipe: %w",
+				file, irods.ErrInvalidArgument)
+		}
+		if info.Mode().IsRegular() && info.Mode().Perm()&0o077 != 0 {
+			logger.Warn().Msgf("Password file %s is accessible by other users", file)
+		}
+		if f, err = os.Open(file); err != nil {
+			return "", err
+		}
+	case fd == 0 && !noInput:
+		return "", fmt.Errorf("password descriptor 0 is stdin, which carries the JSON input: %w",
+			irods.ErrInvalidArgument)
+	case fd >= 0:
+		if f = os.NewFile(uintptr(fd), "password-fd"); f == nil {
+			return "", fmt.Errorf("invalid password descriptor %d: %w", fd,
+				irods.ErrInvalidArgument)
+		}
+	default:
+		return "", nil
+	}
+
+	defer f.Close()
+
+	buf, err := io.ReadAll(f)
+	defer clear(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the iRODS password: %w", err)
+	}
+
+	trimmed := bytes.TrimSuffix(bytes.TrimSuffix(buf, []byte("\n")), []byte("\r"))
+	if len(trimmed) == 0 {
+		return "", fmt.Errorf("the iRODS password given was empty: %w",
+			irods.ErrInvalidArgument)
+	}
+	return string(trimmed), nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/wtsi-npg/go-baton/irods"
+)
+
+// operationStats are the counts of the results of one or more operations.
+type operationStats struct {
+	Items            int   `json:"items"`
+	Succeeded        int   `json:"succeeded"`
+	Failed           int   `json:"failed"`
+	TransferredBytes int64 `json:"transferred_bytes"`
+}
+
+func (stats *operationStats) add(result *irods.OperationResult) {
+	stats.Items++
+	if result.Success {
+		stats.Succeeded++
+	} else {
+		stats.Failed++
+	}
+	stats.TransferredBytes += result.TransferredBytes
+}
+
+// batchSummary aggregates the results of a run, overall and by operation, for
+// --summary. It is written apart from the results, so that it does not change
+// their format.
+type batchSummary struct {
+	operationStats
+	Duration   float64                    `json:"duration_seconds"`
+	Operations map[string]*operationStats `json:"operations"`
+
+	enabled bool
+	start   time.Time
+	out     io.Writer
+}
+
+// summary aggregates the results of all the operations of a run.
+var summary = &batchSummary{out: os.Stderr}
+
+// startSummary enables the summary and starts timing the run.
+func (s *batchSummary) startSummary() {
+	s.enabled = true
+	s.start = time.Now()
+	s.Operations = make(map[string]*operationStats)
+}
+
+// add counts a result, if the summary is enabled.
+func (s *batchSummary) add(result *irods.OperationResult) {
+	if !s.enabled {
+		return
+	}
+	s.operationStats.add(result)
+	stats, ok := s.Operations[result.Operation]
+	if !ok {
+		stats = &operationStats{}
+		s.Operations[result.Operation] = stats
+	}
+	stats.add(result)
+}
+
+// write writes the summary as a single JSON object, if it is enabled.
+func (s *batchSummary) write() error {
+	if !s.enabled {
+		return nil
+	}
+	s.Duration = time.Since(s.start).Seconds()
+	return json.NewEncoder(s.out).Encode(map[string]interface{}{"summary": s})
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/wtsi-npg/go-baton/irods"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// readMetadataFile returns the metamod inputs described by a table of metadata
+// in file; see parsing.ParseMetadataTable. A file named *.csv is comma-separated
+// and any other tab-separated. The table's AVUs have no operators, so an
+// operation must be given to apply them.
+func readMetadataFile(logger zerolog.Logger, file string, operation string) (
+	inputContents []map[string]interface{}, err error) {
+	if operation == "" {
+		return nil, fmt.Errorf("a metadata file requires the %s argument: %w",
+			parsing.JSON_OP_OPERATION, irods.ErrMissingArgument)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	comma := '\t'
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		comma = ','
+	}
+	if inputContents, err = parsing.ParseMetadataTable(logger, f, comma); err != nil {
+		return nil, fmt.Errorf("metadata file %s: %w", file, err)
+	}
+	return inputContents, nil
+}
+
+// metadataFileCommand wraps the RunE of the metamod subcommand so that, when the
+// input was read from a metadata file, each row is applied even if an earlier
+// one failed. The result of every row is written, a failed row is logged with
+// its number, and an error is returned at the end if any row failed.
+func metadataFileCommand(logger zerolog.Logger, cmd *cobra.Command,
+	flagArgs func() map[string]interface{}) {
+	runE := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if flags.metadataFile == "" {
+			return runE(cmd, args)
+		}
+
+		opArgs := flagArgs()
+		account := cmd.Context().Value(accountKey).(*types.IRODSAccount)
+		rows := cmd.Context().Value(jsonKey).([]map[string]interface{})
+		failed := 0
+		for i, row := range rows {
+			if err := runOperation(logger, account, parsing.JSON_METAMOD_OP, row, opArgs); err != nil {
+				logger.Err(err).Msgf("Failed to apply row %d of %s", i+1, flags.metadataFile)
+				failed++
+			}
+		}
+
+		var err error
+		if failed > 0 {
+			err = fmt.Errorf("failed to apply %d of %d rows of %s",
+				failed, len(rows), flags.metadataFile)
+		}
+		return finishResults(err)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Attributes reports the distinct metadata attributes in use on the data objects
+// in a collection, in name order, along with their number. If recurse is true,
+// the data objects in all its sub-collections are also included. Genquery
+// returns each attribute once, so the server does the work.
+func Attributes(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, recurse bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var conn *connection.IRODSConnection
+	var rows [][]string
+
+	if err = parsing.Validate(parsing.JSON_ATTRIBUTES_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("attributes requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_ATTRIBUTES_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	var scope string
+	if recurse {
+		scope, err = collectionScopeCondition(iPath)
+	} else {
+		scope, err = valueCondition("=", iPath)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_META_DATA_ATTR_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+
+	if rows, err = executeQuery(logger, conn, query); err != nil {
+		return result, err
+	}
+
+	// Selecting the collection gives a row for each collection using an
+	// attribute, so that those out of scope can be dropped
+	seen := make(map[string]bool)
+	attributes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if seen[row[0]] || !inCollectionScope(iPath, row[1]) {
+			continue
+		}
+		seen[row[0]] = true
+		attributes = append(attributes, row[0])
+	}
+	slices.Sort(attributes)
+	logger.Debug().Msgf("Found %d attributes in use in %s", len(attributes), iPath)
+
+	count := len(attributes)
+	result.Count = &count
+	result.Result = attributes
+
+	result.Success = true
+	return result, nil
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// ReplicaChecksum is the checksum recorded for one replica of a data object.
+type ReplicaChecksum struct {
+	Number   int64  `json:"number"`
+	Resource string `json:"resource"`
+	Checksum string `json:"checksum"`
+}
+
+// Checksum reports the checksum registered for a data object.
+//
+// If verify is true, the checksum of every good replica is fetched instead and
+// they are checked to agree. The checksum held by most replicas, or by the
+// lowest numbered of them in a tie, is reported, and any replica that differs
+// from it is listed in the result, before an error wrapping ErrReplicaMismatch is
+// returned. Replicas without a checksum cannot be compared and are left out,
+// as are stale replicas, which are expected to differ.
+//
+// If recompute is true, the server recomputes the checksum from the data, to
+// catch a registered checksum that is missing or stale. The result reports the
+// checksum registered before and the one computed, and whether they match or
+// no checksum was registered. Unless update is true, the catalog is left as it
+// is: a checksum that does not match is an error wrapping ErrChecksumMismatch,
+// and one that is missing cannot be recomputed. If update is true, the computed
+// checksum is registered in place of any before it.
+func Checksum(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, verify bool, recompute bool,
+	update bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+
+	if err = parsing.Validate(parsing.JSON_CHECKSUM_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if verify && recompute {
+		return nil, fmt.Errorf("%s and %s cannot be used together: %w",
+			parsing.JSON_OP_VERIFY, parsing.JSON_OP_FORCE_RECOMPUTE, ErrInvalidArgument)
+	}
+	if update && !recompute {
+		return nil, fmt.Errorf("%s requires %s: %w",
+			parsing.JSON_OP_UPDATE_CATALOG, parsing.JSON_OP_FORCE_RECOMPUTE, ErrInvalidArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if coll {
+		return nil, fmt.Errorf("checksum requires a data object, not collection %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_CHECKSUM_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if verify {
+		if err = verifyReplicas(logger, filesystem, result, iPath); err != nil {
+			return result, err
+		}
+		result.Success = true
+		return result, nil
+	}
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		logger.Err(err).Msgf("Error while stating %s", iPath)
+		return result, err
+	}
+	if len(entry.CheckSum) > 0 {
+		result.Checksum, _ = types.MakeIRODSChecksumString(entry.CheckSumAlgorithm, entry.CheckSum)
+	}
+
+	if recompute {
+		if err = recomputeChecksum(logger, filesystem, result, iPath, update); err != nil {
+			return result, err
+		}
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// verifyReplicas checks that the good replicas of a data object agree on its
+// checksum, recording the checksum and any that differ in the result.
+func verifyReplicas(logger zerolog.Logger, filesystem *fs.FileSystem,
+	result *OperationResult, iPath string) (err error) {
+	var replicas []ReplicaChecksum
+	if replicas, err = replicaChecksums(logger, filesystem, result.Collection,
+		result.DataObject); err != nil {
+		return err
+	}
+	if len(replicas) == 0 {
+		return fmt.Errorf("%s has no good replica with a checksum to verify", iPath)
+	}
+
+	checksum, divergent := verifyReplicaChecksums(replicas)
+	result.Checksum = checksum
+	if len(divergent) > 0 {
+		result.Result = divergent
+		logger.Error().Msgf("%d of %d replicas of %s do not have checksum %s",
+			len(divergent), len(replicas), iPath, checksum)
+		return fmt.Errorf("%d of %d replicas of %s do not have checksum %s: %w",
+			len(divergent), len(replicas), iPath, checksum, ErrReplicaMismatch)
+	}
+	logger.Debug().Msgf("All %d replicas of %s have checksum %s",
+		len(replicas), iPath, checksum)
+
+	return nil
+}
+
+// recomputeChecksum has the server recompute the checksum of a data object,
+// whose registered checksum is already in the result, registering it if update
+// is true. The registered checksum moves to PreviousChecksum, the computed one
+// replaces it, and ChecksumStatus says how they compare.
+func recomputeChecksum(logger zerolog.Logger, filesystem *fs.FileSystem,
+	result *OperationResult, iPath string, update bool) (err error) {
+	var conn *connection.IRODSConnection
+
+	previous := result.Checksum
+	result.PreviousChecksum = previous
+
+	if previous == "" && !update {
+		result.ChecksumStatus = parsing.JSON_CHECKSUM_UNREGISTERED
+		logger.Warn().Msgf("%s has no checksum registered to compare with; "+
+			"use %s to register one", iPath, parsing.JSON_OP_UPDATE_CATALOG)
+		return nil
+	}
+
+	// Forcing registers the computed checksum, while verifying only compares it
+	// with the registered one
+	request := message.NewIRODSMessageChecksumRequest(iPath, "")
+	if update {
+		request.AddKeyVal(common.FORCE_CHKSUM_KW, "")
+	} else {
+		request.AddKeyVal(common.VERIFY_CHKSUM_KW, "")
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	// The response need not carry the checksum when verifying, which
+	// RequestAndCheck would take as an error, so its result is checked here
+	response := message.IRODSMessageChecksumResponse{}
+	if err = conn.Request(request, &response, nil); err == nil && response.Result < 0 {
+		err = types.NewIRODSError(common.ErrorCode(response.Result))
+	}
+	if err != nil {
+		if baseErrorCode(err) == common.USER_CHKSUM_MISMATCH {
+			result.ChecksumStatus = parsing.JSON_CHECKSUM_MISMATCH
+			return fmt.Errorf("the data of %s do not match its checksum %s: %w",
+				iPath, previous, ErrChecksumMismatch)
+		}
+		logger.Err(err).Msgf("Error while computing the checksum of %s", iPath)
+		return err
+	}
+	if response.Checksum != "" {
+		result.Checksum = response.Checksum
+	}
+
+	switch {
+	case previous == "":
+		result.ChecksumStatus = parsing.JSON_CHECKSUM_UNREGISTERED
+		logger.Info().Msgf("Registered checksum %s for %s", result.Checksum, iPath)
+	case previous != result.Checksum:
+		result.ChecksumStatus = parsing.JSON_CHECKSUM_MISMATCH
+		logger.Warn().Msgf("Replaced stale checksum %s of %s with %s",
+			previous, iPath, result.Checksum)
+	default:
+		result.ChecksumStatus = parsing.JSON_CHECKSUM_MATCH
+	}
+
+	return nil
+}
+
+// replicaChecksums returns the checksums of the good replicas of a data object
+// that have one, in replica number order.
+func replicaChecksums(logger zerolog.Logger, filesystem *fs.FileSystem,
+	collName string, dataName string) (replicas []ReplicaChecksum, err error) {
+	var conn *connection.IRODSConnection
+	var collCond, dataCond string
+
+	if collCond, err = valueCondition("=", collName); err != nil {
+		return nil, err
+	}
+	if dataCond, err = valueCondition("=", dataName); err != nil {
+		return nil, err
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return nil, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_DATA_REPL_NUM, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_D_RESC_HIER, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_D_DATA_CHECKSUM, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, collCond)
+	query.AddCondition(common.ICAT_COLUMN_DATA_NAME, dataCond)
+	query.AddCondition(common.ICAT_COLUMN_D_REPL_STATUS,
+		fmt.Sprintf("= '%s'", parsing.VALID_REPLICATE))
+
+	unchecksummed := 0
+	if err = forEachRow(logger, conn, query, func(row []string) error {
+		number, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid replica number '%s' for data object %s/%s: %w",
+				row[0], collName, dataName, err)
+		}
+		if row[2] == "" {
+			unchecksummed++
+			return nil
+		}
+		replicas = append(replicas, ReplicaChecksum{
+			Number:   number,
+			Resource: row[1],
+			Checksum: row[2],
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if unchecksummed > 0 {
+		logger.Warn().Msgf("Skipped %d replicas of %s/%s that have no checksum",
+			unchecksummed, collName, dataName)
+	}
+
+	slices.SortFunc(replicas, func(a, b ReplicaChecksum) int {
+		return cmp.Compare(a.Number, b.Number)
+	})
+	return replicas, nil
+}
+
+// verifyReplicaChecksums returns the checksum held by most of replicas, which
+// are in replica number order, and the replicas that do not have it. In a tie,
+// the checksum of the lowest numbered replica wins.
+func verifyReplicaChecksums(replicas []ReplicaChecksum) (
+	checksum string, divergent []ReplicaChecksum) {
+	counts := make(map[string]int)
+	for _, replica := range replicas {
+		counts[replica.Checksum]++
+	}
+	for _, replica := range replicas {
+		if counts[replica.Checksum] > counts[checksum] {
+			checksum = replica.Checksum
+		}
+	}
+	for _, replica := range replicas {
+		if replica.Checksum != checksum {
+			divergent = append(divergent, replica)
+		}
+	}
+	return checksum, divergent
+}
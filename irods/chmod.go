@@ -18,65 +18,240 @@
 package irods
 
 import (
+	"fmt"
+
 	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
 	"github.com/cyverse/go-irodsclient/irods/connection"
 	irods_fs "github.com/cyverse/go-irodsclient/irods/fs"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
 
-	"github.com/wtsi-npg/go-baton/appInfo"
 	"github.com/wtsi-npg/go-baton/parsing"
 )
 
-func Chmod(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}, recurse bool) (err error) {
-	var iPath, owner, zone string
-	var level types.IRODSAccessLevelType
-	var acls []interface{}
+// ChmodOptions are the options of Chmod.
+type ChmodOptions struct {
+	Recurse  bool   // Also change access to the contents of a collection
+	MaxDepth int    // Levels of a collection tree to change access to
+	Zone     string // Zone of the owners of ACLs without one
+}
+
+// Chmod applies the ACLs of the input to a collection or data object, and with
+// Recurse to the contents of a collection to at most MaxDepth levels below it.
+// An ACL with the null access level revokes its owner's access.
+//
+// The owner of each ACL is looked up in the iRODS catalog before any access is
+// changed, which is an error if it is neither a user nor a group. If an ACL
+// gives the type of its owner, it must match the catalog. The result reports
+// the type of each owner.
+//
+// The owner of an ACL without a zone is in Zone, if that is not empty, so that
+// access may be granted to the users of a federated zone. Otherwise, it is in
+// the zone of the connected server.
+func Chmod(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}, options ChmodOptions) (result *OperationResult, err error) {
+	var iPath string
+	var acls []ACL
 	var coll bool
-	var aclValue map[string]interface{}
 	var conn *connection.IRODSConnection
 
+	if err = parsing.Validate(parsing.JSON_CHMOD_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
 	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
-		return err
+		return nil, err
 	}
 
-	if acls, err = parsing.GetACLList(logger, jsonContents); err != nil {
-		return err
+	if acls, err = parseACLs(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	for i := range acls {
+		if acls[i].Zone == "" {
+			acls[i].Zone = options.Zone
+		}
 	}
 
-	filesystem, err := fs.NewFileSystemWithDefault(account, appInfo.Name)
+	result = newOperationResult(parsing.JSON_CHMOD_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
 	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	// Not locked here; the irods_fs access functions lock the connection themselves
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	if err = resolveACLOwners(logger, conn, acls); err != nil {
+		return result, err
+	}
+
+	for _, acl := range acls {
+		level := types.IRODSAccessLevelType(acl.Level)
+		if coll && options.Recurse && options.MaxDepth != UnlimitedDepth {
+			err = chmodTree(logger, filesystem, conn, iPath, level, acl.Owner, acl.Zone, options.MaxDepth)
+		} else if coll {
+			err = irods_fs.ChangeCollectionAccess(conn, iPath, level, acl.Owner, acl.Zone, options.Recurse, false)
+		} else {
+			err = irods_fs.ChangeDataObjectAccess(conn, iPath, level, acl.Owner, acl.Zone, false)
+		}
+		if err != nil {
+			return result, err
+		}
+		logger.Debug().Msgf("changed permissions on %s for %s to %s", iPath, acl.Owner, level)
+		result.ACLs = append(result.ACLs, acl)
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// parseACLs returns the ACLs described by the access list of the input.
+func parseACLs(logger zerolog.Logger, jsonContents map[string]interface{}) (
+	acls []ACL, err error) {
+	var aclList []interface{}
+
+	if aclList, err = parsing.GetACLList(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	for _, aclInterface := range aclList {
+		var aclValue map[string]interface{}
+		var acl ACL
+		var level types.IRODSAccessLevelType
+
+		if err = parsing.ExtractJSONValue(logger, aclInterface, &aclValue); err != nil {
+			return nil, err
+		}
+		if acl.Owner, level, acl.Zone, err = parsing.GetACLQuery(logger, aclValue); err != nil {
+			return nil, err
+		}
+		if acl.Type, err = parsing.GetACLOwnerType(logger, aclValue); err != nil {
+			return nil, err
+		}
+		acl.Level = string(level)
+		acls = append(acls, acl)
+	}
+	return acls, nil
+}
+
+// setDataObjectACLs applies ACLs to a data object. Changing ACLs requires own
+// permission, which is reported clearly if it is lacking.
+func setDataObjectACLs(logger zerolog.Logger, filesystem *fs.FileSystem,
+	iPath string, acls []ACL) (err error) {
+	var conn *connection.IRODSConnection
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
 		return err
 	}
 
-	defer filesystem.Release()
+	// Not locked here; the irods_fs access functions lock the connection themselves
+	defer filesystem.ReturnMetadataConnection(conn)
 
-	if conn, err = filesystem.GetMetadataConnection(); err != nil {
+	for _, acl := range acls {
+		level := types.IRODSAccessLevelType(acl.Level)
+		if err = irods_fs.ChangeDataObjectAccess(conn, iPath, level, acl.Owner, acl.Zone, false); err != nil {
+			if types.GetIRODSErrorCode(err) == common.CAT_NO_ACCESS_PERMISSION {
+				return fmt.Errorf("own permission on %s is required to set its ACLs: %w",
+					iPath, err)
+			}
+			return err
+		}
+		logger.Debug().Msgf("changed permissions on %s for %s to %s", iPath, acl.Owner, level)
+	}
+	return nil
+}
+
+// chmodTree changes access to a collection and its contents to at most maxDepth
+// levels below it. iRODS can only apply a change to the whole of a tree, so the
+// tree is walked and each member changed individually.
+func chmodTree(logger zerolog.Logger, filesystem *fs.FileSystem,
+	conn *connection.IRODSConnection, iPath string, level types.IRODSAccessLevelType,
+	owner string, zone string, maxDepth int) error {
+	if err := irods_fs.ChangeCollectionAccess(conn, iPath, level, owner, zone, false, false); err != nil {
 		return err
 	}
 
+	return walkCollectionTree(logger, filesystem, iPath, maxDepth, func(entry *fs.Entry, _ string) error {
+		if entry.IsDir() {
+			return irods_fs.ChangeCollectionAccess(conn, entry.Path, level, owner, zone, false, false)
+		}
+		return irods_fs.ChangeDataObjectAccess(conn, entry.Path, level, owner, zone, false)
+	})
+}
+
+// resolveACLOwners looks up the owner of each ACL in the iRODS catalog, setting
+// its type to user or group. Users and groups share a namespace, so an owner
+// name is found as one or the other. An owner in neither, or whose type differs
+// from the one given in its ACL, is an error.
+func resolveACLOwners(logger zerolog.Logger, conn *connection.IRODSConnection,
+	acls []ACL) (err error) {
 	conn.Lock()
 
 	defer conn.Unlock()
 
-	for _, acl := range acls {
-		if err = parsing.ExtractJSONValue(logger, acl, &aclValue); err != nil {
+	for i := range acls {
+		acl := &acls[i]
+		var ownerType string
+		if ownerType, err = aclOwnerType(logger, conn, acl.Owner, acl.Zone); err != nil {
 			return err
 		}
-		if owner, level, zone, err = parsing.GetACLQuery(logger, aclValue); err != nil {
-			return err
+		if acl.Type != "" && acl.Type != ownerType {
+			return fmt.Errorf("ACL owner %s is a %s, not a %s: %w",
+				aclOwnerName(*acl), ownerType, acl.Type, ErrInvalidArgument)
 		}
-		if coll {
-			if err = irods_fs.ChangeCollectionAccess(conn, iPath, level, owner, zone, recurse, false); err != nil {
-				return err
-			}
-		} else {
-			if err = irods_fs.ChangeDataObjectAccess(conn, iPath, level, owner, zone, false); err != nil {
-				return err
-			}
+		acl.Type = ownerType
+		logger.Debug().Msgf("Resolved ACL owner %s as a %s", aclOwnerName(*acl), ownerType)
+	}
+	return nil
+}
+
+// aclOwnerType returns whether an owner is a user or a group, querying the
+// catalog on a locked connection. If zone is empty, the owner may be in any zone.
+func aclOwnerType(logger zerolog.Logger, conn *connection.IRODSConnection,
+	owner string, zone string) (ownerType string, err error) {
+	var rows [][]string
+	var cond string
+
+	query := newQuery()
+	query.AddSelect(common.ICAT_COLUMN_USER_TYPE, selectNormal)
+	if cond, err = valueCondition("=", owner); err != nil {
+		return "", err
+	}
+	query.AddCondition(common.ICAT_COLUMN_USER_NAME, cond)
+	if zone != "" {
+		if cond, err = valueCondition("=", zone); err != nil {
+			return "", err
 		}
-		logger.Debug().Msgf("changed permissions on %s for %s to %s", iPath, owner, level)
+		query.AddCondition(common.ICAT_COLUMN_USER_ZONE, cond)
+	}
 
+	if rows, err = executeQuery(logger, conn, query); err != nil {
+		return "", err
 	}
-	return nil
+	if len(rows) == 0 {
+		return "", fmt.Errorf("ACL owner %s is not a known user or group: %w",
+			aclOwnerName(ACL{Owner: owner, Zone: zone}), ErrInvalidArgument)
+	}
+
+	// A group's user type is rodsgroup; anything else, e.g. rodsadmin, is a user
+	for _, row := range rows {
+		if types.IRODSUserType(row[0]) != types.IRODSUserRodsGroup {
+			return parsing.JSON_USER, nil
+		}
+	}
+	return parsing.JSON_GROUP, nil
+}
+
+// aclOwnerName returns the owner of an ACL, qualified by its zone if it has one.
+func aclOwnerName(acl ACL) string {
+	if acl.Zone == "" {
+		return acl.Owner
+	}
+	return acl.Owner + "#" + acl.Zone
 }
@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+func TestChmodGrantThenRevoke(t *testing.T) {
+	account := testAccount(t)
+	coll := testCollection(t, account)
+	zone := account.ClientZone
+
+	tests := []struct {
+		name  string
+		level interface{}
+		want  types.IRODSAccessLevelType
+	}{
+		{"grant read", "read", types.IRODSAccessLevelReadObject},
+		{"raise to write", "write", types.IRODSAccessLevelModifyObject},
+		{"revoke with null", nil, types.IRODSAccessLevelNull},
+		{"grant read again", "read", types.IRODSAccessLevelReadObject},
+		{"revoke with none", "none", types.IRODSAccessLevelNull},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := map[string]interface{}{
+				"collection": coll,
+				"access": []interface{}{
+					map[string]interface{}{"owner": "public", "level": test.level},
+				},
+			}
+			result, err := Chmod(zerolog.Nop(), account, input, ChmodOptions{})
+			if err != nil {
+				t.Fatalf("Chmod() error = %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Chmod() success = false, want true")
+			}
+			if got := testACLLevel(t, account, coll, "public", zone); got != test.want {
+				t.Errorf("access level of public = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestChmodZonedOwner grants access to an owner given with an explicit zone, as
+// to a user of a federated zone. The local zone stands in for a federated one,
+// since the test server has no federation.
+func TestChmodZonedOwner(t *testing.T) {
+	account := testAccount(t)
+	coll := testCollection(t, account)
+	zone := account.ClientZone
+
+	tests := []struct {
+		name    string
+		acl     map[string]interface{}
+		options ChmodOptions
+		level   types.IRODSAccessLevelType
+	}{
+		{"owner as user#zone",
+			map[string]interface{}{"owner": "public#" + zone, "level": "read"},
+			ChmodOptions{}, types.IRODSAccessLevelReadObject},
+		{"owner with zone key",
+			map[string]interface{}{"owner": "public", "zone": zone, "level": "write"},
+			ChmodOptions{}, types.IRODSAccessLevelModifyObject},
+		{"owner in default zone",
+			map[string]interface{}{"owner": "public", "level": "read"},
+			ChmodOptions{Zone: zone}, types.IRODSAccessLevelReadObject},
+		{"revoke user#zone",
+			map[string]interface{}{"owner": "public#" + zone, "level": "null"},
+			ChmodOptions{}, types.IRODSAccessLevelNull},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := map[string]interface{}{
+				"collection": coll,
+				"access":     []interface{}{test.acl},
+			}
+			result, err := Chmod(zerolog.Nop(), account, input, test.options)
+			if err != nil {
+				t.Fatalf("Chmod() error = %v", err)
+			}
+			if len(result.ACLs) != 1 || result.ACLs[0].Owner != "public" ||
+				result.ACLs[0].Zone != zone {
+				t.Errorf("Chmod() ACLs = %v, want public of zone %s", result.ACLs, zone)
+			}
+			if got := testACLLevel(t, account, coll, "public", zone); got != test.level {
+				t.Errorf("access level of public = %q, want %q", got, test.level)
+			}
+		})
+	}
+}
@@ -27,10 +27,10 @@ import (
 	"github.com/cyverse/go-irodsclient/icommands"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
-	"github.com/wtsi-npg/go-baton/appInfo"
 )
 
 const (
+	IRODSEnvDir         = ".irods"
 	IRODSEnvFileDefault = "~/.irods/irods_environment.json"
 	IRODSEnvFileEnvVar  = "IRODS_ENVIRONMENT_FILE"
 	IRODSPasswordEnvVar = "IRODS_PASSWORD"
@@ -38,7 +38,10 @@ const (
 )
 
 // IRODSEnvFilePath returns the path to the iRODS environment file. If the path
-// is not set in the environment, the default path is returned.
+// is not set in the environment, the default path is returned. A leading '~' is
+// expanded to the user's home directory and a relative path is resolved against
+// the user's ~/.irods directory, rather than the current working directory, so
+// that the same file is used wherever go-baton is run from.
 func IRODSEnvFilePath() string {
 	path := os.Getenv(IRODSEnvFileEnvVar)
 	if path == "" {
@@ -53,17 +56,26 @@ func IRODSEnvFilePath() string {
 	if path[0] == '~' {
 		path = envRoot + path[1:]
 	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(envRoot, IRODSEnvDir, path)
+	}
 
 	return path
 }
 
+// PasswordFunc obtains an iRODS password from the user, e.g. by prompting at a
+// terminal.
+type PasswordFunc func() (string, error)
+
 // NewICommandsEnvironmentManager creates a new environment manager instance.
 //
 // This function creates a manager and sets the iRODS environment file path from the
 // shell environment. If an iRODS auth file is present, the password is read from it.
-// Otherwise, the password is read from the shell environment.
-func NewICommandsEnvironmentManager(logger zerolog.Logger,
-	iRODSEnvFilePath string) (manager *icommands.ICommandsEnvironmentManager, err error) {
+// Otherwise, the password is read from the shell environment or, failing that, from
+// getPassword, if it is not nil. No password is needed when the environment file
+// names the anonymous public user.
+func NewICommandsEnvironmentManager(logger zerolog.Logger, iRODSEnvFilePath string,
+	getPassword PasswordFunc) (manager *icommands.ICommandsEnvironmentManager, err error) {
 	if iRODSEnvFilePath == "" {
 		return nil, fmt.Errorf("iRODS environment file path was empty: %w",
 			ErrInvalidArgument)
@@ -71,8 +83,9 @@ func NewICommandsEnvironmentManager(logger zerolog.Logger,
 
 	// manager.Load() below will succeed even if the iRODS environment file does not
 	// exist, but we absolutely don't want that behaviour here.
+	// Any stat error, not only non-existence, leaves fileInfo nil.
 	var fileInfo os.FileInfo
-	if fileInfo, err = os.Stat(iRODSEnvFilePath); err != nil && os.IsNotExist(err) {
+	if fileInfo, err = os.Stat(iRODSEnvFilePath); err != nil {
 		return nil, err
 	}
 	if fileInfo.IsDir() {
@@ -93,11 +106,33 @@ func NewICommandsEnvironmentManager(logger zerolog.Logger,
 		Str("path", iRODSEnvFilePath).
 		Msg("Loaded iRODS environment file")
 
+	// The public user is anonymous and has no password, so neither an auth file
+	// nor the environment variable is required to connect as it.
+	if manager.Environment.Username == IRODSPublicUser {
+		logger.Info().
+			Str("user", IRODSPublicUser).
+			Msg("Using anonymous access without a password")
+		manager.Password = ""
+		return manager, nil
+	}
+
 	authFilePath := manager.GetPasswordFilePath()
 
 	// An existing auth file takes precedence over the environment variable
 	if _, err = os.Stat(authFilePath); err != nil && os.IsNotExist(err) {
 		password, ok := os.LookupEnv(IRODSPasswordEnvVar)
+		if !ok && getPassword != nil {
+			logger.Debug().Msg("No iRODS auth file or password in the environment; asking for one")
+			if password, err = getPassword(); err != nil {
+				return nil, err
+			}
+			if password == "" {
+				return nil, fmt.Errorf("the iRODS password given was empty: %w",
+					ErrInvalidArgument)
+			}
+			manager.Password = password
+			return manager, nil
+		}
 		if !ok {
 			return nil, fmt.Errorf("iRODS auth file '%s' was not present "+
 				"and the '%s' environment variable needed to create it was not set: %w",
@@ -142,24 +177,61 @@ func NewIRODSAccount(logger zerolog.Logger,
 		Int("hash_rounds", account.SSLConfiguration.HashRounds).
 		Msg("iRODS account created")
 
-	// Before returning the account, check that it is usable by connecting to the
-	// iRODS server and accessing the root collection.
+	return account, err
+}
+
+// HomeCollection returns the path of the account user's home collection.
+func HomeCollection(account *types.IRODSAccount) string {
+	return fmt.Sprintf("/%s/home/%s", account.ClientZone, account.ClientUser)
+}
+
+// VerifyIRODSAccount checks that an account is usable by connecting to the iRODS
+// server and accessing a collection. The probe path defaults to the root
+// collection, while a path of "~" is taken to mean the user's home collection,
+// which is useful for users that cannot read the root collection.
+func VerifyIRODSAccount(logger zerolog.Logger, account *types.IRODSAccount,
+	path string) (err error) {
+	switch path {
+	case "":
+		path = "/"
+	case "~":
+		path = HomeCollection(account)
+	}
+
 	var filesystem *fs.FileSystem
-	filesystem, err = fs.NewFileSystemWithDefault(account, appInfo.Name)
+	filesystem, err = newFileSystem(logger, account)
 	if err != nil {
 		logger.Err(err).Msg("Failed to create an iRODS file system")
-		return nil, err
+		return err
 	}
 
-	var root *fs.Entry
-	root, err = filesystem.StatDir("/")
+	defer releaseFileSystem(filesystem)
+
+	var probe *fs.Entry
+	probe, err = filesystem.StatDir(path)
 	if err != nil {
-		logger.Err(err).Msg("Failed to stat the root zone collection")
-		return nil, err
+		logger.Err(err).Str("path", path).Msg("Failed to stat the probe collection")
+		return err
 	}
 	logger.Debug().
-		Str("path", root.Path).
-		Msg("Root zone collection is accessible")
+		Str("path", probe.Path).
+		Msg("Probe collection is accessible")
 
-	return account, err
+	return nil
+}
+
+// logServerVersion logs the release and API versions that the iRODS server at
+// host reported on connecting, to help diagnose differences in behaviour between
+// server versions. Failing to get them is only a warning.
+func logServerVersion(logger zerolog.Logger, host string, filesystem *fs.FileSystem) {
+	version, err := filesystem.GetServerVersion()
+	if err != nil {
+		logger.Warn().Err(err).Str("host", host).Msg("Failed to get the iRODS server version")
+		return
+	}
+	logger.Info().
+		Str("host", host).
+		Str("server_version", version.ReleaseVersion).
+		Str("api_version", version.APIVersion).
+		Msg("Connected to iRODS server")
 }
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestIRODSEnvFilePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{"unset", "", filepath.Join(home, ".irods", "irods_environment.json")},
+		{"absolute", "/etc/irods/env.json", "/etc/irods/env.json"},
+		{"absolute uncleaned", "/etc/irods/../irods/./env.json", "/etc/irods/env.json"},
+		{"relative", "env.json", filepath.Join(home, ".irods", "env.json")},
+		{"relative subdirectory", "test/env.json", filepath.Join(home, ".irods", "test", "env.json")},
+		{"home", "~/env.json", filepath.Join(home, "env.json")},
+		{"home subdirectory", "~/.irods/test/env.json",
+			filepath.Join(home, ".irods", "test", "env.json")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(IRODSEnvFileEnvVar, test.env)
+			if got := IRODSEnvFilePath(); got != test.want {
+				t.Errorf("IRODSEnvFilePath() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewICommandsEnvironmentManagerStatError(t *testing.T) {
+	t.Run("unreadable parent", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("directory permissions do not apply to root")
+		}
+		dir := filepath.Join(t.TempDir(), "locked")
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		envFile := filepath.Join(dir, "irods_environment.json")
+		if err := os.WriteFile(envFile, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dir, 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = os.Chmod(dir, 0o700) })
+
+		_, err := NewICommandsEnvironmentManager(zerolog.Nop(), envFile, nil)
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("NewICommandsEnvironmentManager() error = %v, want %v", err, fs.ErrPermission)
+		}
+	})
+
+	t.Run("parent is a file", func(t *testing.T) {
+		parent := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(parent, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		envFile := filepath.Join(parent, "irods_environment.json")
+
+		_, err := NewICommandsEnvironmentManager(zerolog.Nop(), envFile, nil)
+		if !errors.Is(err, syscall.ENOTDIR) {
+			t.Errorf("NewICommandsEnvironmentManager() error = %v, want %v", err, syscall.ENOTDIR)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	irods_fs "github.com/cyverse/go-irodsclient/irods/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Copy copies a data object, or with recurse a collection tree, to destination
+// on the server, without the data passing through the client. Unlike a move,
+// the source is left in place. If destination is an existing collection, the
+// copy is made inside it, keeping the source's name.
+//
+// A collection tree is copied to at most maxDepth levels below the source,
+// unless maxDepth is UnlimitedDepth.
+//
+// If preserve is true, the metadata and ACLs of each copied data object and
+// collection are also applied to its copy.
+//
+// An existing data object at the destination of a copy is an error, unless
+// overwrite is true, when it is replaced.
+func Copy(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, destination string, recurse bool,
+	maxDepth int, preserve bool, overwrite bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+
+	if err = parsing.Validate(parsing.JSON_COPY_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if destination == "" {
+		return nil, fmt.Errorf("copy requires a destination %s argument: %w",
+			parsing.JSON_OP_PATH, ErrMissingArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_COPY_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return result, err
+	}
+	if filesystem.ExistsDir(destination) {
+		destination = path.Join(destination, entry.Name)
+	}
+	result.Destination = destination
+
+	logger.Info().Msgf("Copying %s to %s", iPath, destination)
+
+	if entry.IsDir() {
+		if !recurse {
+			return result, fmt.Errorf("%s is a collection and recurse was not set: %w",
+				iPath, ErrInvalidArgument)
+		}
+		err = copyCollection(logger, filesystem, iPath, destination, maxDepth, preserve, overwrite, result)
+	} else {
+		err = copyDataObject(logger, filesystem, iPath, destination, preserve, overwrite, result)
+	}
+	logger.Info().Msgf("Copied %d data objects", result.Transferred)
+	if err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// copyDataObject copies a single data object, refusing to overwrite an
+// existing one unless overwrite is true.
+func copyDataObject(logger zerolog.Logger, filesystem *fs.FileSystem, src string,
+	dest string, preserve bool, overwrite bool, result *OperationResult) (err error) {
+	if err = filesystem.CopyFileToFile(src, dest, overwrite); err != nil {
+		return err
+	}
+	logger.Debug().Msgf("Copied %s to %s", src, dest)
+	result.Transferred++
+
+	if preserve {
+		return copyAnnotations(logger, filesystem, src, dest, false)
+	}
+	return nil
+}
+
+// copyCollection copies a collection tree, to at most maxDepth levels below src,
+// creating a collection at dest to mirror src and each of its sub-collections.
+func copyCollection(logger zerolog.Logger, filesystem *fs.FileSystem, src string,
+	dest string, maxDepth int, preserve bool, overwrite bool, result *OperationResult) (err error) {
+	if err = filesystem.MakeDir(dest, true); err != nil {
+		return err
+	}
+	if preserve {
+		if err = copyAnnotations(logger, filesystem, src, dest, true); err != nil {
+			return err
+		}
+	}
+
+	return walkCollectionTree(logger, filesystem, src, maxDepth, func(entry *fs.Entry, relPath string) error {
+		target := path.Join(dest, relPath)
+		if !entry.IsDir() {
+			return copyDataObject(logger, filesystem, entry.Path, target, preserve, overwrite, result)
+		}
+
+		logger.Debug().Msgf("Creating collection %s", target)
+		if err := filesystem.MakeDir(target, true); err != nil {
+			return err
+		}
+		if preserve {
+			return copyAnnotations(logger, filesystem, entry.Path, target, true)
+		}
+		return nil
+	})
+}
+
+// copyAnnotations applies the metadata and ACLs of src to dest.
+func copyAnnotations(logger zerolog.Logger, filesystem *fs.FileSystem, src string,
+	dest string, coll bool) (err error) {
+	var metas []*types.IRODSMeta
+	var accesses []*types.IRODSAccess
+	var conn *connection.IRODSConnection
+
+	if metas, err = filesystem.ListMetadata(src); err != nil {
+		return err
+	}
+	for _, meta := range metas {
+		if err = filesystem.AddMetadata(dest, meta.Name, meta.Value, meta.Units); err != nil {
+			return err
+		}
+	}
+
+	if accesses, err = filesystem.ListACLs(src); err != nil {
+		return err
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	// Not locked here; the irods_fs access functions lock the connection themselves
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	for _, access := range accesses {
+		if coll {
+			err = irods_fs.ChangeCollectionAccess(conn, dest, access.AccessLevel,
+				access.UserName, access.UserZone, false, false)
+		} else {
+			err = irods_fs.ChangeDataObjectAccess(conn, dest, access.AccessLevel,
+				access.UserName, access.UserZone, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	logger.Debug().Msgf("Copied %d AVUs and %d ACLs from %s to %s",
+		len(metas), len(accesses), src, dest)
+
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// DuplicateGroup is a set of data objects sharing a checksum and size, which are
+// likely to hold the same data.
+type DuplicateGroup struct {
+	Checksum    string      `json:"checksum"`
+	Size        int64       `json:"size"`
+	DataObjects []ListEntry `json:"data_objects"`
+}
+
+// duplicateKey identifies the data objects that may be duplicates of each other.
+type duplicateKey struct {
+	checksum string
+	size     int64
+}
+
+// Duplicates reports the data objects in a collection and all its
+// sub-collections that share a checksum and size with another, grouped by
+// checksum and size. Only good replicas are considered, and data objects
+// without a checksum cannot be compared and are left out.
+//
+// The groups are reported largest size first, so that those holding the most
+// storage come first, along with the number of groups.
+func Duplicates(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var conn *connection.IRODSConnection
+	var scope string
+
+	if err = parsing.Validate(parsing.JSON_DUPLICATES_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("duplicates requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	if scope, err = collectionScopeCondition(iPath); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_DUPLICATES_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_DATA_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_D_DATA_CHECKSUM, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_DATA_SIZE, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+	query.AddCondition(common.ICAT_COLUMN_D_REPL_STATUS,
+		fmt.Sprintf("= '%s'", parsing.VALID_REPLICATE))
+
+	// Replicas with the same checksum and size give identical rows, which
+	// genquery returns once; seen guards against counting a data object twice
+	// when its good replicas differ.
+	groups := make(map[duplicateKey][]ListEntry)
+	seen := make(map[string]bool)
+	unchecksummed := 0
+
+	if err = forEachRow(logger, conn, query, func(row []string) error {
+		collName, dataName, checksum := row[0], row[1], row[2]
+		if !inCollectionScope(iPath, collName) {
+			return nil
+		}
+		size, err := strconv.ParseInt(row[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size '%s' for data object %s: %w",
+				row[3], path.Join(collName, dataName), err)
+		}
+		if checksum == "" {
+			unchecksummed++
+			return nil
+		}
+		objPath := path.Join(collName, dataName)
+		if seen[objPath] {
+			return nil
+		}
+		seen[objPath] = true
+
+		key := duplicateKey{checksum: checksum, size: size}
+		groups[key] = append(groups[key], ListEntry{Collection: collName, DataObject: dataName})
+		return nil
+	}); err != nil {
+		return result, err
+	}
+	if unchecksummed > 0 {
+		logger.Warn().Msgf("Skipped %d replicas in %s that have no checksum",
+			unchecksummed, iPath)
+	}
+
+	duplicates := []DuplicateGroup{}
+	for key, entries := range groups {
+		if len(entries) < 2 {
+			continue
+		}
+		slices.SortFunc(entries, func(a, b ListEntry) int {
+			return cmp.Or(cmp.Compare(a.Collection, b.Collection),
+				cmp.Compare(a.DataObject, b.DataObject))
+		})
+		duplicates = append(duplicates, DuplicateGroup{
+			Checksum:    key.checksum,
+			Size:        key.size,
+			DataObjects: entries,
+		})
+	}
+	slices.SortFunc(duplicates, func(a, b DuplicateGroup) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Checksum, b.Checksum))
+	})
+	logger.Info().Msgf("Found %d groups of duplicate data objects in %s",
+		len(duplicates), iPath)
+
+	groupCount := len(duplicates)
+	result.Count = &groupCount
+	result.Result = duplicates
+
+	result.Success = true
+	return result, nil
+}
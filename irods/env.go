@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"github.com/cyverse/go-irodsclient/icommands"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// Env returns the details of the iRODS account in use, and the environment it was
+// created from, to be written as JSON. It does not contact the server and never
+// includes the password.
+func Env(logger zerolog.Logger, manager *icommands.ICommandsEnvironmentManager,
+	account *types.IRODSAccount) (jsonOut map[string]interface{}) {
+	jsonOut = map[string]interface{}{
+		"host":                account.Host,
+		"port":                account.Port,
+		"zone":                account.ClientZone,
+		"user":                account.ClientUser,
+		"env_file":            manager.GetEnvironmentFilePath(),
+		"auth_file":           manager.GetPasswordFilePath(),
+		"auth_scheme":         string(account.AuthenticationScheme),
+		"cs_neg_required":     account.ClientServerNegotiation,
+		"cs_neg_policy":       string(account.CSNegotiationPolicy),
+		"default_resource":    account.DefaultResource,
+		"default_hash_scheme": account.DefaultHashScheme,
+		"skip_verify_tls":     account.SkipVerifyTLS,
+	}
+	if account.SSLConfiguration != nil {
+		jsonOut["ca_cert_path"] = account.SSLConfiguration.CACertificatePath
+		jsonOut["ca_cert_file"] = account.SSLConfiguration.CACertificateFile
+		jsonOut["enc_alg"] = account.SSLConfiguration.EncryptionAlgorithm
+		jsonOut["key_size"] = account.SSLConfiguration.EncryptionKeySize
+		jsonOut["salt_size"] = account.SSLConfiguration.SaltSize
+		jsonOut["hash_rounds"] = account.SSLConfiguration.HashRounds
+	}
+
+	logger.Debug().Msg("Reporting iRODS environment")
+
+	return jsonOut
+}
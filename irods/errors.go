@@ -22,10 +22,80 @@ package irods
 import (
 	"errors"
 	"fmt"
+	"os"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
 )
 
 var (
 	ErrArgument        = errors.New("argument error")
 	ErrMissingArgument = fmt.Errorf("%w: missing argument", ErrArgument)
 	ErrInvalidArgument = fmt.Errorf("%w: invalid argument", ErrArgument)
+
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrReplicaMismatch  = errors.New("replica checksum mismatch")
+	ErrMissingChecksum  = errors.New("missing checksum")
+
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrNotFound         = errors.New("not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidTicket    = fmt.Errorf("invalid or expired ticket: %w", ErrPermissionDenied)
+
+	ErrLocalPathNotFound    = fmt.Errorf("local path %w", ErrNotFound)
+	ErrLocalPathNotReadable = fmt.Errorf("local path not readable: %w", ErrPermissionDenied)
+	ErrObjectTooLarge       = errors.New("object too large")
+
+	ErrOperationTimeout        = errors.New("operation timed out")
+	ErrConnectionPoolExhausted = errors.New("connection pool exhausted")
+	ErrOperationPanic          = errors.New("operation panicked")
 )
+
+// notFoundCodes are the iRODS error codes reporting that a path does not exist.
+var notFoundCodes = map[common.ErrorCode]bool{
+	common.CAT_NO_ROWS_FOUND:        true,
+	common.CAT_UNKNOWN_COLLECTION:   true,
+	common.CAT_UNKNOWN_FILE:         true,
+	common.OBJ_PATH_DOES_NOT_EXIST:  true,
+	common.USER_FILE_DOES_NOT_EXIST: true,
+}
+
+// permissionDeniedCodes are the iRODS error codes reporting that the user may
+// not access a path.
+var permissionDeniedCodes = map[common.ErrorCode]bool{
+	common.CAT_NO_ACCESS_PERMISSION:         true,
+	common.CAT_INSUFFICIENT_PRIVILEGE_LEVEL: true,
+	common.SYS_NO_API_PRIV:                  true,
+}
+
+// baseErrorCode returns the iRODS error code of err, or 0 if it has none. iRODS
+// adds any errno of the underlying failure to the last three digits of a code,
+// which are dropped so that the code may be compared with the common constants.
+func baseErrorCode(err error) common.ErrorCode {
+	code := types.GetIRODSErrorCode(err)
+	return code - code%1000
+}
+
+// classifyError returns err wrapped with ErrNotFound if it reports that a path,
+// in iRODS or locally, does not exist, or with ErrPermissionDenied if it reports
+// that access to one was denied. An error reporting that a ticket was refused is
+// wrapped with ErrInvalidTicket, which is a kind of ErrPermissionDenied. Any
+// other error is returned unchanged.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrPermissionDenied) {
+		return err
+	}
+
+	code := baseErrorCode(err)
+
+	switch {
+	case ticketCodes[code]:
+		return fmt.Errorf("%w: %w", err, ErrInvalidTicket)
+	case types.IsFileNotFoundError(err), errors.Is(err, os.ErrNotExist), notFoundCodes[code]:
+		return fmt.Errorf("%w: %w", err, ErrNotFound)
+	case errors.Is(err, os.ErrPermission), permissionDeniedCodes[code]:
+		return fmt.Errorf("%w: %w", err, ErrPermissionDenied)
+	default:
+		return err
+	}
+}
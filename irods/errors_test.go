@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func TestBaseErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want common.ErrorCode
+	}{
+		{errors.New("not an iRODS error"), 0},
+		{types.NewIRODSError(common.CAT_NAME_EXISTS_AS_COLLECTION), common.CAT_NAME_EXISTS_AS_COLLECTION},
+		{types.NewIRODSError(common.CAT_NAME_EXISTS_AS_COLLECTION - 2), common.CAT_NAME_EXISTS_AS_COLLECTION},
+		{types.NewIRODSError(common.USER_CHKSUM_MISMATCH - 999), common.USER_CHKSUM_MISMATCH},
+	}
+	for _, test := range tests {
+		if got := baseErrorCode(test.err); got != test.want {
+			t.Errorf("baseErrorCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want []error
+		not  []error
+	}{
+		{"nil", nil, nil, nil},
+		{"no rows", types.NewIRODSError(common.CAT_NO_ROWS_FOUND),
+			[]error{ErrNotFound}, []error{ErrPermissionDenied}},
+		{"unknown collection", types.NewIRODSError(common.CAT_UNKNOWN_COLLECTION),
+			[]error{ErrNotFound}, []error{ErrPermissionDenied}},
+		{"unknown file", types.NewIRODSError(common.CAT_UNKNOWN_FILE),
+			[]error{ErrNotFound}, nil},
+		{"no object path", types.NewIRODSError(common.OBJ_PATH_DOES_NOT_EXIST),
+			[]error{ErrNotFound}, nil},
+		{"no user file with errno", types.NewIRODSError(common.USER_FILE_DOES_NOT_EXIST - 2),
+			[]error{ErrNotFound}, nil},
+		{"client file not found", types.NewFileNotFoundError("/zone/a"),
+			[]error{ErrNotFound}, nil},
+		{"local not found", os.ErrNotExist, []error{ErrNotFound}, nil},
+		{"no access", types.NewIRODSError(common.CAT_NO_ACCESS_PERMISSION),
+			[]error{ErrPermissionDenied}, []error{ErrNotFound, ErrInvalidTicket}},
+		{"insufficient privilege", types.NewIRODSError(common.CAT_INSUFFICIENT_PRIVILEGE_LEVEL),
+			[]error{ErrPermissionDenied}, nil},
+		{"no API privilege", types.NewIRODSError(common.SYS_NO_API_PRIV),
+			[]error{ErrPermissionDenied}, nil},
+		{"local permission", os.ErrPermission, []error{ErrPermissionDenied}, nil},
+		{"ticket expired", types.NewIRODSError(common.CAT_TICKET_EXPIRED),
+			[]error{ErrInvalidTicket, ErrPermissionDenied}, []error{ErrNotFound}},
+		{"ticket invalid", types.NewIRODSError(common.CAT_TICKET_INVALID),
+			[]error{ErrInvalidTicket, ErrPermissionDenied}, nil},
+		{"other", types.NewIRODSError(common.CAT_SQL_ERR),
+			nil, []error{ErrNotFound, ErrPermissionDenied}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyError(test.err)
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("classifyError(%v) = %v, which does not wrap the original", test.err, err)
+			}
+			for _, want := range test.want {
+				if !errors.Is(err, want) {
+					t.Errorf("classifyError(%v) = %v, want it to wrap %v", test.err, err, want)
+				}
+			}
+			for _, not := range test.not {
+				if errors.Is(err, not) {
+					t.Errorf("classifyError(%v) = %v, want it not to wrap %v", test.err, err, not)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyErrorOnce(t *testing.T) {
+	err := classifyError(types.NewIRODSError(common.CAT_NO_ROWS_FOUND))
+	if again := classifyError(err); again != err {
+		t.Errorf("classifyError of a classified error = %v, want %v unchanged", again, err)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathFilter selects the files transferred by a recursive put or get using glob
+// patterns in the syntax of path.Match.
+//
+// As with rsync, a pattern containing a '/' is matched against the path of a file
+// relative to the root of the transfer, while any other pattern is matched against
+// the file's name alone. A file is excluded if it matches any Exclude pattern,
+// unless it also matches an Include pattern, which takes precedence. Patterns
+// apply to files only; directories and collections are always traversed.
+type PathFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate checks that all the patterns of a filter are well-formed.
+func (filter PathFilter) Validate() error {
+	for _, pattern := range append(filter.Include, filter.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid filter pattern '%s': %w", pattern,
+				ErrInvalidArgument)
+		}
+	}
+	return nil
+}
+
+// Excludes returns true if the file at relPath, relative to the root of a
+// transfer, should not be transferred.
+func (filter PathFilter) Excludes(relPath string) bool {
+	return matchesAny(filter.Exclude, relPath) && !matchesAny(filter.Include, relPath)
+}
+
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(relPath)
+		if strings.Contains(pattern, "/") {
+			name = strings.TrimPrefix(relPath, "/")
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPathFilterExcludes(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  PathFilter
+		relPath string
+		want    bool
+	}{
+		{"no patterns", PathFilter{}, "a/b.txt", false},
+		{"include only", PathFilter{Include: []string{"*.txt"}}, "a/b.csv", false},
+		{"exclude by name", PathFilter{Exclude: []string{"*.tmp"}}, "a/b.tmp", true},
+		{"exclude not matching", PathFilter{Exclude: []string{"*.tmp"}}, "a/b.txt", false},
+		{"include overrides exclude",
+			PathFilter{Include: []string{"keep.tmp"}, Exclude: []string{"*.tmp"}},
+			"a/keep.tmp", false},
+		{"include of another file does not override",
+			PathFilter{Include: []string{"keep.tmp"}, Exclude: []string{"*.tmp"}},
+			"a/drop.tmp", true},
+		{"same pattern in both includes",
+			PathFilter{Include: []string{"*.tmp"}, Exclude: []string{"*.tmp"}},
+			"a/b.tmp", false},
+		{"exclude by relative path",
+			PathFilter{Exclude: []string{"a/*.txt"}}, "a/b.txt", true},
+		{"relative path pattern does not match deeper",
+			PathFilter{Exclude: []string{"a/*.txt"}}, "x/a/b.txt", false},
+		{"leading slash anchors at root",
+			PathFilter{Exclude: []string{"/a/*.txt"}}, "a/b.txt", true},
+		{"name pattern matches at any depth",
+			PathFilter{Exclude: []string{"*.txt"}}, "x/y/z/b.txt", true},
+		{"include by path overrides exclude by name",
+			PathFilter{Include: []string{"a/b.tmp"}, Exclude: []string{"*.tmp"}},
+			"a/b.tmp", false},
+		{"include by name overrides exclude by path",
+			PathFilter{Include: []string{"b.tmp"}, Exclude: []string{"a/*"}},
+			"a/b.tmp", false},
+		{"name pattern does not match directory",
+			PathFilter{Exclude: []string{"a"}}, "a/b.txt", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.Excludes(test.relPath); got != test.want {
+				t.Errorf("%+v.Excludes(%q) = %v, want %v",
+					test.filter, test.relPath, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPathFilterValidate(t *testing.T) {
+	if err := (PathFilter{Include: []string{"*.txt"}, Exclude: []string{"a/[bc]"}}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want none", err)
+	}
+	if err := (PathFilter{Exclude: []string{"[a"}}).Validate(); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrInvalidArgument)
+	}
+}
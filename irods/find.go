@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Find lists the data objects in a collection that have all the AVUs of the
+// input, which are given as for MetaQuery. If recurse is true, data objects in
+// all its sub-collections are also listed. The path and metadata conditions are
+// combined in a single query, so the server does the filtering.
+//
+// The matches are reported under contents, in path order, in the shape of
+// baton-list. Their sizes and checksums are reported if size and checksum are
+// true, respectively, taken from a good replica of each.
+func Find(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, recurse bool, size bool,
+	checksum bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var avus []interface{}
+	var query *message.IRODSMessageQueryRequest
+	var conn *connection.IRODSConnection
+
+	if err = parsing.Validate(parsing.JSON_FIND_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("find requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+	if avus, err = parsing.GetAVUsList(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_FIND_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	columns := parsing.MetaQueryColumns{
+		AttributeCondition: common.ICAT_COLUMN_META_DATA_ATTR_NAME,
+		ValueCondition:     common.ICAT_COLUMN_META_DATA_ATTR_VALUE,
+		UnitsCondition:     common.ICAT_COLUMN_META_DATA_ATTR_UNITS,
+		ReturnColumns: []common.ICATColumnNumber{common.ICAT_COLUMN_COLL_NAME,
+			common.ICAT_COLUMN_DATA_NAME},
+	}
+	if query, err = BuildMetaQuery(logger, avus, columns,
+		conn.GetAccount().ClientZone, nil, false); err != nil {
+		return result, err
+	}
+	if size || checksum {
+		query.AddSelect(common.ICAT_COLUMN_DATA_SIZE, selectNormal)
+		query.AddSelect(common.ICAT_COLUMN_D_DATA_CHECKSUM, selectNormal)
+		query.AddCondition(common.ICAT_COLUMN_D_REPL_STATUS,
+			fmt.Sprintf("= '%s'", parsing.VALID_REPLICATE))
+	}
+
+	var scope string
+	if recurse {
+		scope, err = collectionScopeCondition(iPath)
+	} else {
+		scope, err = valueCondition("=", iPath)
+	}
+	if err != nil {
+		return result, err
+	}
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+
+	// Good replicas that differ in size or checksum give a row each; seen
+	// guards against listing a data object twice.
+	members := []ListEntry{}
+	seen := make(map[string]bool)
+
+	if err = forEachRow(logger, conn, query, func(row []string) error {
+		collName, dataName := row[0], row[1]
+		if !inCollectionScope(iPath, collName) {
+			return nil
+		}
+		objPath := path.Join(collName, dataName)
+		if seen[objPath] {
+			return nil
+		}
+		seen[objPath] = true
+
+		entry := ListEntry{Collection: collName, DataObject: dataName}
+		if size {
+			s, err := strconv.ParseInt(row[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid size '%s' for data object %s: %w",
+					row[2], objPath, err)
+			}
+			entry.Size = &s
+		}
+		if checksum {
+			entry.Checksum = row[3]
+		}
+		members = append(members, entry)
+		return nil
+	}); err != nil {
+		return result, err
+	}
+
+	slices.SortFunc(members, func(a, b ListEntry) int {
+		return cmp.Or(cmp.Compare(a.Collection, b.Collection),
+			cmp.Compare(a.DataObject, b.DataObject))
+	})
+	logger.Info().Msgf("Found %d data objects in %s with metadata: %s",
+		len(members), iPath, avus)
+
+	result.Contents = &members
+
+	result.Success = true
+	return result, nil
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// Genquery select options, from the iRODS rodsGenQuery.h header. These are not
+// provided by go-irodsclient.
+const (
+	selectNormal = 1
+	selectMax    = 3
+)
+
+// Genquery query options, from the iRODS rodsGenQuery.h header. These are not
+// provided by go-irodsclient.
+const (
+	// upperCaseWhere makes the server compare the upper case form of each column
+	// in the conditions, so the condition values must be upper case too
+	upperCaseWhere = 0x200
+)
+
+// Genquery columns, from the iRODS rodsGenQuery.h header, that are not provided
+// by go-irodsclient.
+const (
+	colZoneName common.ICATColumnNumber = 102
+)
+
+// queryKeywords are the genquery keywords that may be given in the input, beyond
+// those go-baton sets itself. Any other is rejected, so that a keyword with an
+// unexpected effect cannot be passed to the server; the zone is set only from the
+// zone argument. The server checks the user's privileges for admin queries.
+var queryKeywords = map[common.KeyWord]bool{
+	common.ADMIN_KW: true,
+}
+
+// DefaultQueryPageSize is the number of rows requested in each page of genquery
+// results unless SetQueryPageSize is called; it is the most the server allows.
+const DefaultQueryPageSize = common.MaxQueryRows
+
+// queryPageSize is the number of rows requested in each page of genquery results.
+var queryPageSize = DefaultQueryPageSize
+
+// SetQueryPageSize sets the number of rows requested in each page of genquery
+// results. Smaller pages mean more requests, but less work for the server and
+// less memory for the client at a time. The size must be between 1 and
+// DefaultQueryPageSize.
+func SetQueryPageSize(size int) error {
+	if size < 1 || size > common.MaxQueryRows {
+		return fmt.Errorf("query page size %d is not between 1 and %d: %w",
+			size, common.MaxQueryRows, ErrInvalidArgument)
+	}
+	queryPageSize = size
+	return nil
+}
+
+// newQuery returns an empty genquery request for pages of queryPageSize rows.
+func newQuery() *message.IRODSMessageQueryRequest {
+	return message.NewIRODSMessageQueryRequest(queryPageSize, 0, 0, 0)
+}
+
+// checkQueryKeywords returns an error if any of keywords is not in queryKeywords.
+func checkQueryKeywords(keywords map[string]string) error {
+	for name := range keywords {
+		if !queryKeywords[common.KeyWord(name)] {
+			return fmt.Errorf("genquery keyword '%s' is not allowed: %w",
+				name, ErrInvalidArgument)
+		}
+	}
+	return nil
+}
+
+// addQueryKeywords adds keywords to a genquery, in name order, rejecting any that
+// are not in queryKeywords.
+func addQueryKeywords(query *message.IRODSMessageQueryRequest,
+	keywords map[string]string) error {
+	if err := checkQueryKeywords(keywords); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		query.AddKeyVal(common.KeyWord(name), keywords[name])
+	}
+	return nil
+}
+
+// executeQuery runs a genquery on a locked connection, following continuations
+// to collect every page of results. Each row holds the values of the selected
+// columns in the order they were selected. A query matching nothing returns no
+// rows rather than an error.
+func executeQuery(logger zerolog.Logger, conn *connection.IRODSConnection,
+	query *message.IRODSMessageQueryRequest) (rows [][]string, err error) {
+	err = forEachRow(logger, conn, query, func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// queryConnection is a connection on which genqueries are run.
+type queryConnection interface {
+	Request(request connection.Request, response connection.Response, bsBuffer []byte) error
+}
+
+// forEachRow runs a genquery on a locked connection, following continuations
+// and calling fn for each row of every page of results, without retaining them.
+// If it returns early, with an error from fn or the server, while the server
+// holds more results, the query is closed so that its statement is not left
+// open on the connection.
+func forEachRow(logger zerolog.Logger, conn queryConnection,
+	query *message.IRODSMessageQueryRequest, fn func(row []string) error) (err error) {
+	var total int
+	var open int // Continuation of the results not yet read, if any
+
+	defer func() {
+		if err != nil && open != 0 {
+			closeQuery(logger, conn, query, open)
+		}
+	}()
+
+	for {
+		queryResult := message.IRODSMessageQueryResponse{}
+		if err = conn.Request(query, &queryResult, nil); err != nil {
+			if types.GetIRODSErrorCode(err) == common.CAT_NO_ROWS_FOUND {
+				return nil
+			}
+			logger.Err(err).Msg("Error while querying iRODS")
+			return err
+		}
+
+		if err = queryResult.CheckError(); err != nil {
+			if types.GetIRODSErrorCode(err) == common.CAT_NO_ROWS_FOUND {
+				return nil
+			}
+			logger.Err(err).Msg("Error while querying iRODS")
+			return err
+		}
+		open = queryResult.ContinueIndex
+
+		if queryResult.AttributeCount > len(queryResult.SQLResult) {
+			return fmt.Errorf("query returned %d of %d columns",
+				len(queryResult.SQLResult), queryResult.AttributeCount)
+		}
+
+		for i := 0; i < queryResult.RowCount; i++ {
+			row := make([]string, queryResult.AttributeCount)
+			for j := 0; j < queryResult.AttributeCount; j++ {
+				row[j] = queryResult.SQLResult[j].Values[i]
+			}
+			if err = fn(row); err != nil {
+				return err
+			}
+		}
+		total += queryResult.RowCount
+
+		logger.Trace().Msgf("Query returned %d rows, %d in total",
+			queryResult.RowCount, total)
+
+		if queryResult.ContinueIndex == 0 {
+			return nil
+		}
+		query.ContinueIndex = queryResult.ContinueIndex
+	}
+}
+
+// closeQuery closes a query whose results have not all been read, by asking for
+// none of the rest, which frees its statement on the server. Failing to close
+// it is only a warning, since the query has already failed.
+func closeQuery(logger zerolog.Logger, conn queryConnection,
+	query *message.IRODSMessageQueryRequest, continueIndex int) {
+	closing := *query
+	closing.ContinueIndex = continueIndex
+	closing.MaxRows = 0
+
+	queryResult := message.IRODSMessageQueryResponse{}
+	err := conn.Request(&closing, &queryResult, nil)
+	if err == nil {
+		err = queryResult.CheckError()
+	}
+	if err != nil && types.GetIRODSErrorCode(err) != common.CAT_NO_ROWS_FOUND {
+		logger.Warn().Err(err).Msg("Failed to close an unfinished query")
+	}
+}
+
+// collectionScopeCondition returns a genquery condition on COLL_NAME matching a
+// collection and every collection beneath it. The underscore and percent sign
+// are wildcards in a like condition, so where path contains them the condition
+// also matches sibling collections; callers must select COLL_NAME and keep only
+// the rows for which inCollectionScope is true. As for valueCondition, a path
+// containing a single quote is rejected.
+func collectionScopeCondition(path string) (string, error) {
+	if strings.ContainsRune(path, '\'') {
+		return "", fmt.Errorf("collection '%s' contains a single quote: %w",
+			path, ErrInvalidArgument)
+	}
+	if path == "/" {
+		return "like '/%'", nil
+	}
+	return fmt.Sprintf("= '%s' || like '%s/%%'", path, path), nil
+}
+
+// inCollectionScope returns true if collection coll is root or lies beneath it.
+func inCollectionScope(root string, coll string) bool {
+	return coll == root || strings.HasPrefix(coll, strings.TrimSuffix(root, "/")+"/")
+}
+
+// valueCondition returns a genquery condition comparing a column with value
+// using op, which defaults to equality. The value is quoted, so it may contain
+// spaces and genquery keywords. Genquery has no escape for the single quote
+// that delimits a value, so a value containing one is rejected rather than
+// being allowed to produce a condition that matches something else.
+func valueCondition(op string, value string) (string, error) {
+	if strings.ContainsRune(value, '\'') {
+		return "", fmt.Errorf("genquery value '%s' contains a single quote: %w",
+			value, ErrInvalidArgument)
+	}
+	if op == "" {
+		op = "="
+	}
+	return fmt.Sprintf("%s '%s'", op, value), nil
+}
+
+// listZones returns the names of all the zones known to the server, including
+// federated zones, using a locked connection.
+func listZones(logger zerolog.Logger, conn *connection.IRODSConnection) (
+	zones []string, err error) {
+	var rows [][]string
+
+	query := newQuery()
+	query.AddSelect(colZoneName, selectNormal)
+
+	if rows, err = executeQuery(logger, conn, query); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		zones = append(zones, row[0])
+	}
+	logger.Debug().Msgf("Found zones %v", zones)
+
+	return zones, nil
+}
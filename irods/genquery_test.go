@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/rs/zerolog"
+)
+
+func TestCollectionScopeCondition(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{"/", "like '/%'", nil},
+		{"/zone/proj", "= '/zone/proj' || like '/zone/proj/%'", nil},
+		{"/zone/proj_1", "= '/zone/proj_1' || like '/zone/proj_1/%'", nil},
+		{"/zone/o'brien", "", ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		got, err := collectionScopeCondition(test.path)
+		if !errors.Is(err, test.err) {
+			t.Errorf("collectionScopeCondition(%q) error = %v, want %v",
+				test.path, err, test.err)
+		}
+		if got != test.want {
+			t.Errorf("collectionScopeCondition(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestInCollectionScope(t *testing.T) {
+	tests := []struct {
+		root string
+		coll string
+		want bool
+	}{
+		{"/zone/proj_1", "/zone/proj_1", true},
+		{"/zone/proj_1", "/zone/proj_1/a", true},
+		{"/zone/proj_1", "/zone/proj_1/a/b", true},
+		{"/zone/proj_1", "/zone/projX1", false},
+		{"/zone/proj_1", "/zone/projX1/a", false},
+		{"/zone/proj_1", "/zone/proj_10", false},
+		{"/zone/proj%", "/zone/project/a", false},
+		{"/", "/zone", true},
+		{"/", "/", true},
+	}
+	for _, test := range tests {
+		if got := inCollectionScope(test.root, test.coll); got != test.want {
+			t.Errorf("inCollectionScope(%q, %q) = %v, want %v",
+				test.root, test.coll, got, test.want)
+		}
+	}
+}
+
+// pagedConnection serves a genquery result of one column in pages, recording
+// the continuation and row limit of each request.
+type pagedConnection struct {
+	pages    [][]string
+	requests []message.IRODSMessageQueryRequest
+}
+
+func (conn *pagedConnection) Request(request connection.Request,
+	response connection.Response, bsBuffer []byte) error {
+	query := *request.(*message.IRODSMessageQueryRequest)
+	conn.requests = append(conn.requests, query)
+
+	queryResult := response.(*message.IRODSMessageQueryResponse)
+	if query.MaxRows == 0 || query.ContinueIndex >= len(conn.pages) {
+		return nil
+	}
+	page := conn.pages[query.ContinueIndex]
+	queryResult.RowCount = len(page)
+	queryResult.AttributeCount = 1
+	queryResult.SQLResult = []message.IRODSMessageSQLResult{{Values: page}}
+	if query.ContinueIndex+1 < len(conn.pages) {
+		queryResult.ContinueIndex = query.ContinueIndex + 1
+	}
+	return nil
+}
+
+func TestForEachRowClosesUnfinishedQuery(t *testing.T) {
+	errStop := errors.New("stop")
+	pages := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+
+	tests := []struct {
+		name   string
+		stopAt string // Row at which fn fails, or empty
+		rows   int    // Rows passed to fn
+		closed bool   // Whether the query is closed
+	}{
+		{"all rows read", "", 5, false},
+		{"failure on the first page", "a", 1, true},
+		{"failure on a middle page", "d", 4, true},
+		{"failure on the last page", "e", 5, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &pagedConnection{pages: pages}
+			query := newQuery()
+
+			rows := 0
+			err := forEachRow(zerolog.Nop(), conn, query, func(row []string) error {
+				rows++
+				if row[0] == test.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if test.stopAt == "" && err != nil {
+				t.Fatalf("forEachRow() error = %v", err)
+			}
+			if test.stopAt != "" && !errors.Is(err, errStop) {
+				t.Fatalf("forEachRow() error = %v, want %v", err, errStop)
+			}
+			if rows != test.rows {
+				t.Errorf("forEachRow() passed %d rows, want %d", rows, test.rows)
+			}
+
+			last := conn.requests[len(conn.requests)-1]
+			closed := last.MaxRows == 0 && last.ContinueIndex != 0
+			if closed != test.closed {
+				t.Errorf("query closed = %v, want %v (requests %+v)", closed, test.closed,
+					conn.requests)
+			}
+		})
+	}
+}
@@ -18,43 +18,428 @@
 package irods
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
 	"github.com/cyverse/go-irodsclient/fs"
 	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/go-irodsclient/irods/util"
 	"github.com/rs/zerolog"
-	"github.com/wtsi-npg/go-baton/appInfo"
 	"github.com/wtsi-npg/go-baton/parsing"
 )
 
-func Get(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}) (err error) {
+// GetOptions are the options of Get. Gathering them here keeps the signature of
+// Get stable as options are added.
+type GetOptions struct {
+	Filter          PathFilter // Data objects of a collection to download
+	SkipUnchanged   bool       // Skip data objects whose local files are unchanged
+	MaxDepth        int        // Levels of a collection tree to download
+	MaxInlineSize   int        // Largest data object to return inline, in bytes
+	ChecksumRetries int        // Times to retry a download with the wrong checksum
+	Redirect        Redirect   // Whether to download from the resource server directly
+	OnConflict      string     // What to do when a local file exists, or empty to overwrite it
+}
+
+// Get downloads a data object to a local file, or a collection tree into a local
+// directory, to at most options.MaxDepth levels below the collection.
+//
+// If the input has no local path, the content of a data object is instead
+// returned inline in the result, base64 encoded under the data key. Only data
+// objects of at most MaxInlineSize bytes are returned this way, to avoid
+// buffering a large one in memory.
+//
+// A download whose checksum does not match that of its data object is repeated
+// up to ChecksumRetries more times, before ErrChecksumMismatch is returned.
+//
+// Data objects are downloaded from the resource server directly if Redirect
+// follows redirects.
+//
+// A local file that already exists is handled according to OnConflict: error
+// fails with an error wrapping ErrAlreadyExists, skip leaves it and counts the
+// data object as skipped, overwrite, the default, replaces it, and rename
+// downloads to the first free name made by adding a suffix .1, .2 and so on.
+// Each renamed download is reported in the renamed map of the result, from data
+// object path to the local path used.
+//
+// A zero-byte data object is written as an empty local file without a
+// transfer. If it has a checksum, that must be the checksum of empty content;
+// unlike other data objects, it need not have one.
+//
+// An error caused by a missing data object or local directory wraps ErrNotFound,
+// and one caused by a lack of permission wraps ErrPermissionDenied.
+func Get(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}, options GetOptions) (result *OperationResult, err error) {
 	var iPath, lPath string
 	var coll, dir bool
-	var result *fs.FileTransferResult
+	var transfer *fs.FileTransferResult
+
+	defer func() { err = classifyError(err) }()
+
+	if err = parsing.Validate(parsing.JSON_GET_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if err = options.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	if err = checkConflictStrategy(options.OnConflict); err != nil {
+		return nil, err
+	}
 	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
 		logger.Err(err)
-		return err
+		return nil, err
+	}
+
+	if inlineGet(jsonContents) {
+		if coll {
+			return nil, fmt.Errorf("a collection cannot be returned inline; "+
+				"give a local directory for %s: %w", iPath, ErrInvalidArgument)
+		}
+		if options.MaxInlineSize < 0 {
+			return nil, fmt.Errorf("maximum inline size %d is negative: %w",
+				options.MaxInlineSize, ErrInvalidArgument)
+		}
+		return getInline(logger, account, iPath, int64(options.MaxInlineSize))
 	}
 
 	if lPath, dir, err = parsing.GetLocalPath(logger, jsonContents); err != nil {
 		logger.Err(err)
-		return err
+		return nil, err
 	}
 	if coll && !dir {
 		err = parsing.ErrMissingKey
 		logger.Err(err).Msg("local path for collection get should not be file")
+		return nil, err
 	}
 	logger.Info().Msgf("Downloading to %s from %s", lPath, iPath)
 
-	filesystem, err := fs.NewFileSystemWithDefault(account, appInfo.Name)
+	result = newOperationResult(parsing.JSON_GET_OP, iPath, coll)
+	result.setLocalPath(lPath, dir)
+
+	filesystem, err := newFileSystem(logger, account)
 	if err != nil {
 		logger.Err(err)
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if coll {
+		err = getCollection(logger, filesystem, iPath, lPath, options, result)
+	} else if transfer, err = getFile(logger, filesystem, iPath, lPath, options, result); transfer != nil {
+		result.setTransfer(transfer)
+		if renamed, ok := result.Renamed[iPath]; ok {
+			result.setLocalPath(renamed, false)
+		}
+	}
+	logger.Info().Msgf("Downloaded %d data objects, skipped %d unchanged", result.Transferred, result.Skipped)
+	if err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// inlineGet returns true if a get input has no local path, so the content of
+// the data object is to be returned inline.
+func inlineGet(jsonContents map[string]interface{}) bool {
+	for _, key := range []string{parsing.JSON_DIRECTORY_KEY,
+		parsing.JSON_DIRECTORY_SHORT_KEY, parsing.JSON_FILE_KEY} {
+		if jsonContents[key] != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// getInline returns a result holding the base64 encoded content of a data
+// object, which is an error if it is larger than maxInlineSize bytes.
+func getInline(logger zerolog.Logger, account *types.IRODSAccount, iPath string,
+	maxInlineSize int64) (result *OperationResult, err error) {
+	var entry *fs.Entry
+	var handle *fs.FileHandle
+	var data []byte
+
+	result = newOperationResult(parsing.JSON_GET_OP, iPath, false)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return result, err
+	}
+	if entry.Size > maxInlineSize {
+		return result, fmt.Errorf("%s is %d bytes, larger than the maximum of %d bytes "+
+			"to return inline; give a local path to download it: %w",
+			iPath, entry.Size, maxInlineSize, ErrInvalidArgument)
+	}
+
+	if handle, err = filesystem.OpenFile(iPath, "", "r"); err != nil {
+		return result, err
+	}
+
+	defer handle.Close()
+
+	// Read one byte more than allowed, to detect a data object that has grown
+	if data, err = io.ReadAll(io.LimitReader(handle, maxInlineSize+1)); err != nil {
+		return result, err
+	}
+	if int64(len(data)) > maxInlineSize {
+		return result, fmt.Errorf("%s grew larger than the maximum of %d bytes "+
+			"to return inline while being read: %w", iPath, maxInlineSize, ErrInvalidArgument)
+	}
+	logger.Debug().Msgf("Read %d bytes of %s inline", len(data), iPath)
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	size := int64(len(data))
+	result.Data = &encoded
+	result.Encoding = parsing.JSON_ENCODING_BASE64
+	result.Size = &size
+	result.Transferred++
+	result.TransferredBytes += size
+
+	result.Success = true
+	return result, nil
+}
+
+// getFile downloads a data object to a local file. If SkipUnchanged is true, the
+// download is skipped when the local file already has the data object's size and
+// checksum. A local file that differs is downloaded again. The transfer counts of
+// the result are updated and details of the transfer returned, or nil if it was
+// skipped.
+func getFile(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	lPath string, options GetOptions, result *OperationResult) (
+	transfer *fs.FileTransferResult, err error) {
+	if options.SkipUnchanged {
+		target := lPath
+		if info, err := os.Stat(lPath); err == nil && info.IsDir() {
+			target = filepath.Join(lPath, path.Base(iPath))
+		}
+
+		var same bool
+		if same, err = unchanged(logger, filesystem, target, iPath); err != nil {
+			return nil, err
+		}
+		if same {
+			logger.Debug().Msgf("Skipping %s, which is unchanged in %s", iPath, target)
+			result.Skipped++
+			return nil, nil
+		}
+	}
+
+	if options.OnConflict != "" && options.OnConflict != parsing.JSON_ARG_CONFLICT_OVERWRITE {
+		var skip bool
+		if lPath, skip, err = resolveConflict(logger, iPath, lPath, options.OnConflict, result); err != nil {
+			return nil, err
+		}
+		if skip {
+			result.Skipped++
+			return nil, nil
+		}
+	}
+
+	var entry *fs.Entry
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return nil, err
+	}
+	if entry.Size == 0 && !entry.IsDir() {
+		if transfer, err = getEmptyFile(logger, entry, lPath); err != nil {
+			return nil, err
+		}
+	} else if transfer, err = withChecksumRetry(logger, iPath, options.ChecksumRetries, func() (*fs.FileTransferResult, error) {
+		return withRedirect(logger, iPath, options.Redirect, func() (*fs.FileTransferResult, error) {
+			return filesystem.DownloadFileRedirectToResource(iPath, "", lPath, 0, true, func(processed int64, total int64) {})
+		}, func() (*fs.FileTransferResult, error) {
+			return filesystem.DownloadFile(iPath, "", lPath, true, func(processed int64, total int64) {})
+		})
+	}); err != nil {
+		if currentDeadline.hasExpired() && transfer != nil && transfer.LocalPath != "" {
+			removePartialFile(logger, transfer.LocalPath)
+		}
+		return nil, err
+	}
+	logger.Debug().Msgf("Downloaded %s from %s", transfer.IRODSPath, transfer.LocalPath)
+	result.addTransfer(transfer)
+	return transfer, nil
+}
+
+// checkConflictStrategy returns an error if strategy is not one of the ways a
+// get may handle an existing local file.
+func checkConflictStrategy(strategy string) error {
+	switch strategy {
+	case "", parsing.JSON_ARG_CONFLICT_ERROR, parsing.JSON_ARG_CONFLICT_SKIP,
+		parsing.JSON_ARG_CONFLICT_OVERWRITE, parsing.JSON_ARG_CONFLICT_RENAME:
+		return nil
+	}
+	return fmt.Errorf("invalid conflict strategy '%s'; must be one of %s, %s, %s or %s: %w",
+		strategy, parsing.JSON_ARG_CONFLICT_ERROR, parsing.JSON_ARG_CONFLICT_SKIP,
+		parsing.JSON_ARG_CONFLICT_OVERWRITE, parsing.JSON_ARG_CONFLICT_RENAME, ErrInvalidArgument)
+}
+
+// resolveConflict returns the local file to which to download iPath, given the
+// local path lPath, which may be a directory, applying the strategy if the file
+// already exists. It returns true if the download is to be skipped instead. A
+// renamed download is recorded in the result.
+func resolveConflict(logger zerolog.Logger, iPath string, lPath string, strategy string,
+	result *OperationResult) (target string, skip bool, err error) {
+	target = lPath
+	if info, err := os.Stat(lPath); err == nil && info.IsDir() {
+		target = filepath.Join(lPath, path.Base(iPath))
+	}
+	if _, err = os.Lstat(target); os.IsNotExist(err) {
+		return target, false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	switch strategy {
+	case parsing.JSON_ARG_CONFLICT_SKIP:
+		logger.Debug().Msgf("Skipping %s, since %s already exists", iPath, target)
+		return target, true, nil
+	case parsing.JSON_ARG_CONFLICT_RENAME:
+		for n := 1; ; n++ {
+			renamed := fmt.Sprintf("%s.%d", target, n)
+			if _, err = os.Lstat(renamed); os.IsNotExist(err) {
+				logger.Info().Msgf("Downloading %s to %s, since %s already exists",
+					iPath, renamed, target)
+				if result.Renamed == nil {
+					result.Renamed = make(map[string]string)
+				}
+				result.Renamed[iPath] = renamed
+				return renamed, false, nil
+			} else if err != nil {
+				return "", false, err
+			}
+		}
+	default:
+		return "", false, fmt.Errorf("local file %s: %w", target, ErrAlreadyExists)
+	}
+}
+
+// removePartialFile removes the local file left by an aborted download.
+func removePartialFile(logger zerolog.Logger, lPath string) {
+	if err := os.Remove(lPath); err != nil && !os.IsNotExist(err) {
+		logger.Warn().Err(err).Msgf("Failed to remove partial download %s", lPath)
+		return
+	}
+	logger.Debug().Msgf("Removed partial download %s", lPath)
+}
+
+// getEmptyFile writes an empty local file for a zero-byte data object, returning
+// details of the transfer as a download would. Verifying a download needs a
+// registered checksum, which an empty data object often lacks, so the data
+// object's checksum, if it has one, is instead checked against that of empty
+// content.
+func getEmptyFile(logger zerolog.Logger, entry *fs.Entry, lPath string) (
+	transfer *fs.FileTransferResult, err error) {
+	target := lPath
+	if info, err := os.Stat(lPath); err == nil && info.IsDir() {
+		target = filepath.Join(lPath, path.Base(entry.Path))
+	}
+
+	transfer = &fs.FileTransferResult{
+		IRODSPath:         entry.Path,
+		LocalPath:         target,
+		CheckSumAlgorithm: entry.CheckSumAlgorithm,
+		IRODSCheckSum:     entry.CheckSum,
+		StartTime:         time.Now(),
+	}
+	if len(entry.CheckSum) > 0 {
+		if transfer.LocalCheckSum, err = util.HashBuffer(bytes.Buffer{},
+			string(entry.CheckSumAlgorithm)); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(transfer.LocalCheckSum, entry.CheckSum) {
+			return nil, fmt.Errorf("%s is empty, but has checksum %s rather than %s: %w",
+				entry.Path, checksumString(entry.CheckSumAlgorithm, entry.CheckSum),
+				checksumString(entry.CheckSumAlgorithm, transfer.LocalCheckSum),
+				ErrChecksumMismatch)
+		}
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	logger.Debug().Msgf("Wrote empty file %s for zero-byte %s", target, entry.Path)
+
+	transfer.EndTime = time.Now()
+	return transfer, nil
+}
+
+// getCollection downloads the contents of a collection tree into a local
+// directory, creating sub-directories to mirror its sub-collections. Data
+// objects excluded by the filter are not downloaded, nor are those more than
+// MaxDepth levels below the collection; see walkCollectionTree.
+func getCollection(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	lPath string, options GetOptions, result *OperationResult) (err error) {
+	if err = os.MkdirAll(lPath, 0755); err != nil {
 		return err
 	}
 
-	defer filesystem.Release()
+	return walkCollectionTree(logger, filesystem, iPath, options.MaxDepth, func(entry *fs.Entry, relPath string) error {
+		target := filepath.Join(lPath, filepath.FromSlash(relPath))
+		if entry.IsDir() {
+			logger.Debug().Msgf("Creating directory %s", target)
+			return os.MkdirAll(target, 0755)
+		}
+		if options.Filter.Excludes(relPath) {
+			logger.Debug().Msgf("Skipping excluded data object %s", entry.Path)
+			return nil
+		}
 
-	if result, err = filesystem.DownloadFile(iPath, "", lPath, true, func(processed int64, total int64) {}); err != nil {
+		_, err := getFile(logger, filesystem, entry.Path, target, options, result)
+		return err
+	})
+}
+
+// walkCollectionTree walks the collection tree at root, calling fn for each
+// collection before its contents and for each data object, along with its path
+// relative to root. The root itself is not passed to fn. The walk descends at
+// most maxDepth levels below root, where the members of root are at level 1,
+// unless maxDepth is UnlimitedDepth.
+func walkCollectionTree(logger zerolog.Logger, filesystem *fs.FileSystem,
+	root string, maxDepth int, fn func(entry *fs.Entry, relPath string) error) error {
+	return walkCollection(logger, filesystem, root, "", 0, maxDepth, fn)
+}
+
+func walkCollection(logger zerolog.Logger, filesystem *fs.FileSystem,
+	coll string, relColl string, depth int, maxDepth int,
+	fn func(entry *fs.Entry, relPath string) error) error {
+	if maxDepth != UnlimitedDepth && depth >= maxDepth {
+		logger.Debug().Msgf("Not descending into %s, at maximum depth %d", coll, maxDepth)
+		return nil
+	}
+
+	entries, err := filesystem.List(coll)
+	if err != nil {
 		return err
 	}
-	logger.Debug().Msgf("Downloaded %s from %s", result.IRODSPath, result.LocalPath)
+
+	for _, entry := range entries {
+		relPath := path.Join(relColl, entry.Name)
+		if err = fn(entry, relPath); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if err = walkCollection(logger, filesystem, entry.Path, relPath,
+				depth+1, maxDepth, fn); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
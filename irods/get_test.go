@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/go-irodsclient/irods/util"
+	"github.com/rs/zerolog"
+)
+
+func TestGetEmptyFile(t *testing.T) {
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	emptySHA256 := decode("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	emptyMD5 := decode("d41d8cd98f00b204e9800998ecf8427e")
+	otherSHA256 := decode("2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881")
+
+	tests := []struct {
+		name      string
+		algorithm types.ChecksumAlgorithm
+		checksum  []byte
+		dir       bool
+		err       error
+	}{
+		{"no checksum", "", nil, false, nil},
+		{"SHA256 of empty content", types.ChecksumAlgorithmSHA256, emptySHA256, false, nil},
+		{"MD5 of empty content", types.ChecksumAlgorithmMD5, emptyMD5, false, nil},
+		{"into a directory", types.ChecksumAlgorithmSHA256, emptySHA256, true, nil},
+		{"checksum of other content", types.ChecksumAlgorithmSHA256, otherSHA256, false,
+			ErrChecksumMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &fs.Entry{
+				Type:              fs.FileEntry,
+				Path:              "/zone/coll/empty.txt",
+				CheckSumAlgorithm: test.algorithm,
+				CheckSum:          test.checksum,
+			}
+			lPath := filepath.Join(t.TempDir(), "local.txt")
+			want := lPath
+			if test.dir {
+				lPath = filepath.Dir(lPath)
+				want = filepath.Join(lPath, "empty.txt")
+			}
+
+			transfer, err := getEmptyFile(zerolog.Nop(), entry, lPath)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("getEmptyFile() error = %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				if _, err = os.Stat(want); !os.IsNotExist(err) {
+					t.Errorf("local file %s was written for a mismatched checksum", want)
+				}
+				return
+			}
+			if transfer.LocalPath != want {
+				t.Errorf("getEmptyFile() local path = %s, want %s", transfer.LocalPath, want)
+			}
+			if !bytes.Equal(transfer.LocalCheckSum, test.checksum) {
+				t.Errorf("getEmptyFile() local checksum = %x, want %x",
+					transfer.LocalCheckSum, test.checksum)
+			}
+			info, err := os.Stat(want)
+			if err != nil {
+				t.Fatalf("local file %s was not written: %v", want, err)
+			}
+			if info.Size() != 0 {
+				t.Errorf("local file %s has size %d, want 0", want, info.Size())
+			}
+		})
+	}
+}
+
+// TestEmptyDataObject puts, gets, checksums and verifies zero-byte data objects,
+// with a checksum registered on upload and without one.
+func TestEmptyDataObject(t *testing.T) {
+	account := testAccount(t)
+	coll := testCollection(t, account)
+	logger := zerolog.Nop()
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "empty.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		object   string
+		checksum bool
+	}{
+		{"with checksum", "checksummed.txt", true},
+		{"without checksum", "unchecksummed.txt", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := map[string]interface{}{"collection": coll, "data_object": test.object}
+
+			put := map[string]interface{}{"directory": src, "file": "empty.txt"}
+			for key, value := range object {
+				put[key] = value
+			}
+			// An empty file is not redirected, even when redirects are followed
+			if _, err := Put(logger, account, put, PutOptions{
+				Checksum: test.checksum, Redirect: FollowRedirect}); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			dst := t.TempDir()
+			get := map[string]interface{}{"directory": dst}
+			for key, value := range object {
+				get[key] = value
+			}
+			if _, err := Get(logger, account, get, GetOptions{Redirect: FollowRedirect}); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			info, err := os.Stat(filepath.Join(dst, test.object))
+			if err != nil {
+				t.Fatalf("Get() wrote no local file: %v", err)
+			}
+			if info.Size() != 0 {
+				t.Errorf("Get() wrote %d bytes, want 0", info.Size())
+			}
+
+			result, err := Checksum(logger, account, object, false, !test.checksum, !test.checksum)
+			if err != nil {
+				t.Fatalf("Checksum() error = %v", err)
+			}
+			entry := testStat(t, account, path.Join(coll, test.object))
+			empty, err := util.HashBuffer(bytes.Buffer{}, string(entry.CheckSumAlgorithm))
+			if err != nil {
+				t.Fatalf("HashBuffer() error = %v", err)
+			}
+			if got := checksumString(entry.CheckSumAlgorithm, entry.CheckSum); got !=
+				checksumString(entry.CheckSumAlgorithm, empty) {
+				t.Errorf("registered checksum = %s, want that of empty content", got)
+			}
+			if test.checksum && result.Checksum != checksumString(entry.CheckSumAlgorithm, empty) {
+				t.Errorf("Checksum() checksum = %s, want that of empty content", result.Checksum)
+			}
+
+			if _, err = Checksum(logger, account, object, true, false, false); err != nil {
+				t.Errorf("Checksum() verify error = %v", err)
+			}
+		})
+	}
+}
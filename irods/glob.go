@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+const globChars = "*?["
+
+// globToLike translates a glob pattern into a genquery LIKE pattern. The LIKE
+// pattern may match more names than the glob (a character class becomes a single
+// character wildcard and literal % and _ are wildcards to genquery), so matches
+// must be filtered with path.Match afterwards.
+func globToLike(pattern string) (string, error) {
+	var like strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			like.WriteByte('%')
+		case '?':
+			like.WriteByte('_')
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class in '%s': %w",
+					pattern, ErrInvalidArgument)
+			}
+			like.WriteByte('_')
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				like.WriteByte(pattern[i])
+			}
+		default:
+			like.WriteByte(c)
+		}
+	}
+	return like.String(), nil
+}
+
+// ExpandGlob expands wildcards in the data object name of an input into one input
+// per matching data object, each a copy of the original with the data object name
+// replaced. An input without wildcards is returned unchanged.
+//
+// The supported wildcards are those of path.Match: '*' matches any sequence of
+// characters, '?' matches any single character and '[...]' matches a character
+// class. A backslash escapes the character that follows it. Wildcards are only
+// allowed in the data object name, not in the collection, and the collection must
+// lie below a zone collection, so that a glob can never range over a whole zone.
+//
+// Any local file name in the input is removed from the expanded inputs, because
+// several data objects cannot share one local file. A pattern that matches no
+// data object is an error wrapping ErrNotFound, so that the input is reported as
+// failed rather than silently dropped.
+func ExpandGlob(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}) (expanded []map[string]interface{}, err error) {
+	var coll, obj, like, collCond, likeCond string
+	var conn *connection.IRODSConnection
+	var rows [][]string
+
+	if obj, err = parsing.GetDataObjectValue(logger, jsonContents); errors.Is(err, parsing.ErrMissingKey) {
+		return []map[string]interface{}{jsonContents}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !strings.ContainsAny(obj, globChars) {
+		return []map[string]interface{}{jsonContents}, nil
+	}
+
+	if coll, err = parsing.GetCollectionValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	coll = filepath.Clean(coll)
+	if strings.ContainsAny(coll, globChars) {
+		return nil, fmt.Errorf("wildcards are only supported in data object names, "+
+			"not in collection '%s': %w", coll, ErrInvalidArgument)
+	}
+	if strings.Count(coll, "/") < 2 {
+		return nil, fmt.Errorf("refusing to expand '%s' in '%s' as it would range "+
+			"over a whole zone: %w", obj, coll, ErrInvalidArgument)
+	}
+	if _, err = path.Match(obj, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", obj, ErrInvalidArgument)
+	}
+	if like, err = globToLike(obj); err != nil {
+		return nil, err
+	}
+	if collCond, err = valueCondition("=", coll); err != nil {
+		return nil, err
+	}
+	if likeCond, err = valueCondition("like", like); err != nil {
+		return nil, err
+	}
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return nil, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_DATA_NAME, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, collCond)
+	query.AddCondition(common.ICAT_COLUMN_DATA_NAME, likeCond)
+
+	if rows, err = executeQuery(logger, conn, query); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if matched, _ := path.Match(obj, row[0]); !matched {
+			continue
+		}
+		member := make(map[string]interface{}, len(jsonContents))
+		for key, value := range jsonContents {
+			member[key] = value
+		}
+		delete(member, parsing.JSON_DATA_OBJECT_SHORT_KEY)
+		delete(member, parsing.JSON_FILE_KEY)
+		member[parsing.JSON_DATA_OBJECT_KEY] = row[0]
+		expanded = append(expanded, member)
+	}
+
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("no data objects in %s match %s: %w", coll, obj, ErrNotFound)
+	}
+	logger.Debug().Msgf("Expanded %s in %s to %d data objects", obj, coll, len(expanded))
+
+	return expanded, nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/go-irodsclient/irods/util"
+	"github.com/rs/zerolog"
+)
+
+// unchanged returns true if the local file at lPath and the data object at iPath
+// both exist and have the same size and checksum. If iPath is a collection, the
+// data object is the one in it named after the local file. A data object without
+// a registered checksum is never considered unchanged, because the comparison
+// cannot be made.
+func unchanged(logger zerolog.Logger, filesystem *fs.FileSystem, lPath string,
+	iPath string) (bool, error) {
+	entry, err := comparableEntry(logger, filesystem, lPath, iPath)
+	if err != nil || entry == nil {
+		return false, err
+	}
+	return checksumUnchanged(logger, lPath, entry)
+}
+
+// comparableEntry returns the data object to which the local file at lPath is
+// compared by unchanged, if the file and the data object both exist and have the
+// same size and the data object has a checksum, or nil if they differ without
+// the need to checksum the file.
+func comparableEntry(logger zerolog.Logger, filesystem *fs.FileSystem, lPath string,
+	iPath string) (*fs.Entry, error) {
+	info, err := os.Stat(lPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry, err := filesystem.Stat(iPath)
+	if types.IsFileNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if entry.IsDir() {
+		if entry, err = filesystem.Stat(path.Join(iPath, filepath.Base(lPath))); types.IsFileNotFoundError(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if entry.Size != info.Size() {
+		logger.Debug().Msgf("Size of %s (%d) differs from %s (%d)",
+			lPath, info.Size(), entry.Path, entry.Size)
+		return nil, nil
+	}
+	if len(entry.CheckSum) == 0 || entry.CheckSumAlgorithm == types.ChecksumAlgorithmUnknown {
+		logger.Debug().Msgf("%s has no checksum to compare with %s", entry.Path, lPath)
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// checksumUnchanged returns true if the local file at lPath has the checksum of
+// the data object entry, calculated with the same algorithm.
+func checksumUnchanged(logger zerolog.Logger, lPath string, entry *fs.Entry) (bool, error) {
+	localChecksum, err := util.HashLocalFile(lPath, string(entry.CheckSumAlgorithm))
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(localChecksum, entry.CheckSum) {
+		logger.Debug().Msgf("Checksum of %s differs from %s", lPath, entry.Path)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// fileUpload is a local file and the iRODS path to which it is uploaded.
+type fileUpload struct {
+	lPath string
+	iPath string
+}
+
+// unchangedFiles decides, as unchanged does, whether each of the files is
+// unchanged, returning the decisions keyed by local path. The data objects are
+// queried one at a time, but the local files that need checksumming are
+// checksummed by up to workers goroutines at once, apart from any transfer, since
+// checksumming many files one at a time is slow.
+func unchangedFiles(logger zerolog.Logger, filesystem *fs.FileSystem,
+	files []fileUpload, workers int) (map[string]bool, error) {
+	type job struct {
+		lPath string
+		entry *fs.Entry
+	}
+
+	var jobs []job
+	decisions := make(map[string]bool, len(files))
+	for _, file := range files {
+		entry, err := comparableEntry(logger, filesystem, file.lPath, file.iPath)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			decisions[file.lPath] = false
+			continue
+		}
+		jobs = append(jobs, job{lPath: file.lPath, entry: entry})
+	}
+	logger.Debug().Msgf("Checksumming %d of %d files with %d workers",
+		len(jobs), len(files), workers)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	queue := make(chan job)
+
+	for i := 0; i < min(workers, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				same, err := checksumUnchanged(logger, j.lPath, j.entry)
+
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				decisions[j.lPath] = same
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return decisions, nil
+}
+
+// dataUnchanged returns true if the data object at iPath exists and already
+// holds data, judged by size and checksum in the same way as unchanged.
+func dataUnchanged(logger zerolog.Logger, filesystem *fs.FileSystem, data []byte,
+	iPath string) (bool, error) {
+	entry, err := filesystem.Stat(iPath)
+	if types.IsFileNotFoundError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if entry.IsDir() {
+		return false, nil
+	}
+
+	if entry.Size != int64(len(data)) {
+		logger.Debug().Msgf("Size of inline data (%d) differs from %s (%d)",
+			len(data), entry.Path, entry.Size)
+		return false, nil
+	}
+	if len(entry.CheckSum) == 0 || entry.CheckSumAlgorithm == types.ChecksumAlgorithmUnknown {
+		logger.Debug().Msgf("%s has no checksum to compare with inline data", entry.Path)
+		return false, nil
+	}
+
+	dataChecksum, err := util.HashBuffer(*bytes.NewBuffer(data), string(entry.CheckSumAlgorithm))
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(dataChecksum, entry.CheckSum) {
+		logger.Debug().Msgf("Checksum of inline data differs from %s", entry.Path)
+		return false, nil
+	}
+
+	return true, nil
+}
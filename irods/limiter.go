@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/appInfo"
+)
+
+// MinConnections is the smallest cap on connections that allows a file system
+// to be created at all; go-irodsclient requires a file system to allow at least
+// this many for its transfer and metadata pools together.
+const MinConnections = fs.FileSystemConnectionMaxMin + fs.FileSystemConnectionMetaDefault
+
+// ConnectionLimiter caps the number of iRODS connections that may be open at
+// once, so that the server's limit on connections per client is not exceeded. A
+// file system may open as many connections as its pools allow, so it reserves
+// that many when created and returns them when released. Creating a file system
+// that would exceed the cap waits until enough are returned, rather than failing.
+type ConnectionLimiter struct {
+	mutex     sync.Mutex
+	available *sync.Cond
+	max       int
+	inUse     int
+}
+
+// limiter caps the connections of all file systems, or is nil for no cap.
+var limiter *ConnectionLimiter
+
+// NewConnectionLimiter returns a limiter allowing at most max connections, which
+// must be at least MinConnections.
+func NewConnectionLimiter(max int) (*ConnectionLimiter, error) {
+	if max < MinConnections {
+		return nil, fmt.Errorf("connection cap %d is less than the minimum of %d: %w",
+			max, MinConnections, ErrInvalidArgument)
+	}
+	l := &ConnectionLimiter{max: max}
+	l.available = sync.NewCond(&l.mutex)
+	return l, nil
+}
+
+// SetMaxConnections caps the number of connections open at once across all the
+// file systems created by operations. A max of 0 removes the cap.
+func SetMaxConnections(max int) (err error) {
+	if max == 0 {
+		limiter = nil
+		return nil
+	}
+	limiter, err = NewConnectionLimiter(max)
+	return err
+}
+
+// maxConnectionsPerHost caps the connections of all file systems to each host,
+// or is 0 for no cap.
+var maxConnectionsPerHost int
+
+// serverVersionsLogged holds each host whose server version has been logged, so
+// that the version of every host is logged, but only once.
+var serverVersionsLogged sync.Map
+
+// hostLimiters holds the limiter for each host to which a file system has been
+// created, and hostReservations the host limiter to which each file system
+// returns its connections when released.
+var (
+	hostMutex        sync.Mutex
+	hostLimiters     = map[string]*ConnectionLimiter{}
+	hostReservations = map[*fs.FileSystem]*ConnectionLimiter{}
+)
+
+// SetMaxConnectionsPerHost caps the number of connections open at once to each
+// iRODS host, across all the file systems created by operations, so that a busy
+// host does not take connections from others. It applies alongside any cap set
+// by SetMaxConnections. A max of 0 removes the cap.
+func SetMaxConnectionsPerHost(max int) error {
+	if max != 0 && max < MinConnections {
+		return fmt.Errorf("connection cap per host %d is less than the minimum of %d: %w",
+			max, MinConnections, ErrInvalidArgument)
+	}
+
+	hostMutex.Lock()
+	defer hostMutex.Unlock()
+
+	maxConnectionsPerHost = max
+	hostLimiters = map[string]*ConnectionLimiter{}
+	return nil
+}
+
+// hostLimiter returns the limiter of connections to a host, or nil if there is
+// no cap per host.
+func hostLimiter(host string) *ConnectionLimiter {
+	hostMutex.Lock()
+	defer hostMutex.Unlock()
+
+	if maxConnectionsPerHost == 0 {
+		return nil
+	}
+	l, ok := hostLimiters[host]
+	if !ok {
+		l, _ = NewConnectionLimiter(maxConnectionsPerHost)
+		hostLimiters[host] = l
+	}
+	return l
+}
+
+// acquire reserves n connections, waiting until they are available.
+func (l *ConnectionLimiter) acquire(n int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.inUse+n > l.max {
+		l.available.Wait()
+	}
+	l.inUse += n
+}
+
+// release returns n reserved connections.
+func (l *ConnectionLimiter) release(n int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inUse -= n
+	l.available.Broadcast()
+}
+
+// fileSystemConfig returns the configuration of the file systems created by
+// operations, whose transfer pool is shrunk, if need be, to fit within the caps.
+func fileSystemConfig() *fs.FileSystemConfig {
+	config := fs.NewFileSystemConfigWithDefault(appInfo.Name)
+	if limiter != nil {
+		config.ConnectionMax = min(config.ConnectionMax,
+			limiter.max-fs.FileSystemConnectionMetaDefault)
+	}
+	if maxConnectionsPerHost > 0 {
+		config.ConnectionMax = min(config.ConnectionMax,
+			maxConnectionsPerHost-fs.FileSystemConnectionMetaDefault)
+	}
+	if operationTimeout > 0 {
+		config.OperationTimeout = min(config.OperationTimeout, operationTimeout)
+	}
+	return config
+}
+
+// fileSystemConnections returns the most connections a file system may open.
+func fileSystemConnections() int {
+	return fileSystemConfig().ConnectionMax + fs.FileSystemConnectionMetaDefault
+}
+
+// newFileSystem returns a new file system for an account, first waiting until
+// the connections it may open are within the cap, if there is one, and within
+// the cap for the account's host. It must be released with releaseFileSystem.
+// The file system is released early if the running operation times out; see
+// WithOperationTimeout.
+//
+// The version of the server is logged when the first file system for each host
+// is created, so that it is recorded whether or not the account was verified,
+// and so that the versions of federated hosts may be compared.
+func newFileSystem(logger zerolog.Logger, account *types.IRODSAccount) (*fs.FileSystem, error) {
+	n := fileSystemConnections()
+	if limiter != nil {
+		limiter.acquire(n)
+	}
+	host := hostLimiter(account.Host)
+	if host != nil {
+		host.acquire(n)
+	}
+
+	filesystem, err := fs.NewFileSystem(account, fileSystemConfig())
+	if err == nil {
+		if err = currentDeadline.track(filesystem); err != nil {
+			filesystem.Release()
+		}
+	}
+	if err != nil {
+		if host != nil {
+			host.release(n)
+		}
+		if limiter != nil {
+			limiter.release(n)
+		}
+		return filesystem, err
+	}
+
+	if host != nil {
+		hostMutex.Lock()
+		hostReservations[filesystem] = host
+		hostMutex.Unlock()
+	}
+	if _, logged := serverVersionsLogged.LoadOrStore(account.Host, true); !logged {
+		logServerVersion(logger, account.Host, filesystem)
+	}
+
+	return filesystem, nil
+}
+
+// releaseFileSystem releases a file system created by newFileSystem, returning
+// its connections to the caps.
+func releaseFileSystem(filesystem *fs.FileSystem) {
+	currentDeadline.untrack(filesystem)
+	filesystem.Release()
+
+	hostMutex.Lock()
+	host := hostReservations[filesystem]
+	delete(hostReservations, filesystem)
+	hostMutex.Unlock()
+
+	if host != nil {
+		host.release(fileSystemConnections())
+	}
+	if limiter != nil {
+		limiter.release(fileSystemConnections())
+	}
+}
+
+// DefaultConnectionWait is the default of the longest to wait for a metadata
+// connection to become free when a file system's pool is exhausted.
+const DefaultConnectionWait = 30 * time.Second
+
+// connectionWait is the longest to wait for a metadata connection to become free
+// when a file system's pool is exhausted, or 0 not to wait.
+var connectionWait = DefaultConnectionWait
+
+// SetConnectionWait sets the longest to wait for a metadata connection to become
+// free when a file system's pool is exhausted, before failing with
+// ErrConnectionPoolExhausted. A wait of 0 fails at once.
+func SetConnectionWait(wait time.Duration) error {
+	if wait < 0 {
+		return fmt.Errorf("connection wait %s is negative: %w", wait, ErrInvalidArgument)
+	}
+	connectionWait = wait
+	return nil
+}
+
+// isPoolExhausted returns true if err reports that no connection could be taken
+// from a file system's pool. go-irodsclient reports this either as a typed error
+// or, when it cannot share an in-use connection either, only as text.
+func isPoolExhausted(err error) bool {
+	return types.IsConnectionPoolFullError(err) ||
+		strings.Contains(err.Error(), "too many connections created")
+}
+
+// metadataPool is the pool of metadata connections of a file system.
+type metadataPool interface {
+	GetMetadataConnection() (*connection.IRODSConnection, error)
+}
+
+// getMetadataConnection returns a metadata connection from a file system, which
+// must be returned with its ReturnMetadataConnection. If the pool is exhausted,
+// it retries until a connection becomes free or the connection wait has passed,
+// when it returns an error wrapping ErrConnectionPoolExhausted.
+func getMetadataConnection(filesystem metadataPool) (*connection.IRODSConnection, error) {
+	deadline := time.Now().Add(connectionWait)
+	delay := 10 * time.Millisecond
+
+	for {
+		conn, err := filesystem.GetMetadataConnection()
+		if err == nil || !isPoolExhausted(err) {
+			return conn, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("no connection became free within %s (%w); "+
+				"lower the concurrency or raise --connection-wait: %w",
+				connectionWait, err, ErrConnectionPoolExhausted)
+		}
+		time.Sleep(min(delay, time.Until(deadline)))
+		delay = min(delay*2, time.Second)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func TestNewConnectionLimiterMinimum(t *testing.T) {
+	if _, err := NewConnectionLimiter(MinConnections - 1); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("NewConnectionLimiter(%d) error = %v, want %v",
+			MinConnections-1, err, ErrInvalidArgument)
+	}
+	if _, err := NewConnectionLimiter(MinConnections); err != nil {
+		t.Errorf("NewConnectionLimiter(%d) error = %v, want none", MinConnections, err)
+	}
+}
+
+func TestConnectionLimiterBlocksBeyondCap(t *testing.T) {
+	l, err := NewConnectionLimiter(MinConnections)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workers := 3 * MinConnections
+	var held, peak atomic.Int32
+	done := make(chan struct{})
+	proceed := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire(1)
+			n := held.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			<-proceed
+			held.Add(-1)
+			l.release(1)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// The first workers to acquire fill the cap and hold it, so the rest must
+	// be waiting rather than having failed or finished
+	deadline := time.Now().Add(5 * time.Second)
+	for held.Load() < int32(MinConnections) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := held.Load(); n != int32(MinConnections) {
+		t.Fatalf("%d workers hold connections, want the cap of %d", n, MinConnections)
+	}
+	select {
+	case <-done:
+		t.Fatal("all workers finished while the cap was held")
+	default:
+	}
+
+	close(proceed)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers did not finish once connections were released")
+	}
+	if p := peak.Load(); p > int32(MinConnections) {
+		t.Errorf("%d connections were held at once, more than the cap of %d", p, MinConnections)
+	}
+	if l.inUse != 0 {
+		t.Errorf("%d connections still in use, want 0", l.inUse)
+	}
+}
+
+// exhaustedPool is a metadata pool that is full for its first full requests.
+type exhaustedPool struct {
+	full     int
+	requests int
+	err      error
+}
+
+func (pool *exhaustedPool) GetMetadataConnection() (*connection.IRODSConnection, error) {
+	pool.requests++
+	if pool.requests <= pool.full {
+		return nil, pool.err
+	}
+	return nil, nil
+}
+
+func TestGetMetadataConnectionExhausted(t *testing.T) {
+	saved := connectionWait
+	t.Cleanup(func() { connectionWait = saved })
+	if err := SetConnectionWait(30 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"typed", types.NewConnectionPoolFullError(10, 10)},
+		{"text", errors.New("failed to get a connection: too many connections created")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := &exhaustedPool{full: math.MaxInt, err: test.err}
+			_, err := getMetadataConnection(pool)
+			if !errors.Is(err, ErrConnectionPoolExhausted) {
+				t.Fatalf("getMetadataConnection() error = %v, want %v", err, ErrConnectionPoolExhausted)
+			}
+			if !strings.Contains(err.Error(), "raise --connection-wait") {
+				t.Errorf("getMetadataConnection() error %q gives no advice", err)
+			}
+			if pool.requests < 2 {
+				t.Errorf("getMetadataConnection() made %d requests, want it to retry", pool.requests)
+			}
+		})
+	}
+}
+
+func TestGetMetadataConnectionRetries(t *testing.T) {
+	saved := connectionWait
+	t.Cleanup(func() { connectionWait = saved })
+	if err := SetConnectionWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &exhaustedPool{full: 2, err: types.NewConnectionPoolFullError(10, 10)}
+	if _, err := getMetadataConnection(pool); err != nil {
+		t.Fatalf("getMetadataConnection() error = %v, want none once a connection is free", err)
+	}
+	if pool.requests != 3 {
+		t.Errorf("getMetadataConnection() made %d requests, want 3", pool.requests)
+	}
+}
+
+func TestGetMetadataConnectionOtherError(t *testing.T) {
+	pool := &exhaustedPool{full: 1, err: errors.New("connection refused")}
+	if _, err := getMetadataConnection(pool); err == nil ||
+		errors.Is(err, ErrConnectionPoolExhausted) || pool.requests != 1 {
+		t.Errorf("getMetadataConnection() error = %v after %d requests, "+
+			"want the original error at once", err, pool.requests)
+	}
+}
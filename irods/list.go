@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// ListEntry is a child of a listed collection, in the shape baton-list uses
+// for the members of a collection's contents.
+type ListEntry struct {
+	Collection  string `json:"collection"`
+	DataObject  string `json:"data_object,omitempty"`
+	Size        *int64 `json:"size,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	HasChecksum *bool  `json:"has_checksum,omitempty"`
+}
+
+// List reports a data object or collection in the shape of baton-list. If
+// contents is true and the target is a collection, its immediate children are
+// reported under contents. The sizes and checksums of data objects are reported
+// if size and checksum are true, respectively.
+//
+// If includeChecksum is true, each data object listed is flagged with whether it
+// has a registered checksum, since one without is a risk to data integrity. If
+// requireChecksum is also true, a listing with any data object that lacks a
+// checksum is reported, but as a failure wrapping ErrMissingChecksum, so that
+// an audit can tell that something is amiss from the exit status.
+//
+// The contents are sorted by sort, which is one of path, size or modified time,
+// or are left in the order the server returns them if sort is empty. Sorting is
+// done once all the contents have been listed.
+func List(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, contents bool, size bool,
+	checksum bool, sort string, includeChecksum bool, requireChecksum bool) (
+	result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+
+	defer func() { err = classifyError(err) }()
+
+	if err = parsing.Validate(parsing.JSON_LIST_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if err = checkSortField(sort); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_LIST_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return result, err
+	}
+
+	missing := 0
+	if !entry.IsDir() {
+		result.setPath(entry.Path, false)
+		e := newListEntry(entry, size, checksum, includeChecksum)
+		result.Size = e.Size
+		result.Checksum = e.Checksum
+		result.HasChecksum = e.HasChecksum
+		if includeChecksum && len(entry.CheckSum) == 0 {
+			missing++
+		}
+		if err = checkChecksums(logger, entry.Path, missing, requireChecksum); err != nil {
+			return result, err
+		}
+		result.Success = true
+		return result, nil
+	}
+
+	result.setPath(entry.Path, true)
+	if contents {
+		var children []*fs.Entry
+		if children, err = filesystem.List(entry.Path); err != nil {
+			return result, err
+		}
+		sortByField(children, sort, func(child *fs.Entry) sortKey {
+			return sortKey{path: child.Path, size: child.Size, modified: child.ModifyTime}
+		})
+
+		members := make([]ListEntry, 0, len(children))
+		for _, child := range children {
+			members = append(members, newListEntry(child, size, checksum, includeChecksum))
+			if includeChecksum && !child.IsDir() && len(child.CheckSum) == 0 {
+				missing++
+			}
+		}
+		result.Contents = &members
+		logger.Debug().Msgf("Listed %d members of %s", len(members), entry.Path)
+	}
+	if err = checkChecksums(logger, entry.Path, missing, requireChecksum); err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// checkChecksums warns of the number of data objects listed at iPath that have
+// no checksum, returning an error wrapping ErrMissingChecksum if there are any
+// and require is true.
+func checkChecksums(logger zerolog.Logger, iPath string, missing int, require bool) error {
+	if missing == 0 {
+		return nil
+	}
+	logger.Warn().Msgf("%d data objects listed at %s have no checksum", missing, iPath)
+	if require {
+		return fmt.Errorf("%d data objects listed at %s: %w", missing, iPath, ErrMissingChecksum)
+	}
+	return nil
+}
+
+// newListEntry returns the listing of a collection or data object, flagged with
+// whether a data object has a checksum if hasChecksum is true.
+func newListEntry(entry *fs.Entry, size bool, checksum bool, hasChecksum bool) ListEntry {
+	if entry.IsDir() {
+		return ListEntry{Collection: entry.Path}
+	}
+
+	e := ListEntry{Collection: path.Dir(entry.Path), DataObject: entry.Name}
+	if size {
+		s := entry.Size
+		e.Size = &s
+	}
+	if checksum && len(entry.CheckSum) > 0 {
+		e.Checksum, _ = types.MakeIRODSChecksumString(entry.CheckSumAlgorithm, entry.CheckSum)
+	}
+	if hasChecksum {
+		has := len(entry.CheckSum) > 0
+		e.HasChecksum = &has
+	}
+	return e
+}
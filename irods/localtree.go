@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+)
+
+// UnlimitedDepth is the maximum depth of a recursive operation that descends
+// through the whole of a tree.
+const UnlimitedDepth = -1
+
+// localEntry is a directory or regular file found while walking a local tree.
+type localEntry struct {
+	Path    string // Path of the entry on the local filesystem
+	RelPath string // Path of the entry relative to the root of the walk
+	IsDir   bool
+	Size    int64
+}
+
+// checkLocalPath returns an error wrapping ErrLocalPathNotFound if the local
+// path does not exist, or ErrLocalPathNotReadable if it cannot be read. If dir
+// is true, the path must be a directory, otherwise a file. It is cheap enough
+// to call before connecting to iRODS, so that a mistyped path fails fast.
+func checkLocalPath(lPath string, dir bool) error {
+	info, err := os.Stat(lPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%s: %w", lPath, ErrLocalPathNotFound)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%s: %w", lPath, ErrLocalPathNotReadable)
+	case err != nil:
+		return err
+	case dir && !info.IsDir():
+		return fmt.Errorf("%s is not a directory: %w", lPath, ErrInvalidArgument)
+	case !dir && info.IsDir():
+		return fmt.Errorf("%s is a directory, not a file: %w", lPath, ErrInvalidArgument)
+	}
+
+	f, err := os.Open(lPath)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%s: %w", lPath, ErrLocalPathNotReadable)
+		}
+		return err
+	}
+	return f.Close()
+}
+
+// checkObjectSize returns an error wrapping ErrObjectTooLarge if the local file
+// is larger than max bytes. A max of 0 allows any size.
+func checkObjectSize(lPath string, max int64) error {
+	if max == 0 {
+		return nil
+	}
+	info, err := os.Stat(lPath)
+	if err != nil {
+		return err
+	}
+	if info.Size() > max {
+		return fmt.Errorf("%s is %d bytes, more than the maximum of %d: %w",
+			lPath, info.Size(), max, ErrObjectTooLarge)
+	}
+	return nil
+}
+
+// walkLocalTree walks the local directory tree at root, calling fn for each
+// directory before its contents and for each regular file. The root itself is
+// not passed to fn.
+//
+// Symbolic links are skipped unless followSymlinks is true, in which case they
+// are dereferenced and their targets walked as if they were in the tree. A link
+// to a directory that is already being walked (i.e. one that would cause a
+// cycle) is skipped, as are broken links and any other non-regular files.
+//
+// The walk descends at most maxDepth levels below root, where the members of
+// root are at level 1, unless maxDepth is UnlimitedDepth.
+func walkLocalTree(logger zerolog.Logger, root string, followSymlinks bool,
+	maxDepth int, fn func(entry localEntry) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return walkLocalDir(logger, root, "", 0, maxDepth, followSymlinks,
+		map[string]bool{realRoot: true}, fn)
+}
+
+func walkLocalDir(logger zerolog.Logger, dir string, relDir string, depth int,
+	maxDepth int, followSymlinks bool, ancestors map[string]bool,
+	fn func(entry localEntry) error) error {
+	if maxDepth != UnlimitedDepth && depth >= maxDepth {
+		logger.Debug().Msgf("Not descending into %s, at maximum depth %d", dir, maxDepth)
+		return nil
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, dirEntry := range dirEntries {
+		path := filepath.Join(dir, dirEntry.Name())
+		relPath := filepath.Join(relDir, dirEntry.Name())
+
+		var info os.FileInfo
+		if dirEntry.Type()&os.ModeSymlink != 0 {
+			if !followSymlinks {
+				logger.Debug().Msgf("Skipping symlink %s", path)
+				continue
+			}
+			if info, err = os.Stat(path); err != nil {
+				logger.Debug().Err(err).Msgf("Skipping broken symlink %s", path)
+				continue
+			}
+		} else if info, err = dirEntry.Info(); err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			var realPath string
+			if realPath, err = filepath.EvalSymlinks(path); err != nil {
+				return err
+			}
+			if ancestors[realPath] {
+				logger.Debug().Msgf("Skipping symlink %s to %s, which would cause a cycle",
+					path, realPath)
+				continue
+			}
+			if err = fn(localEntry{Path: path, RelPath: relPath, IsDir: true}); err != nil {
+				return err
+			}
+			ancestors[realPath] = true
+			err = walkLocalDir(logger, path, relPath, depth+1, maxDepth,
+				followSymlinks, ancestors, fn)
+			delete(ancestors, realPath)
+			if err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err = fn(localEntry{Path: path, RelPath: relPath, Size: info.Size()}); err != nil {
+				return err
+			}
+		default:
+			logger.Debug().Msgf("Skipping %s, which is not a regular file", path)
+		}
+	}
+
+	return nil
+}
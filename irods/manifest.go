@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Manifest walks a collection tree, to at most maxDepth levels below the
+// collection, describing each data object found with its size, checksum,
+// timestamps and AVUs. Each description is a result passed to emit as soon as
+// the data object is found, so that a large tree is not held in memory.
+//
+// Once the walk is complete, a result for the collection is returned with the
+// number and total size of the data objects described. If the walk fails, that
+// result is returned with the error, describing the data objects emitted so far.
+func Manifest(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, maxDepth int,
+	emit func(result *OperationResult) error) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+
+	if err = parsing.Validate(parsing.JSON_MANIFEST_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("manifest requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_MANIFEST_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	var objectCount int
+	var totalSize int64
+	result.ObjectCount = &objectCount
+	result.TotalSize = &totalSize
+
+	err = walkCollectionTree(logger, filesystem, iPath, maxDepth, func(entry *fs.Entry, _ string) error {
+		if entry.IsDir() {
+			return nil
+		}
+
+		described, err := describeDataObject(filesystem, entry)
+		if err != nil {
+			return err
+		}
+		if err = emit(described); err != nil {
+			return err
+		}
+		objectCount++
+		totalSize += entry.Size
+		return nil
+	})
+	logger.Info().Msgf("Described %d data objects in %s", objectCount, iPath)
+	if err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// describeDataObject returns a manifest result describing a data object.
+func describeDataObject(filesystem *fs.FileSystem, entry *fs.Entry) (
+	result *OperationResult, err error) {
+	var metas []*types.IRODSMeta
+
+	result = newOperationResult(parsing.JSON_MANIFEST_OP, entry.Path, false)
+
+	size := entry.Size
+	result.Size = &size
+	if len(entry.CheckSum) > 0 {
+		result.Checksum, _ = types.MakeIRODSChecksumString(entry.CheckSumAlgorithm, entry.CheckSum)
+	}
+	result.Timestamps = []Timestamp{
+		{Created: formatTimestamp(entry.CreateTime)},
+		{Modified: formatTimestamp(entry.ModifyTime)},
+	}
+
+	if metas, err = filesystem.ListMetadata(entry.Path); err != nil {
+		return result, err
+	}
+	result.AVUs = []AVU{}
+	for _, meta := range metas {
+		result.AVUs = append(result.AVUs, AVU{Attribute: meta.Name, Value: meta.Value, Units: meta.Units})
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// formatTimestamp returns a time in the form baton reports timestamps.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// reservedAttributePrefix begins the names of the attributes that iRODS reserves
+// for its own use, e.g. irods::access_time, which are not for users to copy.
+const reservedAttributePrefix = "irods::"
+
+// MetaCopy copies the AVUs of a data object or collection to another at
+// destination, reporting those copied and their number. Attributes reserved by
+// iRODS are not copied.
+//
+// By default, the AVUs are merged with those already on the destination: an AVU
+// it already has is skipped. If overwrite is true, the destination's AVUs with
+// each attribute copied are first removed, so that the source's values replace
+// them; AVUs with other attributes are left as they are.
+func MetaCopy(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, destination string, overwrite bool) (
+	result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+	var srcMetas, destMetas []*types.IRODSMeta
+
+	if err = parsing.Validate(parsing.JSON_METACOPY_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if destination == "" {
+		return nil, fmt.Errorf("metacopy requires a destination %s argument: %w",
+			parsing.JSON_OP_PATH, ErrMissingArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_METACOPY_OP, iPath, coll)
+	result.Destination = destination
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if entry, err = filesystem.Stat(destination); err != nil {
+		logger.Err(err).Msgf("Error while stating %s", destination)
+		return result, err
+	}
+	if srcMetas, err = filesystem.ListMetadata(iPath); err != nil {
+		logger.Err(err).Msgf("Error while listing the metadata of %s", iPath)
+		return result, err
+	}
+	if destMetas, err = filesystem.ListMetadata(destination); err != nil {
+		logger.Err(err).Msgf("Error while listing the metadata of %s", destination)
+		return result, err
+	}
+
+	var avus []AVU
+	attrs := make(map[string]bool)
+	for _, meta := range srcMetas {
+		if strings.HasPrefix(meta.Name, reservedAttributePrefix) {
+			logger.Debug().Msgf("Skipping reserved attribute %s of %s", meta.Name, iPath)
+			continue
+		}
+		avus = append(avus, AVU{Attribute: meta.Name, Value: meta.Value, Units: meta.Units})
+		attrs[meta.Name] = true
+	}
+
+	existing := make(map[AVU]bool)
+	replaced := make(map[string]bool)
+	for _, meta := range destMetas {
+		if overwrite && attrs[meta.Name] {
+			replaced[meta.Name] = true
+			continue
+		}
+		existing[AVU{Attribute: meta.Name, Value: meta.Value, Units: meta.Units}] = true
+	}
+
+	for attr := range replaced {
+		if err = applyAVU(logger, filesystem, destination, entry.IsDir(),
+			parsing.JSON_ARG_META_REM, AVU{Attribute: attr}); err != nil {
+			return result, err
+		}
+	}
+
+	logger.Info().Msgf("Copying %d AVUs from %s to %s", len(avus), iPath, destination)
+	for _, avu := range avus {
+		if existing[avu] {
+			logger.Debug().Msgf("Skipping attribute: %s, value: %s, units: %s, "+
+				"which %s already has", avu.Attribute, avu.Value, avu.Units, destination)
+			result.Skipped++
+			continue
+		}
+		if err = applyAVU(logger, filesystem, destination, entry.IsDir(),
+			parsing.JSON_ARG_META_ADD, avu); err != nil {
+			return result, err
+		}
+		result.AVUs = append(result.AVUs, avu)
+	}
+
+	copied := len(result.AVUs)
+	result.Count = &copied
+	result.Success = true
+	return result, nil
+}
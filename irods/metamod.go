@@ -21,62 +21,206 @@ import (
 	"fmt"
 
 	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
-	"github.com/wtsi-npg/go-baton/appInfo"
 	"github.com/wtsi-npg/go-baton/parsing"
 )
 
+// MetaMod adds, removes or changes the units of the AVUs in the input on a data
+// object or collection. Each AVU may carry its own operator, so that a single
+// input can mix operations; an AVU without one uses operation. The AVUs are
+// applied in order.
+//
+// An AVU to be added without units is given defaultUnits, if that is not
+// empty; units given with an AVU take precedence.
 func MetaMod(logger zerolog.Logger, account *types.IRODSAccount,
-	jsonContents map[string]interface{}, operation string) (err error) {
+	jsonContents map[string]interface{}, operation string, defaultUnits string) (
+	result *OperationResult, err error) {
 	var iPath string
+	var coll bool
 	var meta []interface{}
+	var avus []AVU
 
-	if operation != parsing.JSON_ARG_META_ADD && operation != parsing.JSON_ARG_META_REM {
-		return fmt.Errorf("operation argument != %s or %s: %w",
-			parsing.JSON_ARG_META_ADD, parsing.JSON_ARG_META_REM, ErrMissingArgument)
+	if operation != "" && !validMetaModOperation(operation) {
+		return nil, fmt.Errorf("operation argument != %s, %s or %s: %w",
+			parsing.JSON_ARG_META_ADD, parsing.JSON_ARG_META_REM,
+			parsing.JSON_ARG_META_UNITS, ErrInvalidArgument)
 	}
 
-	if iPath, _, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
-		return err
+	if err = parsing.Validate(parsing.JSON_METAMOD_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
 	}
 
 	if meta, err = parsing.GetAVUsList(logger, jsonContents); err != nil {
-		return err
+		return nil, err
 	}
+	if avus, err = parseAVUs(logger, meta); err != nil {
+		return nil, err
+	}
+	if err = resolveAVUs(avus, operation, defaultUnits); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_METAMOD_OP, iPath, coll)
 
-	filesystem, err := fs.NewFileSystemWithDefault(account, appInfo.Name)
+	filesystem, err := newFileSystem(logger, account)
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+	logger.Info().Msgf("Modifying %d AVUs on %s", len(avus), iPath)
+
+	for _, avu := range avus {
+		if err = applyAVU(logger, filesystem, iPath, coll, avu.Operator, avu); err != nil {
+			return result, err
+		}
+		result.AVUs = append(result.AVUs, avu)
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// resolveAVUs gives each of avus without an operator the operation, and each to
+// be added without units the defaultUnits. An AVU's own operator and units take
+// precedence.
+func resolveAVUs(avus []AVU, operation string, defaultUnits string) error {
+	for i := range avus {
+		if avus[i].Operator == "" {
+			avus[i].Operator = operation
+		}
+		if avus[i].Operator == "" {
+			return fmt.Errorf("AVU with attribute '%s' has no %s and there is no "+
+				"operation argument: %w", avus[i].Attribute, parsing.JSON_OPERATOR_KEY,
+				ErrMissingArgument)
+		}
+		if avus[i].Operator == parsing.JSON_ARG_META_ADD && avus[i].Units == "" {
+			avus[i].Units = defaultUnits
+		}
 	}
+	return nil
+}
 
-	defer filesystem.Release()
-	logger.Info().Msgf("%s %v to %s", operation, meta, iPath)
+// validMetaModOperation returns true if operation is one that MetaMod performs.
+func validMetaModOperation(operation string) bool {
+	return operation == parsing.JSON_ARG_META_ADD || operation == parsing.JSON_ARG_META_REM ||
+		operation == parsing.JSON_ARG_META_UNITS
+}
 
+// parseAVU returns the AVU described by an element of an avus list, including
+// its metamod operator, if it has one.
+func parseAVU(logger zerolog.Logger, metaInterface interface{}) (avu AVU, err error) {
+	var metaValue map[string]interface{}
+	if err = parsing.ExtractJSONValue(logger, metaInterface, &metaValue); err != nil {
+		return avu, err
+	}
+	if avu.Attribute, avu.Value, avu.Units, err = parsing.GetAVUValues(logger, metaValue); err != nil {
+		return avu, err
+	}
+	if avu.Operator, err = parsing.GetAVUOperator(logger, metaValue); err != nil {
+		return avu, err
+	}
+	return avu, nil
+}
+
+// parseAVUs returns the AVUs described by an avus list.
+func parseAVUs(logger zerolog.Logger, meta []interface{}) (avus []AVU, err error) {
 	for _, metaInterface := range meta {
-		var metaValue map[string]interface{}
-		if err = parsing.ExtractJSONValue(logger, metaInterface, &metaValue); err != nil {
+		var avu AVU
+		if avu, err = parseAVU(logger, metaInterface); err != nil {
+			return nil, err
+		}
+		avus = append(avus, avu)
+	}
+	return avus, nil
+}
+
+// applyAVU performs a metamod operation with a single AVU on the collection or
+// data object at iPath.
+func applyAVU(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	coll bool, operation string, avu AVU) (err error) {
+	attr, value, units := avu.Attribute, avu.Value, avu.Units
+	if operation == parsing.JSON_ARG_META_ADD && value != "" {
+		if err = filesystem.AddMetadata(iPath, attr, value, units); err != nil {
+			logger.Err(err).Msgf("Error adding metadata attribute: %s, value: %s, units: %s", attr, value, units)
 			return err
 		}
-		var attr, value, units string
-		if attr, value, units, err = parsing.GetAVUValues(logger, metaValue); err != nil {
+		logger.Debug().Msgf("Added attribute: %s, value: %s, units: %s to %s", attr, value, units, iPath)
+	} else if operation == parsing.JSON_RM_OP || operation == parsing.JSON_ARG_META_REM {
+		if err = filesystem.DeleteMetadataByName(iPath, attr); err != nil {
+			logger.Err(err).Msgf("Error removing metadata attribute: %s", attr)
 			return err
 		}
-		if operation == parsing.JSON_ARG_META_ADD && value != "" {
-			if err = filesystem.AddMetadata(iPath, attr, value, units); err != nil {
-				logger.Err(err).Msg("Error adding metadata attribute: %s, value: %s, units: %s")
-				return err
-			}
-			logger.Debug().Msgf("Added attribute: %s, value: %s, units: %s to %s", attr, value, units, iPath)
-		} else if operation == parsing.JSON_RM_OP || operation == parsing.JSON_ARG_META_REM {
-			if err = filesystem.DeleteMetadataByName(iPath, attr); err != nil {
-				logger.Err(err).Msg("Error removing metadata attribute: %s, value: %s, units: %s")
-				return err
-			}
-			logger.Debug().Msgf("Removed attribute: %s from %s", attr, iPath)
-		} else if value == "" {
-			return parsing.ErrMissingKey
+		logger.Debug().Msgf("Removed attribute: %s from %s", attr, iPath)
+	} else if operation == parsing.JSON_ARG_META_UNITS && value != "" {
+		if err = modifyUnits(logger, filesystem, iPath, coll, attr, value, units); err != nil {
+			return err
+		}
+	} else if value == "" {
+		return parsing.ErrMissingKey
+	}
+	return nil
+}
+
+// modifyUnits sets the units of the existing AVU with the given attribute and
+// value, using a single iRODS metadata modify request so that the AVU is never
+// absent. It is an error if there is no such AVU.
+func modifyUnits(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	coll bool, attr string, value string, units string) (err error) {
+	var metas []*types.IRODSMeta
+	var conn *connection.IRODSConnection
+
+	if metas, err = filesystem.ListMetadata(iPath); err != nil {
+		return err
+	}
+
+	var existing *types.IRODSMeta
+	for _, meta := range metas {
+		if meta.Name == attr && meta.Value == value {
+			existing = meta
+			break
 		}
 	}
+	if existing == nil {
+		return fmt.Errorf("no AVU with attribute '%s' and value '%s' on %s: %w",
+			attr, value, iPath, ErrInvalidArgument)
+	}
+	if existing.Units == units {
+		logger.Debug().Msgf("Units of attribute: %s, value: %s on %s are already '%s'",
+			attr, value, iPath, units)
+		return nil
+	}
+
+	itemType := types.IRODSDataObjectMetaItemType
+	if coll {
+		itemType = types.IRODSCollectionMetaItemType
+	}
+	request := message.NewIRODSMessageReplaceMetadataRequest(itemType, iPath, existing,
+		&types.IRODSMeta{Name: attr, Value: value, Units: units})
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	response := message.IRODSMessageModifyMetadataResponse{}
+	if err = conn.RequestAndCheck(request, &response, nil); err != nil {
+		return err
+	}
+	logger.Debug().Msgf("Changed units of attribute: %s, value: %s on %s from '%s' to '%s'",
+		attr, value, iPath, existing.Units, units)
+
 	return nil
 }
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+func TestResolveAVUsDefaultUnits(t *testing.T) {
+	add, rem := parsing.JSON_ARG_META_ADD, parsing.JSON_ARG_META_REM
+
+	tests := []struct {
+		name         string
+		avus         []AVU
+		operation    string
+		defaultUnits string
+		want         []AVU
+	}{
+		{"no default units",
+			[]AVU{{Attribute: "a", Value: "1"}}, add, "",
+			[]AVU{{Attribute: "a", Value: "1", Operator: add}}},
+		{"default units added",
+			[]AVU{{Attribute: "a", Value: "1"}}, add, "mm",
+			[]AVU{{Attribute: "a", Value: "1", Units: "mm", Operator: add}}},
+		{"own units take precedence",
+			[]AVU{{Attribute: "a", Value: "1", Units: "cm"}}, add, "mm",
+			[]AVU{{Attribute: "a", Value: "1", Units: "cm", Operator: add}}},
+		{"not given to removals",
+			[]AVU{{Attribute: "a", Value: "1"}}, rem, "mm",
+			[]AVU{{Attribute: "a", Value: "1", Operator: rem}}},
+		{"own operator decides",
+			[]AVU{{Attribute: "a", Value: "1", Operator: add},
+				{Attribute: "b", Value: "2", Operator: rem},
+				{Attribute: "c", Value: "3"}},
+			rem, "mm",
+			[]AVU{{Attribute: "a", Value: "1", Units: "mm", Operator: add},
+				{Attribute: "b", Value: "2", Operator: rem},
+				{Attribute: "c", Value: "3", Operator: rem}}},
+		{"mixed units",
+			[]AVU{{Attribute: "a", Value: "1"}, {Attribute: "b", Value: "2", Units: "kg"}},
+			add, "mm",
+			[]AVU{{Attribute: "a", Value: "1", Units: "mm", Operator: add},
+				{Attribute: "b", Value: "2", Units: "kg", Operator: add}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			avus := slices.Clone(test.avus)
+			if err := resolveAVUs(avus, test.operation, test.defaultUnits); err != nil {
+				t.Fatalf("resolveAVUs() error = %v", err)
+			}
+			if !slices.Equal(avus, test.want) {
+				t.Errorf("resolveAVUs() = %+v, want %+v", avus, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveAVUsMissingOperator(t *testing.T) {
+	avus := []AVU{{Attribute: "a", Value: "1"}}
+	if err := resolveAVUs(avus, "", "mm"); !errors.Is(err, ErrMissingArgument) {
+		t.Errorf("resolveAVUs() error = %v, want %v", err, ErrMissingArgument)
+	}
+}
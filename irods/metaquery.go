@@ -18,28 +18,34 @@
 package irods
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"path"
+	"strings"
 
-	"github.com/cyverse/go-irodsclient/fs"
 	"github.com/cyverse/go-irodsclient/irods/common"
 	"github.com/cyverse/go-irodsclient/irods/connection"
 	"github.com/cyverse/go-irodsclient/irods/message"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
-	"github.com/wtsi-npg/go-baton/appInfo"
 	"github.com/wtsi-npg/go-baton/parsing"
 )
 
 func BuildMetaQuery(logger zerolog.Logger, avus []interface{},
-	columns parsing.MetaQueryColumns, zone string) (
+	columns parsing.MetaQueryColumns, zone string, keywords map[string]string,
+	ignoreCase bool) (
 	request *message.IRODSMessageQueryRequest, err error,
 ) {
-	var attr, op, val string
+	var attr, op, val, units string
 
-	query := message.NewIRODSMessageQueryRequest(common.MaxQueryRows, 0, 0, 0)
+	query := newQuery()
+	if ignoreCase {
+		query.Options |= upperCaseWhere
+	}
 	query.AddKeyVal(common.ZONE_KW, zone)
+	if err = addQueryKeywords(query, keywords); err != nil {
+		return nil, err
+	}
 	for _, column := range columns.ReturnColumns {
 		query.AddSelect(column, 1)
 	}
@@ -49,131 +55,329 @@ func BuildMetaQuery(logger zerolog.Logger, avus []interface{},
 		if err := parsing.ExtractJSONValue(logger, avu, &avujson); err != nil {
 			return nil, err
 		}
-		if attr, val, op, err = parsing.GetAVUQuery(logger, avujson); err != nil {
+		if attr, val, units, op, err = parsing.GetAVUQuery(logger, avujson); err != nil {
+			return nil, err
+		}
+		if ignoreCase {
+			attr, val, units = strings.ToUpper(attr), strings.ToUpper(val), strings.ToUpper(units)
+		}
+
+		var attrCond, valueCond string
+		if attrCond, err = valueCondition("=", attr); err != nil {
+			return nil, err
+		}
+		if valueCond, err = valueCondition(op, val); err != nil {
 			return nil, err
 		}
+		query.AddCondition(columns.AttributeCondition, attrCond)
+		query.AddCondition(columns.ValueCondition, valueCond)
 
-		attrCondition := fmt.Sprintf("= '%s'", attr)
-		valueCondition := fmt.Sprintf("%s '%s'", op, val)
-		query.AddCondition(columns.AttributeCondition, attrCondition)
-		query.AddCondition(columns.ValueCondition, valueCondition)
+		// Units are optional; a condition without them matches any units
+		if units != "" {
+			var unitsCond string
+			if unitsCond, err = valueCondition("=", units); err != nil {
+				return nil, err
+			}
+			query.AddCondition(columns.UnitsCondition, unitsCond)
+		}
 	}
 	return query, nil
 }
 
+// MetaQueryOptions are the options of MetaQuery.
+type MetaQueryOptions struct {
+	Zone        string // Zone to query, or empty for that of the connected server
+	AllZones    bool   // Query every zone known to the server
+	Collections bool   // Find collections
+	Objects     bool   // Find data objects
+	Count       bool   // Report only the number of matches
+	IgnoreCase  bool   // Match attributes and values regardless of case
+	Sort        string // Field by which to sort the matches, or empty
+}
+
+// MetaQuery finds the collections and/or data objects whose metadata match all
+// the AVU conditions in jsonContents, in options.Zone. If AllZones is true, the
+// query is instead made in every zone known to the server, including federated
+// zones, and each match is tagged with the zone it was found in. A zone that
+// cannot be reached is skipped with a warning, along with any matches it gave
+// before failing, but any other error fails the query at once, as does finding
+// that no zone could be reached.
+//
+// A condition that gives units matches only AVUs with those units, compared for
+// equality whatever the operator; one without matches AVUs with any units.
+//
+// If Count is true, only the number of matches is reported and the matches
+// themselves are not kept.
+//
+// The input may also give extra genquery keywords, as a keywords object, which
+// are added to each query. Only those allowed by queryKeywords are accepted.
+//
+// The input may also, or instead of AVUs, give an owner, as user or user#zone,
+// to match only the collections and data objects that user owns.
+//
+// If IgnoreCase is true, attributes, values and owners are matched regardless
+// of case, with any operator.
+//
+// The matches are sorted by Sort, which is one of path, size or modified time,
+// or are left in the order the server returns them if Sort is empty. Sorting is
+// done once all the matches have been found. A match with several replicas is
+// reported once, sorted by the size or modified time of any one of them.
 func MetaQuery(logger zerolog.Logger, account *types.IRODSAccount,
-	jsonContents map[string]interface{}, zone string, collections bool,
-	objects bool) (err error) {
+	jsonContents map[string]interface{}, options MetaQueryOptions) (
+	result *OperationResult, err error) {
 	var avus []interface{}
+	var keywords map[string]string
+	var owner queryOwner
 	var conn *connection.IRODSConnection
-	var query *message.IRODSMessageQueryRequest
-	var response, jsonOut []interface{}
-
-	if !collections && !objects {
-		//To match behaviour of baton
-		collections = true
-		objects = true
-	}
-	//if account.ClientZone != zone {
-	//	logger.Debug().Msgf("Changing zone from %s to %s", account.ClientZone, zone)
-	//	if account, err = types.CreateIRODSAccount(
-	//		account.Host, account.Port, account.ClientUser,
-	//		zone, account.AuthenticationScheme, account.Password,
-	//		account.DefaultResource); err != nil {
-	//		return err
-	//	}
-	//}
+
+	if err = parsing.Validate(parsing.JSON_METAQUERY_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if !options.Collections && !options.Objects {
+		return nil, fmt.Errorf("metaquery must be told what to search; set %s, %s or both: %w",
+			parsing.JSON_OP_COLLECTION, parsing.JSON_OP_OBJECT, ErrMissingArgument)
+	}
+	if err = checkSortField(options.Sort); err != nil {
+		return nil, err
+	}
 
 	if avus, err = parsing.GetAVUsList(logger, jsonContents); err != nil {
-		return err
+		return nil, err
+	}
+	if owner.name, owner.zone, err = parsing.GetOwnerQuery(logger, jsonContents); err != nil &&
+		!errors.Is(err, parsing.ErrMissingKey) {
+		return nil, err
+	}
+	if keywords, err = parsing.GetQueryKeywords(logger, jsonContents); err != nil {
+		return nil, err
 	}
+	if err = checkQueryKeywords(keywords); err != nil {
+		return nil, err
+	}
+
+	result = &OperationResult{Operation: parsing.JSON_METAQUERY_OP}
 
-	filesystem, err := fs.NewFileSystemWithDefault(account, appInfo.Name)
+	filesystem, err := newFileSystem(logger, account)
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	defer filesystem.Release()
+	defer releaseFileSystem(filesystem)
 
-	if conn, err = filesystem.GetMetadataConnection(); err != nil {
-		return err
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
 	}
 
+	defer filesystem.ReturnMetadataConnection(conn)
+
 	conn.Lock()
 
 	defer conn.Unlock()
 
-	if collections {
-		collectionColumns := parsing.MetaQueryColumns{
-			AttributeCondition: common.ICAT_COLUMN_META_COLL_ATTR_NAME,
-			ValueCondition:     common.ICAT_COLUMN_META_COLL_ATTR_VALUE,
-			ReturnColumns:      []common.ICATColumnNumber{common.ICAT_COLUMN_COLL_NAME},
-			JSONKeys:           []string{parsing.JSON_COLLECTION_KEY},
+	var matches []metaQueryMatch
+	matchCount := 0
+	collect := func(zone string, tag bool) func(match metaQueryMatch) {
+		return func(match metaQueryMatch) {
+			matchCount++
+			if options.Count {
+				return
+			}
+			if tag {
+				match.json[parsing.JSON_ZONE_KEY] = zone
+			}
+			matches = append(matches, match)
 		}
-		if query, err = BuildMetaQuery(logger, avus, collectionColumns, zone); err != nil {
-			return err
+	}
+
+	if !options.AllZones {
+		if err = metaQueryZone(logger, conn, avus, owner, keywords, options.IgnoreCase, options.Zone,
+			options.Collections, options.Objects, options.Sort, collect(options.Zone, false)); err != nil {
+			return result, err
 		}
-		queryResult := message.IRODSMessageQueryResponse{}
-		if err := conn.Request(query, &queryResult, nil); err != nil {
-			logger.Err(err).Msg("Error while querying iRODS")
-			return err
+	} else {
+		var zones []string
+		if zones, err = listZones(logger, conn); err != nil {
+			return result, err
 		}
-
-		err = queryResult.CheckError()
-		if err != nil {
-			if types.GetIRODSErrorCode(err) == common.CAT_NO_ROWS_FOUND {
-				logger.Info().Msgf("No collections found with metadata: %s", avus)
-			} else {
-				logger.Err(err).Msg("Error while querying iRODS")
-				return err
+		var skipped error
+		queried := 0
+		for _, z := range zones {
+			nMatches, nCount := len(matches), matchCount
+			if err = metaQueryZone(logger, conn, avus, owner, keywords, options.IgnoreCase, z,
+				options.Collections, options.Objects, options.Sort, collect(z, true)); err != nil {
+				if !zoneUnavailable(err) {
+					return result, err
+				}
+				logger.Warn().Err(err).Msgf("Skipping zone %s, which could not be reached", z)
+				matches, matchCount = matches[:nMatches], nCount
+				skipped = err
+				continue
 			}
-		} else if queryResult.RowCount == 0 {
-			logger.Info().Msgf("No collections found with metadata: %s", avus)
+			queried++
 		}
+		if queried == 0 && skipped != nil {
+			return result, fmt.Errorf("none of the zones %v could be reached: %w", zones, skipped)
+		}
+	}
 
-		if response, err = parsing.IRODSXMLToJSON(logger, queryResult, collectionColumns); err != nil {
-			return err
+	if options.Count {
+		result.Count = &matchCount
+	} else {
+		sortByField(matches, options.Sort, func(match metaQueryMatch) sortKey {
+			return match.key
+		})
+		jsonOut := make([]interface{}, 0, len(matches))
+		for _, match := range matches {
+			jsonOut = append(jsonOut, match.json)
 		}
-		jsonOut = append(jsonOut, response...)
+		result.Result = jsonOut
+	}
+	result.Success = true
+	return result, nil
+}
+
+// zoneUnavailableCodes are the iRODS error codes reporting that a federated zone
+// could not be reached or would not accept a query from the server.
+var zoneUnavailableCodes = map[common.ErrorCode]bool{
+	common.CROSS_ZONE_SOCK_CONNECT_ERR:          true,
+	common.REMOTE_SERVER_AUTHENTICATION_FAILURE: true,
+	common.REMOTE_SERVER_AUTH_EMPTY:             true,
+	common.REMOTE_SERVER_AUTH_NOT_PROVIDED:      true,
+	common.REMOTE_SERVER_SID_NOT_DEFINED:        true,
+	common.SYS_SOCK_CONNECT_ERR:                 true,
+	common.SYS_SOCK_READ_TIMEDOUT:               true,
+	common.SYS_SVR_TO_SVR_CONNECT_FAILED:        true,
+	common.USER_SOCK_CONNECT_ERR:                true,
+	common.USER_SOCK_CONNECT_TIMEDOUT:           true,
+}
 
+// zoneUnavailable returns true if err reports that a zone could not be reached,
+// rather than that the query itself was at fault.
+func zoneUnavailable(err error) bool {
+	return zoneUnavailableCodes[baseErrorCode(err)]
+}
+
+// metaQueryMatch is a collection or data object found by a metadata query, with
+// the key by which it is sorted.
+type metaQueryMatch struct {
+	json map[string]string
+	key  sortKey
+}
+
+// queryOwner is the owner of the collections and data objects that a metadata
+// query matches, whose name is empty to match any owner.
+type queryOwner struct {
+	name string
+	zone string // Zone of the owner, or empty for any zone
+}
+
+// addConditions adds conditions on the owner columns to a metadata query, if
+// there is an owner.
+func (owner queryOwner) addConditions(query *message.IRODSMessageQueryRequest,
+	columns parsing.MetaQueryColumns, ignoreCase bool) error {
+	if owner.name == "" {
+		return nil
+	}
+	name, zone := owner.name, owner.zone
+	if ignoreCase {
+		name, zone = strings.ToUpper(name), strings.ToUpper(zone)
+	}
+
+	cond, err := valueCondition("=", name)
+	if err != nil {
+		return err
+	}
+	query.AddCondition(columns.OwnerCondition, cond)
+	if zone != "" {
+		if cond, err = valueCondition("=", zone); err != nil {
+			return err
+		}
+		query.AddCondition(columns.OwnerZoneCondition, cond)
 	}
+	return nil
+}
+
+// metaQueryZone runs a metadata query in a single zone on a locked connection,
+// calling fn for each match. If sort needs a value beyond the path of each
+// match, it is also queried, and a match with several replicas is passed to fn
+// only once.
+func metaQueryZone(logger zerolog.Logger, conn *connection.IRODSConnection,
+	avus []interface{}, owner queryOwner, keywords map[string]string, ignoreCase bool, zone string,
+	collections bool, objects bool, sort string,
+	fn func(match metaQueryMatch)) (err error) {
+	var columnSets []parsing.MetaQueryColumns
 
+	if collections {
+		columnSets = append(columnSets, parsing.MetaQueryColumns{
+			AttributeCondition: common.ICAT_COLUMN_META_COLL_ATTR_NAME,
+			ValueCondition:     common.ICAT_COLUMN_META_COLL_ATTR_VALUE,
+			UnitsCondition:     common.ICAT_COLUMN_META_COLL_ATTR_UNITS,
+			OwnerCondition:     common.ICAT_COLUMN_COLL_OWNER_NAME,
+			OwnerZoneCondition: common.ICAT_COLUMN_COLL_OWNER_ZONE,
+			ReturnColumns:      []common.ICATColumnNumber{common.ICAT_COLUMN_COLL_NAME},
+			JSONKeys:           []string{parsing.JSON_COLLECTION_KEY},
+		})
+	}
 	if objects {
-		objectColumns := parsing.MetaQueryColumns{
+		columnSets = append(columnSets, parsing.MetaQueryColumns{
 			AttributeCondition: common.ICAT_COLUMN_META_DATA_ATTR_NAME,
 			ValueCondition:     common.ICAT_COLUMN_META_DATA_ATTR_VALUE,
+			UnitsCondition:     common.ICAT_COLUMN_META_DATA_ATTR_UNITS,
+			OwnerCondition:     common.ICAT_COLUMN_D_OWNER_NAME,
+			OwnerZoneCondition: common.ICAT_COLUMN_D_OWNER_ZONE,
 			ReturnColumns:      []common.ICATColumnNumber{common.ICAT_COLUMN_COLL_NAME, common.ICAT_COLUMN_DATA_NAME},
 			JSONKeys:           []string{parsing.JSON_COLLECTION_KEY, parsing.JSON_DATA_OBJECT_KEY},
-		}
-		if query, err = BuildMetaQuery(logger, avus, objectColumns, zone); err != nil {
+		})
+	}
+
+	for _, columns := range columnSets {
+		var query *message.IRODSMessageQueryRequest
+
+		if query, err = BuildMetaQuery(logger, avus, columns, zone, keywords, ignoreCase); err != nil {
 			return err
 		}
-		queryResult := message.IRODSMessageQueryResponse{}
-		if err := conn.Request(query, &queryResult, nil); err != nil {
-			logger.Err(err).Msg("Error while querying iRODS")
+		if err = owner.addConditions(query, columns, ignoreCase); err != nil {
 			return err
 		}
+		objectColumns := len(columns.JSONKeys) > 1
+		sortCol := sortColumn(sort, objectColumns)
+		if sortCol != 0 {
+			query.AddSelect(sortCol, selectNormal)
+		}
 
-		err = queryResult.CheckError()
-		if err != nil {
-			if types.GetIRODSErrorCode(err) == common.CAT_NO_ROWS_FOUND {
-				logger.Info().Msgf("No data objects found with metadata: %s", avus)
-			} else {
-				logger.Err(err).Msg("Error while querying iRODS")
-				return err
+		found := 0
+		seen := make(map[string]bool)
+		if err = forEachRow(logger, conn, query, func(row []string) error {
+			match := metaQueryMatch{json: make(map[string]string, len(columns.JSONKeys))}
+			for i, key := range columns.JSONKeys {
+				match.json[key] = row[i]
+			}
+			match.key.path = row[0]
+			if objectColumns {
+				match.key.path = path.Join(row[0], row[1])
 			}
-		} else if queryResult.RowCount == 0 {
-			logger.Info().Msgf("No data objects found with metadata: %s", avus)
-		}
 
-		if response, err = parsing.IRODSXMLToJSON(logger, queryResult, objectColumns); err != nil {
+			if sortCol != 0 {
+				if seen[match.key.path] {
+					return nil
+				}
+				seen[match.key.path] = true
+				if err := match.key.setSortValue(sort, row[len(columns.JSONKeys)]); err != nil {
+					return err
+				}
+			}
+			fn(match)
+			found++
+			return nil
+		}); err != nil {
 			return err
 		}
-		jsonOut = append(jsonOut, response...)
+		if found == 0 {
+			logger.Info().Msgf("No %s found in zone '%s' with metadata: %s",
+				columns.JSONKeys[len(columns.JSONKeys)-1], zone, avus)
+		}
 	}
 
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.Encode(jsonOut)
-
 	return nil
 }
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"html"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+func TestZoneUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{types.NewIRODSError(common.SYS_SVR_TO_SVR_CONNECT_FAILED), true},
+		{types.NewIRODSError(common.CROSS_ZONE_SOCK_CONNECT_ERR - 111), true},
+		{types.NewIRODSError(common.REMOTE_SERVER_AUTHENTICATION_FAILURE), true},
+		{types.NewIRODSError(common.CAT_INVALID_ARGUMENT), false},
+		{types.NewIRODSError(common.CAT_SQL_ERR), false},
+		{ErrInvalidArgument, false},
+		{errors.New("genquery keyword 'zone' is not allowed"), false},
+	}
+	for _, test := range tests {
+		if got := zoneUnavailable(test.err); got != test.want {
+			t.Errorf("zoneUnavailable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestBuildMetaQuery(t *testing.T) {
+	columns := parsing.MetaQueryColumns{
+		AttributeCondition: common.ICAT_COLUMN_META_DATA_ATTR_NAME,
+		ValueCondition:     common.ICAT_COLUMN_META_DATA_ATTR_VALUE,
+		UnitsCondition:     common.ICAT_COLUMN_META_DATA_ATTR_UNITS,
+		ReturnColumns:      []common.ICATColumnNumber{common.ICAT_COLUMN_DATA_NAME},
+	}
+	attr := int(columns.AttributeCondition)
+	value := int(columns.ValueCondition)
+	units := int(columns.UnitsCondition)
+
+	type condition struct {
+		column int
+		cond   string
+	}
+	tests := []struct {
+		name       string
+		avu        map[string]interface{}
+		ignoreCase bool
+		want       []condition
+		err        error
+	}{
+		{"attribute with a space",
+			map[string]interface{}{"attribute": "sample name", "value": "s 1"}, false,
+			[]condition{{attr, "= 'sample name'"}, {value, "= 's 1'"}}, nil},
+		{"value with a genquery keyword",
+			map[string]interface{}{"attribute": "study", "value": "x and y%", "operator": "like"},
+			false, []condition{{attr, "= 'study'"}, {value, "like 'x and y%'"}}, nil},
+		{"units",
+			map[string]interface{}{"attribute": "dose", "value": "5", "units": "mg"}, false,
+			[]condition{{attr, "= 'dose'"}, {value, "= '5'"}, {units, "= 'mg'"}}, nil},
+		{"ignoring case",
+			map[string]interface{}{"attribute": "sample name", "value": "s1"}, true,
+			[]condition{{attr, "= 'SAMPLE NAME'"}, {value, "= 'S1'"}}, nil},
+		{"attribute with a quote",
+			map[string]interface{}{"attribute": "sample's name", "value": "s1"}, false,
+			nil, ErrInvalidArgument},
+		{"value with a quote",
+			map[string]interface{}{"attribute": "sample", "value": "' || like '%"}, false,
+			nil, ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := BuildMetaQuery(zerolog.Nop(), []interface{}{test.avu}, columns,
+				"testZone", nil, test.ignoreCase)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("BuildMetaQuery() error = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			// The conditions are held XML escaped, as sent to the server
+			var got []condition
+			for i, key := range query.Conditions.Keys {
+				got = append(got, condition{key, html.UnescapeString(query.Conditions.Values[i].Value)})
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("BuildMetaQuery() conditions = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestMetaQueryAttributeWithSpace adds an AVU whose attribute and value contain
+// spaces with MetaMod and finds it again with MetaQuery.
+func TestMetaQueryAttributeWithSpace(t *testing.T) {
+	account := testAccount(t)
+	coll := testCollection(t, account)
+	logger := zerolog.Nop()
+
+	avu := map[string]interface{}{"attribute": "sample name", "value": "sample " + path.Base(coll)}
+	if _, err := MetaMod(logger, account, map[string]interface{}{
+		"collection": coll, "avus": []interface{}{avu}}, parsing.JSON_ARG_META_ADD, ""); err != nil {
+		t.Fatalf("MetaMod() error = %v", err)
+	}
+
+	result, err := MetaQuery(logger, account, map[string]interface{}{
+		"avus": []interface{}{avu}}, MetaQueryOptions{Collections: true})
+	if err != nil {
+		t.Fatalf("MetaQuery() error = %v", err)
+	}
+	matches, _ := result.Result.([]interface{})
+	if len(matches) != 1 {
+		t.Fatalf("MetaQuery() found %v, want only %s", matches, coll)
+	}
+	if match, _ := matches[0].(map[string]interface{}); match[parsing.JSON_COLLECTION_KEY] != coll {
+		t.Errorf("MetaQuery() found %v, want %s", match, coll)
+	}
+}
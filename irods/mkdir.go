@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// MakeCollection creates a collection, along with any of its parents that do not
+// exist. Like mkdir -p, a collection that already exists is left as it is and
+// reported as a success, so that a script creating collections may be run again.
+// If strict is true, an existing collection is instead an error wrapping
+// ErrAlreadyExists.
+//
+// The result reports the path of the collection and whether ACL inheritance is
+// enabled on it, so that the caller knows which ACLs its contents will receive.
+func MakeCollection(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, strict bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+
+	if err = parsing.Validate(parsing.JSON_MKCOLL_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("mkdir requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_MKCOLL_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	exists := filesystem.ExistsDir(iPath)
+	if !exists {
+		// The collection may be created by another client between the check and
+		// the request, in which case the server reports that it exists
+		if err = filesystem.MakeDir(iPath, true); err != nil {
+			if !collectionExists(err) {
+				logger.Err(err).Msgf("Error while creating collection %s", iPath)
+				return result, err
+			}
+			exists = true
+		}
+	}
+
+	if exists {
+		if strict {
+			return result, fmt.Errorf("collection %s: %w", iPath, ErrAlreadyExists)
+		}
+		logger.Info().Msgf("Collection %s already exists", iPath)
+	} else {
+		logger.Debug().Msgf("Created collection %s", iPath)
+	}
+
+	var inheritance *types.IRODSAccessInheritance
+	if inheritance, err = filesystem.GetDirACLInheritance(iPath); err != nil {
+		logger.Err(err).Msgf("Error while getting the ACL inheritance of %s", iPath)
+		return result, err
+	}
+	result.Inheritance = &inheritance.Inheritance
+
+	result.Success = true
+	return result, nil
+}
+
+// collectionExists returns true if err reports that a collection could not be
+// created because it already exists.
+func collectionExists(err error) bool {
+	return types.IsFileAlreadyExistError(err) ||
+		baseErrorCode(err) == common.CAT_NAME_EXISTS_AS_COLLECTION
+}
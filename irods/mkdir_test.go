@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+func TestCollectionExists(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"already exists", types.NewFileAlreadyExistError("/zone/coll"), true},
+		{"name exists as collection", types.NewIRODSError(common.CAT_NAME_EXISTS_AS_COLLECTION), true},
+		{"name exists as collection with sub-code",
+			types.NewIRODSError(common.CAT_NAME_EXISTS_AS_COLLECTION - 2), true},
+		{"wrapped", fmt.Errorf("mkdir: %w",
+			types.NewIRODSError(common.CAT_NAME_EXISTS_AS_COLLECTION)), true},
+		{"name exists as data object", types.NewIRODSError(common.CAT_NAME_EXISTS_AS_DATAOBJ), false},
+		{"no permission", types.NewIRODSError(common.CAT_NO_ACCESS_PERMISSION), false},
+		{"other", errors.New("other"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := collectionExists(test.err); got != test.want {
+				t.Errorf("collectionExists() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMakeCollectionTwice(t *testing.T) {
+	account := testAccount(t)
+	coll := path.Join(testCollection(t, account), "a", "b")
+	input := map[string]interface{}{"collection": coll}
+
+	tests := []struct {
+		name   string
+		strict bool
+		want   error
+	}{
+		{"create", false, nil},
+		{"create again", false, nil},
+		{"create again strictly", true, ErrAlreadyExists},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := MakeCollection(zerolog.Nop(), account, input, test.strict)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("MakeCollection() error = %v, want %v", err, test.want)
+			}
+			if result.Success != (test.want == nil) {
+				t.Errorf("MakeCollection() success = %v, want %v", result.Success, test.want == nil)
+			}
+			if test.want == nil && result.Inheritance == nil {
+				t.Errorf("MakeCollection() inheritance not reported")
+			}
+		})
+	}
+}
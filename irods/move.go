@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	irods_fs "github.com/cyverse/go-irodsclient/irods/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Move moves, or renames, a data object or collection to destination on the
+// server. If destination is an existing collection, the source is moved inside
+// it, keeping its name. iRODS keeps the metadata and ACLs of what it moves.
+//
+// However, a move into a collection with ACL inheritance may leave the moved
+// path with other access than it had. If preserveACLs is true, the ACLs of the
+// source are recorded before the move and any that the destination no longer
+// has at the same or a higher level are applied to it again afterwards. Access
+// granted by the destination collection is left in place. Only the moved path
+// itself is checked, not the contents of a collection, since iRODS does not
+// apply inheritance to existing contents.
+func Move(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, destination string, preserveACLs bool) (
+	result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+	var accesses []*types.IRODSAccess
+
+	defer func() { err = classifyError(err) }()
+
+	if err = parsing.Validate(parsing.JSON_MOVE_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if destination == "" {
+		return nil, fmt.Errorf("move requires a destination %s argument: %w",
+			parsing.JSON_OP_PATH, ErrMissingArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_MOVE_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return result, err
+	}
+	if filesystem.ExistsDir(destination) {
+		destination = path.Join(destination, entry.Name)
+	}
+	result.Destination = destination
+
+	if preserveACLs {
+		if accesses, err = filesystem.ListACLs(iPath); err != nil {
+			return result, err
+		}
+	}
+
+	logger.Info().Msgf("Moving %s to %s", iPath, destination)
+
+	if entry.IsDir() {
+		err = filesystem.RenameDirToDir(iPath, destination)
+	} else {
+		err = filesystem.RenameFileToFile(iPath, destination)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Transferred++
+
+	if preserveACLs {
+		if err = restoreACLs(logger, filesystem, destination, entry.IsDir(), accesses); err != nil {
+			return result, fmt.Errorf("moved %s to %s, but failed to restore its ACLs: %w",
+				iPath, destination, err)
+		}
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// accessLevels are the iRODS access levels, lowest first, in the order of the
+// numbers by which the server ranks them.
+var accessLevels = []types.IRODSAccessLevelType{
+	types.IRODSAccessLevelNull,
+	types.IRODSAccessLevelExecute,
+	types.IRODSAccessLevelReadAnnotation,
+	types.IRODSAccessLevelReadSystemMetadata,
+	types.IRODSAccessLevelReadMetadata,
+	types.IRODSAccessLevelReadObject,
+	types.IRODSAccessLevelWriteAnnotation,
+	types.IRODSAccessLevelCreateMetadata,
+	types.IRODSAccessLevelModifyMetadata,
+	types.IRODSAccessLevelDeleteMetadata,
+	types.IRODSAccessLevelAdministerObject,
+	types.IRODSAccessLevelCreateObject,
+	types.IRODSAccessLevelModifyObject,
+	types.IRODSAccessLevelDeleteObject,
+	types.IRODSAccessLevelCreateToken,
+	types.IRODSAccessLevelDeleteToken,
+	types.IRODSAccessLevelCurate,
+	types.IRODSAccessLevelOwner,
+}
+
+// aclsToRestore returns those of accesses that current, the ACLs of a moved
+// path, grants only at a lower level or not at all. An ACL that current grants
+// at a higher level, such as one given by inheritance from the destination, is
+// left alone rather than downgraded.
+func aclsToRestore(accesses []*types.IRODSAccess, current []*types.IRODSAccess) (
+	restore []*types.IRODSAccess) {
+	levels := make(map[string]int, len(current))
+	for _, access := range current {
+		levels[access.UserName+"#"+access.UserZone] = slices.Index(accessLevels, access.AccessLevel)
+	}
+	for _, access := range accesses {
+		level, ok := levels[access.UserName+"#"+access.UserZone]
+		if ok && level >= slices.Index(accessLevels, access.AccessLevel) {
+			continue
+		}
+		restore = append(restore, access)
+	}
+	return restore
+}
+
+// restoreACLs applies to iPath again any of accesses that it no longer has at
+// the same or a higher level.
+func restoreACLs(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	coll bool, accesses []*types.IRODSAccess) (err error) {
+	var current []*types.IRODSAccess
+	var conn *connection.IRODSConnection
+
+	if current, err = filesystem.ListACLs(iPath); err != nil {
+		return err
+	}
+	restore := aclsToRestore(accesses, current)
+	if len(restore) == 0 {
+		return nil
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	// Not locked here; the irods_fs access functions lock the connection themselves
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	for _, access := range restore {
+		if coll {
+			err = irods_fs.ChangeCollectionAccess(conn, iPath, access.AccessLevel,
+				access.UserName, access.UserZone, false, false)
+		} else {
+			err = irods_fs.ChangeDataObjectAccess(conn, iPath, access.AccessLevel,
+				access.UserName, access.UserZone, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	logger.Info().Msgf("Restored %d of %d ACLs of %s changed by its move",
+		len(restore), len(accesses), iPath)
+
+	return nil
+}
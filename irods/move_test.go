@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func TestACLsToRestore(t *testing.T) {
+	access := func(user, zone string, level types.IRODSAccessLevelType) *types.IRODSAccess {
+		return &types.IRODSAccess{UserName: user, UserZone: zone, AccessLevel: level}
+	}
+	tests := []struct {
+		name     string
+		accesses []*types.IRODSAccess
+		current  []*types.IRODSAccess
+		want     []string
+	}{
+		{
+			name:     "unchanged ACL skipped",
+			accesses: []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelReadObject)},
+			current:  []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelReadObject)},
+		},
+		{
+			name:     "higher inherited ACL not downgraded",
+			accesses: []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelReadObject)},
+			current:  []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelOwner)},
+		},
+		{
+			name:     "lower ACL restored",
+			accesses: []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelModifyObject)},
+			current:  []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelReadObject)},
+			want:     []string{"public#testZone"},
+		},
+		{
+			name:     "missing ACL restored",
+			accesses: []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelReadObject)},
+			want:     []string{"public#testZone"},
+		},
+		{
+			name:     "same user of another zone restored",
+			accesses: []*types.IRODSAccess{access("public", "otherZone", types.IRODSAccessLevelReadObject)},
+			current:  []*types.IRODSAccess{access("public", "testZone", types.IRODSAccessLevelOwner)},
+			want:     []string{"public#otherZone"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, access := range aclsToRestore(test.accesses, test.current) {
+				got = append(got, access.UserName+"#"+access.UserZone)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("aclsToRestore() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"time"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// Ping checks that the iRODS server can be reached and the account can
+// authenticate, by connecting and stating the user's home collection. It returns
+// the outcome and the round-trip latency, to be written as JSON, whether or not
+// the check succeeds, along with any error so that failure can be detected from
+// the exit status. On success, the release and API versions of the server are
+// also reported.
+func Ping(logger zerolog.Logger, account *types.IRODSAccount) (
+	jsonOut map[string]interface{}, err error) {
+	home := HomeCollection(account)
+	jsonOut = map[string]interface{}{
+		"host": account.Host,
+		"port": account.Port,
+		"zone": account.ClientZone,
+		"user": account.ClientUser,
+		"path": home,
+	}
+
+	start := time.Now()
+	version, err := ping(logger, account, home)
+	latency := time.Since(start)
+
+	jsonOut["ok"] = err == nil
+	jsonOut["latency_ms"] = float64(latency.Microseconds()) / 1000
+	if version != nil {
+		jsonOut["server_version"] = version.ReleaseVersion
+		jsonOut["api_version"] = version.APIVersion
+	}
+	if err != nil {
+		logger.Err(err).Msg("Ping failed")
+		jsonOut["error"] = err.Error()
+	} else {
+		logger.Debug().Dur("latency", latency).Msg("Ping succeeded")
+	}
+
+	return jsonOut, err
+}
+
+// ping stats a collection, returning the versions that the server reported on
+// connecting.
+func ping(logger zerolog.Logger, account *types.IRODSAccount, path string) (*types.IRODSVersion, error) {
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if _, err = filesystem.StatDir(path); err != nil {
+		return nil, err
+	}
+	return filesystem.GetServerVersion()
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourcePool assigns uploads to a set of equivalent resources in turn, to
+// spread the load across them rather than sending it all to one. A nil pool
+// assigns every upload to the default resource.
+type ResourcePool struct {
+	resources []string
+	next      int
+}
+
+// NewResourcePool returns a pool of the named resources, which are assigned in
+// the order given. An empty list of names gives a nil pool.
+func NewResourcePool(resources []string) (*ResourcePool, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	for _, resource := range resources {
+		if strings.TrimSpace(resource) == "" {
+			return nil, fmt.Errorf("resource pool %v contains an empty name: %w",
+				resources, ErrInvalidArgument)
+		}
+	}
+	return &ResourcePool{resources: resources}, nil
+}
+
+// Next returns the resource to which to assign the next upload, or an empty
+// string for the default resource.
+func (pool *ResourcePool) Next() string {
+	if pool == nil {
+		return ""
+	}
+	resource := pool.resources[pool.next]
+	pool.next = (pool.next + 1) % len(pool.resources)
+	return resource
+}
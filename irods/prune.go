@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Prune removes the sub-collections of a collection that hold no data objects,
+// directly or in any of their own sub-collections, reporting those removed and
+// their number. The collection itself is kept, even if it is empty. Collections
+// are removed deepest first, each only once it is empty, so that a data object
+// added to one meanwhile stops its removal rather than being removed with it.
+//
+// Since this destroys structure, it is done only if prune is true. If dryRun is
+// true, the collections that would be removed are reported, but none is.
+//
+// Removed collections are moved to the trash, unless noTrash is true, when they
+// are removed permanently.
+func Prune(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, prune bool, dryRun bool, noTrash bool) (
+	result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var empty []string
+
+	if err = parsing.Validate(parsing.JSON_PRUNE_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if !prune && !dryRun {
+		return nil, fmt.Errorf("prune removes collections only if %s is set, "+
+			"or reports them if %s is set: %w", parsing.JSON_OP_PRUNE_EMPTY,
+			parsing.JSON_OP_DRY_RUN, ErrMissingArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("prune requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_PRUNE_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if empty, err = emptyCollections(logger, filesystem, iPath); err != nil {
+		return result, err
+	}
+
+	pruned := []ListEntry{}
+	defer func() {
+		slices.SortFunc(pruned, func(a, b ListEntry) int {
+			return cmp.Compare(a.Collection, b.Collection)
+		})
+		count := len(pruned)
+		result.Count = &count
+		result.Result = pruned
+	}()
+
+	for _, collPath := range empty {
+		if dryRun {
+			logger.Info().Msgf("Would remove empty collection %s", collPath)
+		} else {
+			if err = filesystem.RemoveDir(collPath, false, noTrash); err != nil {
+				logger.Err(err).Msgf("Error while removing collection %s", collPath)
+				return result, err
+			}
+			logger.Info().Msgf("Removed empty collection %s", collPath)
+		}
+		pruned = append(pruned, ListEntry{Collection: collPath})
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// emptyCollections returns the collections beneath root that hold no data
+// objects, directly or beneath them, deepest first.
+func emptyCollections(logger zerolog.Logger, filesystem *fs.FileSystem,
+	root string) (empty []string, err error) {
+	var conn *connection.IRODSConnection
+	var collRows, dataRows [][]string
+	var scope string
+
+	if scope, err = collectionScopeCondition(root); err != nil {
+		return nil, err
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return nil, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	zone := conn.GetAccount().ClientZone
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, zone)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+	if collRows, err = executeQuery(logger, conn, query); err != nil {
+		return nil, err
+	}
+
+	// Selecting a data object column restricts the collections to those holding
+	// data objects, and its maximum gives one row for each
+	query = newQuery()
+	query.AddKeyVal(common.ZONE_KW, zone)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_D_DATA_ID, selectMax)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+	if dataRows, err = executeQuery(logger, conn, query); err != nil {
+		return nil, err
+	}
+
+	colls := make([]string, 0, len(collRows))
+	for _, row := range collRows {
+		colls = append(colls, row[0])
+	}
+	occupied := make([]string, 0, len(dataRows))
+	for _, row := range dataRows {
+		occupied = append(occupied, row[0])
+	}
+
+	empty = findEmpty(root, colls, occupied)
+	logger.Debug().Msgf("Found %d empty collections of %d beneath %s",
+		len(empty), len(colls)-1, root)
+
+	return empty, nil
+}
+
+// findEmpty returns the collections of colls beneath root that neither are nor
+// lie above any of the occupied collections, which hold data objects, deepest
+// first. Any collection not beneath root is dropped, since the scope condition
+// of a query may match sibling collections too, and those must never be pruned.
+func findEmpty(root string, colls []string, occupied []string) (empty []string) {
+	holding := make(map[string]bool)
+	for _, coll := range occupied {
+		if !inCollectionScope(root, coll) {
+			continue
+		}
+		for p := coll; !holding[p]; p = path.Dir(p) {
+			holding[p] = true
+			if p == root || p == "/" {
+				break
+			}
+		}
+	}
+
+	for _, coll := range colls {
+		if coll != root && inCollectionScope(root, coll) && !holding[coll] {
+			empty = append(empty, coll)
+		}
+	}
+	slices.SortFunc(empty, func(a, b string) int {
+		return cmp.Or(cmp.Compare(strings.Count(b, "/"), strings.Count(a, "/")),
+			cmp.Compare(a, b))
+	})
+
+	return empty
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		colls    []string
+		occupied []string
+		want     []string
+	}{
+		{
+			name:  "nothing occupied",
+			root:  "/zone/proj",
+			colls: []string{"/zone/proj", "/zone/proj/a", "/zone/proj/a/b", "/zone/proj/c"},
+			want:  []string{"/zone/proj/a/b", "/zone/proj/a", "/zone/proj/c"},
+		},
+		{
+			name:     "parents of occupied kept",
+			root:     "/zone/proj",
+			colls:    []string{"/zone/proj", "/zone/proj/a", "/zone/proj/a/b", "/zone/proj/c"},
+			occupied: []string{"/zone/proj/a/b"},
+			want:     []string{"/zone/proj/c"},
+		},
+		{
+			name: "siblings matched by wildcard survive",
+			root: "/zone/proj_1",
+			colls: []string{"/zone/proj_1", "/zone/proj_1/empty",
+				"/zone/projX1", "/zone/projX1/empty"},
+			want: []string{"/zone/proj_1/empty"},
+		},
+		{
+			name:     "sibling data does not mark root occupied",
+			root:     "/zone/proj_1",
+			colls:    []string{"/zone/proj_1", "/zone/proj_1/empty", "/zone/projX1/full"},
+			occupied: []string{"/zone/projX1/full"},
+			want:     []string{"/zone/proj_1/empty"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := findEmpty(test.root, test.colls, test.occupied)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("findEmpty() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -18,44 +18,451 @@
 package irods
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
 	"github.com/cyverse/go-irodsclient/fs"
 	"github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/rs/zerolog"
-	"github.com/wtsi-npg/go-baton/appInfo"
 	"github.com/wtsi-npg/go-baton/parsing"
 )
 
-func Put(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}, calculateChecksum bool) (err error) {
+// MaxInlineSize is the largest content, in bytes, that may be given inline for a
+// data object, rather than as a local file.
+const MaxInlineSize = 1 << 20
+
+// PutOptions are the options of Put. Gathering them here keeps the signature of
+// Put stable as options are added.
+type PutOptions struct {
+	Checksum        bool          // Calculate the checksum of each upload server-side
+	FollowSymlinks  bool          // Upload the targets of symlinks in a directory
+	Filter          PathFilter    // Files of a directory to upload
+	SkipUnchanged   bool          // Skip files whose data objects are unchanged
+	Recurse         bool          // Upload a directory tree
+	MaxDepth        int           // Levels of a directory tree to upload
+	Pool            *ResourcePool // Resources to upload to in turn, or nil
+	ChecksumRetries int           // Times to retry an upload with the wrong checksum
+	Redirect        Redirect      // Whether to upload to the resource server directly
+	MaxObjectSize   int64         // Largest data object to upload, in bytes, or 0 for no limit
+	ChecksumWorkers int           // Local files to checksum at once for SkipUnchanged
+}
+
+// Put uploads a local file to a data object or, if options.Recurse is true, a
+// local directory tree into a collection. The tree is uploaded to at most
+// MaxDepth levels below the directory, unless MaxDepth is UnlimitedDepth.
+//
+// If the input has an avus list, each AVU is added to each data object uploaded,
+// after its upload. If that fails, the uploaded data object is left in place,
+// without some or all of its metadata, and the error is returned along with a
+// result recording the upload. The AVUs are checked before anything is
+// uploaded, so malformed metadata does not leave a partial upload.
+//
+// Similarly, if the input has an access list, the ACLs are applied to each data
+// object uploaded, after its upload and metadata. This requires own permission
+// on the data object, which its creator has, but which a user overwriting an
+// existing data object may lack. That is reported as an error in the same way,
+// leaving the upload in place.
+//
+// Instead of a local file, the input may give the content of a data object
+// inline, under the data key, as UTF-8 text or base64 encoded as described for
+// parsing.GetInlineData. The content is limited to MaxInlineSize bytes.
+//
+// Each data object uploaded is written to the next resource of Pool, or to the
+// default resource if pool is nil. The resource of each is reported in the
+// placements of the result, keyed by data object path.
+//
+// An upload whose checksum does not match that of its source is repeated up to
+// ChecksumRetries more times, before ErrChecksumMismatch is returned.
+//
+// Files are uploaded to the resource server directly if Redirect follows
+// redirects. Inline data and empty files always pass through the connected
+// server, since there is nothing to gain from a redirect. An empty file or
+// inline data gives a zero-byte data object whose checksum, if calculated, is
+// that of empty content.
+//
+// The local path is checked before connecting to iRODS, as is each file of a
+// directory before its upload: one that is missing gives an error wrapping
+// ErrLocalPathNotFound, and one that cannot be read ErrLocalPathNotReadable.
+// Likewise, a file or inline data larger than MaxObjectSize, if it is set, gives
+// an error wrapping ErrObjectTooLarge; this guards automated pipelines against a
+// wrong path that points at some huge file. A directory is uploaded until its
+// first file that is too large.
+//
+// The collection and data object of the input may be templates, computing the
+// iRODS path of each file from its name or the input's AVUs; see PathFields for
+// the fields available. A directory is then uploaded file by file, each into the
+// collection its template gives, below which the file keeps its place in the
+// tree. A template is checked before anything is uploaded. Inline data may not
+// use a template.
+//
+// An error caused by a missing local file or iRODS path wraps ErrNotFound, and
+// one caused by a lack of permission wraps ErrPermissionDenied.
+func Put(logger zerolog.Logger, account *types.IRODSAccount, jsonContents map[string]interface{}, options PutOptions) (result *OperationResult, err error) {
 	var iPath, lPath string
 	var coll, dir bool
-	var result *fs.FileTransferResult
+	var data []byte
+	var transfer *fs.FileTransferResult
+	var avus []AVU
+	var acls []ACL
+	var tmpl *pathTemplate
+
+	defer func() { err = classifyError(err) }()
+
+	if err = parsing.Validate(parsing.JSON_PUT_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if err = options.Filter.Validate(); err != nil {
+		return nil, err
+	}
 	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
 		logger.Err(err)
-		return err
+		return nil, err
 	}
 
-	if lPath, dir, err = parsing.GetLocalPath(logger, jsonContents); err != nil {
+	inline := jsonContents[parsing.JSON_DATA_KEY] != nil
+	if inline {
+		if data, err = inlineData(logger, jsonContents, iPath, coll); err != nil {
+			return nil, err
+		}
+	} else if lPath, dir, err = parsing.GetLocalPath(logger, jsonContents); err != nil {
 		logger.Err(err)
-		return err
+		return nil, err
+	}
+	if dir && !options.Recurse {
+		return nil, fmt.Errorf("%s is a directory and recurse was not set: %w",
+			lPath, ErrInvalidArgument)
 	}
 	if dir && !coll {
-		err = parsing.ErrMissingKey
+		err = fmt.Errorf("directory %s must be put into a collection, not data object %s: %w",
+			lPath, iPath, ErrInvalidArgument)
 		logger.Err(err).Msg("iRODS path for directory put should not be data object")
-		return err
+		return nil, err
+	}
+	if !inline {
+		if err = checkLocalPath(lPath, dir); err != nil {
+			logger.Err(err).Msgf("Cannot upload %s", lPath)
+			return nil, err
+		}
+	}
+	if options.MaxObjectSize < 0 {
+		return nil, fmt.Errorf("maximum object size %d is negative: %w",
+			options.MaxObjectSize, ErrInvalidArgument)
+	}
+	if inline && options.MaxObjectSize > 0 && int64(len(data)) > options.MaxObjectSize {
+		return nil, fmt.Errorf("inline data of %d bytes for %s exceeds the maximum of %d: %w",
+			len(data), iPath, options.MaxObjectSize, ErrObjectTooLarge)
+	}
+	if !inline && !dir {
+		if err = checkObjectSize(lPath, options.MaxObjectSize); err != nil {
+			logger.Err(err).Msgf("Refusing to upload %s", lPath)
+			return nil, err
+		}
+	}
+	if avus, err = putAVUs(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if tmpl, err = parsePathTemplate(logger, jsonContents, avus); err != nil {
+		return nil, err
 	}
-	logger.Info().Msgf("Uploading %s to %s", lPath, iPath)
+	if tmpl != nil && inline {
+		return nil, fmt.Errorf("inline data for %s may not use a path template: %w",
+			iPath, ErrInvalidArgument)
+	}
+	if tmpl != nil && !dir {
+		if iPath, err = tmpl.resolve(newPathFields(lPath, avus)); err != nil {
+			return nil, err
+		}
+		logger.Debug().Msgf("Path template gives %s for %s", iPath, lPath)
+	}
+	if jsonContents[parsing.JSON_ACCESS_KEY] != nil {
+		if acls, err = parseACLs(logger, jsonContents); err != nil {
+			return nil, err
+		}
+	}
+	result = newOperationResult(parsing.JSON_PUT_OP, iPath, coll)
+	if inline {
+		logger.Info().Msgf("Uploading %d bytes of inline data to %s", len(data), iPath)
+	} else {
+		logger.Info().Msgf("Uploading %s to %s", lPath, iPath)
+		result.setLocalPath(lPath, dir)
+	}
+	result.AVUs = avus
+	result.ACLs = acls
 
-	filesystem, err := fs.NewFileSystemWithDefault(account, appInfo.Name)
+	filesystem, err := newFileSystem(logger, account)
 	if err != nil {
 		logger.Err(err)
-		return err
+		return result, err
 	}
 
-	defer filesystem.Release()
+	defer releaseFileSystem(filesystem)
 
-	if result, err = filesystem.UploadFile(lPath, iPath, "", true, calculateChecksum, true, func(processed int64, total int64) {}); err != nil {
-		return err
+	if inline {
+		if transfer, err = putData(logger, filesystem, data, iPath, options, avus, acls, result); transfer != nil {
+			result.setPath(transfer.IRODSPath, false)
+			result.setTransfer(transfer)
+		}
+	} else if dir {
+		err = putDirectory(logger, filesystem, lPath, iPath, tmpl, options, avus, acls, result)
+	} else if transfer, err = putFile(logger, filesystem, lPath, iPath, options, avus, acls, result); transfer != nil {
+		result.setPath(transfer.IRODSPath, false)
+		result.setTransfer(transfer)
+	}
+	logger.Info().Msgf("Uploaded %d files, skipped %d unchanged", result.Transferred, result.Skipped)
+	if err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// putFile uploads a local file to a data object on the next resource of the
+// pool. If SkipUnchanged is true, the upload is skipped when the data object already has the file's size and
+// checksum. Once the data object is uploaded, the AVUs are added to it and then
+// the ACLs applied. The transfer counts of the result are updated and details of
+// the transfer returned, or nil if it was skipped; they are returned along with
+// any error adding the AVUs or applying the ACLs.
+func putFile(logger zerolog.Logger, filesystem *fs.FileSystem, lPath string,
+	iPath string, options PutOptions, avus []AVU, acls []ACL, result *OperationResult) (transfer *fs.FileTransferResult, err error) {
+	if options.SkipUnchanged {
+		var same bool
+		if same, err = unchanged(logger, filesystem, lPath, iPath); err != nil {
+			return nil, err
+		}
+		if same {
+			logger.Debug().Msgf("Skipping %s, which is unchanged in %s", lPath, iPath)
+			result.Skipped++
+			return nil, nil
+		}
+	}
+
+	redirect := uploadRedirect(lPath, options.Redirect)
+	resource := options.Pool.Next()
+	if transfer, err = withChecksumRetry(logger, iPath, options.ChecksumRetries, func() (*fs.FileTransferResult, error) {
+		return withRedirect(logger, iPath, redirect, func() (*fs.FileTransferResult, error) {
+			return filesystem.UploadFileParallelRedirectToResource(lPath, iPath, resource, 0, true, options.Checksum, true, func(processed int64, total int64) {})
+		}, func() (*fs.FileTransferResult, error) {
+			return filesystem.UploadFile(lPath, iPath, resource, true, options.Checksum, true, func(processed int64, total int64) {})
+		})
+	}); err != nil {
+		return nil, err
+	}
+	logger.Debug().Msgf("Uploaded %s to %s", transfer.LocalPath, transfer.IRODSPath)
+	result.addTransfer(transfer)
+	result.setPlacement(transfer.IRODSPath, resource)
+
+	return transfer, annotateUpload(logger, filesystem, transfer.IRODSPath, avus, acls)
+}
+
+// uploadRedirect returns whether to follow redirects when uploading lPath. A
+// redirect sets up a parallel transfer, which is wasted on an empty file, so an
+// empty file is never redirected.
+func uploadRedirect(lPath string, redirect Redirect) Redirect {
+	if info, err := os.Stat(lPath); err == nil && info.Size() == 0 {
+		return NoRedirect
+	}
+	return redirect
+}
+
+// putData writes inline data to a data object, streaming it to the server in
+// chunks. It is otherwise the same as putFile.
+func putData(logger zerolog.Logger, filesystem *fs.FileSystem, data []byte,
+	iPath string, options PutOptions, avus []AVU, acls []ACL, result *OperationResult) (transfer *fs.FileTransferResult, err error) {
+	if options.SkipUnchanged {
+		var same bool
+		if same, err = dataUnchanged(logger, filesystem, data, iPath); err != nil {
+			return nil, err
+		}
+		if same {
+			logger.Debug().Msgf("Skipping inline data, which is unchanged in %s", iPath)
+			result.Skipped++
+			return nil, nil
+		}
+	}
+
+	resource := options.Pool.Next()
+	if transfer, err = withChecksumRetry(logger, iPath, options.ChecksumRetries, func() (*fs.FileTransferResult, error) {
+		return filesystem.UploadFileFromBuffer(*bytes.NewBuffer(data), iPath, resource, true, options.Checksum, true, func(processed int64, total int64) {})
+	}); err != nil {
+		return nil, err
+	}
+	logger.Debug().Msgf("Uploaded %d bytes of inline data to %s", len(data), transfer.IRODSPath)
+	result.addTransfer(transfer)
+	result.setPlacement(transfer.IRODSPath, resource)
+
+	return transfer, annotateUpload(logger, filesystem, transfer.IRODSPath, avus, acls)
+}
+
+// annotateUpload adds AVUs to a newly uploaded data object and then applies
+// ACLs to it.
+func annotateUpload(logger zerolog.Logger, filesystem *fs.FileSystem, iPath string,
+	avus []AVU, acls []ACL) (err error) {
+	for _, avu := range avus {
+		if err = applyAVU(logger, filesystem, iPath, false,
+			parsing.JSON_ARG_META_ADD, avu); err != nil {
+			return fmt.Errorf("uploaded %s, but failed to add metadata: %w", iPath, err)
+		}
+	}
+	if len(acls) > 0 {
+		if err = setDataObjectACLs(logger, filesystem, iPath, acls); err != nil {
+			return fmt.Errorf("uploaded %s, but failed to apply ACLs: %w", iPath, err)
+		}
 	}
-	logger.Debug().Msgf("Uploaded %s to %s", result.LocalPath, result.IRODSPath)
 	return nil
 }
+
+// inlineData returns the inline data of a put input, checking that it is to be
+// written to a data object, that it is not given along with a local path and that
+// it is no larger than MaxInlineSize.
+func inlineData(logger zerolog.Logger, jsonContents map[string]interface{},
+	iPath string, coll bool) (data []byte, err error) {
+	if coll {
+		return nil, fmt.Errorf("inline data must be put into a data object, "+
+			"not collection %s: %w", iPath, ErrInvalidArgument)
+	}
+	for _, key := range []string{parsing.JSON_DIRECTORY_KEY,
+		parsing.JSON_DIRECTORY_SHORT_KEY, parsing.JSON_FILE_KEY} {
+		if jsonContents[key] != nil {
+			return nil, fmt.Errorf("inline data cannot be put along with a %s: %w",
+				key, ErrInvalidArgument)
+		}
+	}
+	if data, err = parsing.GetInlineData(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if len(data) > MaxInlineSize {
+		return nil, fmt.Errorf("inline data of %d bytes is larger than the limit "+
+			"of %d bytes: %w", len(data), MaxInlineSize, ErrInvalidArgument)
+	}
+	return data, nil
+}
+
+// putAVUs returns the AVUs to add to uploaded data objects, which are optional.
+func putAVUs(logger zerolog.Logger, jsonContents map[string]interface{}) (
+	avus []AVU, err error) {
+	var meta []interface{}
+
+	if jsonContents[parsing.JSON_AVUS_KEY] == nil {
+		return nil, nil
+	}
+	if meta, err = parsing.GetAVUsList(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if avus, err = parseAVUs(logger, meta); err != nil {
+		return nil, err
+	}
+	for _, avu := range avus {
+		if avu.Value == "" {
+			return nil, fmt.Errorf("AVU with attribute '%s' has no value: %w",
+				avu.Attribute, parsing.ErrMissingKey)
+		}
+	}
+	return avus, nil
+}
+
+// putDirectory uploads the contents of a local directory tree into a collection,
+// creating sub-collections to mirror its sub-directories. Symbolic links are
+// handled as described for walkLocalTree and files excluded by the filter are
+// not uploaded, nor are those more than MaxDepth levels below the directory.
+//
+// If tmpl is not nil, it gives the collection of each file in place of iPath,
+// and only the collections that files are uploaded to are created.
+//
+// If SkipUnchanged is true and ChecksumWorkers is more than 1, whether each file
+// is unchanged is decided before any is uploaded, as described for
+// unchangedFiles, rather than file by file as each is uploaded.
+func putDirectory(logger zerolog.Logger, filesystem *fs.FileSystem, lPath string,
+	iPath string, tmpl *pathTemplate, options PutOptions, avus []AVU, acls []ACL,
+	result *OperationResult) (err error) {
+	// fileTarget returns the data object path of a file of the tree
+	fileTarget := func(entry localEntry) (string, error) {
+		if tmpl == nil {
+			return path.Join(iPath, filepath.ToSlash(entry.RelPath)), nil
+		}
+		coll, err := tmpl.resolve(newPathFields(entry.Path, avus))
+		if err != nil {
+			return "", err
+		}
+		return path.Join(coll, filepath.ToSlash(entry.RelPath)), nil
+	}
+
+	var decided map[string]bool
+	if options.SkipUnchanged && options.ChecksumWorkers > 1 {
+		var files []fileUpload
+		if err = walkLocalTree(logger, lPath, options.FollowSymlinks, options.MaxDepth, func(entry localEntry) error {
+			if entry.IsDir || options.Filter.Excludes(filepath.ToSlash(entry.RelPath)) {
+				return nil
+			}
+			target, err := fileTarget(entry)
+			if err != nil {
+				return err
+			}
+			files = append(files, fileUpload{lPath: entry.Path, iPath: target})
+			return nil
+		}); err != nil {
+			return err
+		}
+		if decided, err = unchangedFiles(logger, filesystem, files, options.ChecksumWorkers); err != nil {
+			return err
+		}
+	}
+
+	if tmpl == nil {
+		if err = filesystem.MakeDir(iPath, true); err != nil {
+			return err
+		}
+	}
+	made := make(map[string]bool)
+
+	return walkLocalTree(logger, lPath, options.FollowSymlinks, options.MaxDepth, func(entry localEntry) error {
+		if entry.IsDir {
+			if tmpl != nil {
+				return nil
+			}
+			target := path.Join(iPath, filepath.ToSlash(entry.RelPath))
+			logger.Debug().Msgf("Creating collection %s", target)
+			return filesystem.MakeDir(target, true)
+		}
+		if options.Filter.Excludes(filepath.ToSlash(entry.RelPath)) {
+			logger.Debug().Msgf("Skipping excluded file %s", entry.Path)
+			return nil
+		}
+		target, err := fileTarget(entry)
+		if err != nil {
+			return err
+		}
+
+		fileOptions := options
+		if same, ok := decided[entry.Path]; ok {
+			if same {
+				logger.Debug().Msgf("Skipping %s, which is unchanged in %s", entry.Path, target)
+				result.Skipped++
+				return nil
+			}
+			fileOptions.SkipUnchanged = false
+		}
+
+		if tmpl != nil {
+			if parent := path.Dir(target); !made[parent] {
+				logger.Debug().Msgf("Creating collection %s", parent)
+				if err = filesystem.MakeDir(parent, true); err != nil {
+					return err
+				}
+				made[parent] = true
+			}
+		}
+		if err = checkLocalPath(entry.Path, false); err != nil {
+			return err
+		}
+		if err = checkObjectSize(entry.Path, options.MaxObjectSize); err != nil {
+			logger.Err(err).Msgf("Refusing to upload %s", entry.Path)
+			return err
+		}
+		_, err = putFile(logger, filesystem, entry.Path, target, fileOptions, avus, acls, result)
+		return err
+	})
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+func TestPutAVUs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  []AVU
+		err   error
+	}{
+		{"no AVUs", map[string]interface{}{}, nil, nil},
+		{"AVUs", map[string]interface{}{"avus": []interface{}{
+			map[string]interface{}{"attribute": "a", "value": "v"},
+			map[string]interface{}{"a": "b", "v": "w", "u": "x"},
+		}}, []AVU{{Attribute: "a", Value: "v"}, {Attribute: "b", Value: "w", Units: "x"}}, nil},
+		{"AVU without value", map[string]interface{}{"avus": []interface{}{
+			map[string]interface{}{"attribute": "a"},
+		}}, nil, parsing.ErrMissingKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := putAVUs(zerolog.Nop(), test.input)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("putAVUs() error = %v, want %v", err, test.err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("putAVUs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPutWithMetadata(t *testing.T) {
+	account := testAccount(t)
+	coll := testCollection(t, account)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	avu := map[string]interface{}{"attribute": "sample", "value": "s1", "units": "id"}
+
+	tests := []struct {
+		name   string
+		object string
+		avus   []interface{}
+		access []interface{}
+		fails  bool
+	}{
+		{"upload and tag", "tagged.txt", []interface{}{avu}, nil, false},
+		{"upload and fail to add a duplicate AVU", "duplicate.txt",
+			[]interface{}{avu, avu}, nil, true},
+		{"upload and fail to apply an ACL", "acl.txt", []interface{}{avu},
+			[]interface{}{map[string]interface{}{"owner": "go-baton-no-such-user", "level": "read"}},
+			true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := map[string]interface{}{
+				"collection":  coll,
+				"data_object": test.object,
+				"directory":   dir,
+				"file":        "file.txt",
+				"avus":        test.avus,
+			}
+			if test.access != nil {
+				input["access"] = test.access
+			}
+			result, err := Put(zerolog.Nop(), account, input, PutOptions{})
+			if test.fails != (err != nil) {
+				t.Fatalf("Put() error = %v, want failure %v", err, test.fails)
+			}
+			if result == nil {
+				t.Fatal("Put() result = nil, want a result recording the upload")
+			}
+			if result.Success == test.fails {
+				t.Errorf("Put() success = %v, want %v", result.Success, !test.fails)
+			}
+			if result.Transferred != 1 {
+				t.Errorf("Put() transferred = %d, want 1", result.Transferred)
+			}
+
+			// The upload stays in place, with the AVU that was added before the failure
+			iPath := path.Join(coll, test.object)
+			filesystem, err := newFileSystem(zerolog.Nop(), account)
+			if err != nil {
+				t.Fatalf("newFileSystem() error = %v", err)
+			}
+			defer releaseFileSystem(filesystem)
+
+			if !filesystem.ExistsFile(iPath) {
+				t.Fatalf("data object %s does not exist after its upload", iPath)
+			}
+			metas, err := filesystem.ListMetadata(iPath)
+			if err != nil {
+				t.Fatalf("ListMetadata(%s) error = %v", iPath, err)
+			}
+			if !slices.ContainsFunc(metas, func(meta *types.IRODSMeta) bool {
+				return meta.Name == "sample" && meta.Value == "s1" && meta.Units == "id"
+			}) {
+				t.Errorf("data object %s has metadata %v, want sample=s1 id", iPath, metas)
+			}
+		})
+	}
+}
+
+func TestUploadRedirect(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.txt")
+	full := filepath.Join(dir, "full.txt")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte("content\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lPath    string
+		redirect Redirect
+		want     Redirect
+	}{
+		{"empty file not redirected", empty, FollowRedirect, NoRedirect},
+		{"empty file with fallback not redirected", empty, FollowRedirectOrFallback, NoRedirect},
+		{"file redirected", full, FollowRedirect, FollowRedirect},
+		{"file not redirected", full, NoRedirect, NoRedirect},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := uploadRedirect(test.lPath, test.redirect); got != test.want {
+				t.Errorf("uploadRedirect() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// Redirect selects whether the data of a transfer passes through the connected
+// server, or directly between the client and the resource server holding it.
+type Redirect int
+
+const (
+	// NoRedirect passes all data through the connected server, so that only it
+	// need be reachable from the client
+	NoRedirect Redirect = iota
+	// FollowRedirect transfers data in parallel directly with the resource
+	// server to which the connected server redirects the client
+	FollowRedirect
+	// FollowRedirectOrFallback follows a redirect as FollowRedirect does, but
+	// falls back to NoRedirect, with a warning, when the resource server cannot
+	// be reached, e.g. because it is behind a firewall
+	FollowRedirectOrFallback
+)
+
+// NewRedirect returns the Redirect that follows redirects only if follow is
+// true, falling back to the connected server if fallback is also true.
+func NewRedirect(follow bool, fallback bool) Redirect {
+	switch {
+	case !follow:
+		return NoRedirect
+	case fallback:
+		return FollowRedirectOrFallback
+	default:
+		return FollowRedirect
+	}
+}
+
+// withRedirect performs a transfer either with redirected, which follows a
+// redirect to the resource server, or with direct, which passes the data through
+// the connected server, as selected by redirect.
+func withRedirect(logger zerolog.Logger, iPath string, redirect Redirect,
+	redirected func() (*fs.FileTransferResult, error),
+	direct func() (*fs.FileTransferResult, error)) (*fs.FileTransferResult, error) {
+	if redirect == NoRedirect {
+		return direct()
+	}
+
+	result, err := redirected()
+	if err == nil || redirect != FollowRedirectOrFallback || !redirectFailed(err) {
+		return result, err
+	}
+	logger.Warn().Err(err).Msgf("Failed to reach the resource server for %s; "+
+		"transferring it through the connected server instead", iPath)
+	return direct()
+}
+
+// redirectFailed returns true if a transfer failed because the resource server
+// to which it was redirected could not be reached.
+func redirectFailed(err error) bool {
+	return types.IsConnectionError(err) || types.IsResourceServerConnectionConfigError(err)
+}
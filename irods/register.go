@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Register registers a file that is already on the filesystem of a resource as
+// a data object, without copying it, which makes ingesting large datasets that
+// have been staged on a resource cheap. The input gives the data object, the
+// physical path of the file, which must be absolute and visible to the resource
+// server, and the resource.
+//
+// If the data object is already registered with the same physical path, there
+// is nothing to do and the result reports it as skipped. If it exists with
+// other data, the error wraps ErrAlreadyExists.
+func Register(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}) (result *OperationResult, err error) {
+	var iPath, physicalPath, resource string
+	var coll bool
+	var conn *connection.IRODSConnection
+	var entry *fs.Entry
+
+	defer func() { err = classifyError(err) }()
+
+	if err = parsing.Validate(parsing.JSON_REGISTER_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if coll {
+		return nil, fmt.Errorf("register requires a data object, not collection %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+	if physicalPath, err = parsing.GetPhysicalPathValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !path.IsAbs(physicalPath) {
+		return nil, fmt.Errorf("physical path %s is not absolute: %w",
+			physicalPath, ErrInvalidArgument)
+	}
+	if resource, err = parsing.GetResourceValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if resource == "" {
+		return nil, fmt.Errorf("register requires a resource: %w", ErrMissingArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_REGISTER_OP, iPath, coll)
+	result.Resource = resource
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	registered, err := registerFile(logger, conn, iPath, physicalPath, resource)
+	if err != nil {
+		return result, err
+	}
+	if registered {
+		logger.Info().Msgf("Registered %s on %s as %s", physicalPath, resource, iPath)
+	} else {
+		logger.Info().Msgf("%s is already registered as %s", physicalPath, iPath)
+		result.Skipped++
+	}
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		return result, err
+	}
+	result.Size = &entry.Size
+
+	result.Success = true
+	return result, nil
+}
+
+// registerFile registers a physical file on a resource as a data object,
+// returning false if the data object already has a replica with that physical
+// path.
+func registerFile(logger zerolog.Logger, conn *connection.IRODSConnection,
+	iPath string, physicalPath string, resource string) (registered bool, err error) {
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	request := newRegisterRequest(iPath, physicalPath, resource)
+	response := registerResponse{}
+	if err = conn.RequestAndCheck(request, &response, nil); err == nil {
+		return true, nil
+	}
+
+	code := baseErrorCode(err)
+	if code != common.CAT_NAME_EXISTS_AS_DATAOBJ && code != common.OVERWRITE_WITHOUT_FORCE_FLAG {
+		return false, err
+	}
+
+	var paths []string
+	if paths, err = physicalPaths(logger, conn, iPath); err != nil {
+		return false, err
+	}
+	for _, p := range paths {
+		if p == physicalPath {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%s is already registered with other data: %w",
+		iPath, ErrAlreadyExists)
+}
+
+// physicalPaths returns the physical paths of the replicas of a data object on
+// a locked connection.
+func physicalPaths(logger zerolog.Logger, conn *connection.IRODSConnection,
+	iPath string) (paths []string, err error) {
+	var collCond, dataCond string
+
+	if collCond, err = valueCondition("=", path.Dir(iPath)); err != nil {
+		return nil, err
+	}
+	if dataCond, err = valueCondition("=", path.Base(iPath)); err != nil {
+		return nil, err
+	}
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_D_DATA_PATH, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, collCond)
+	query.AddCondition(common.ICAT_COLUMN_DATA_NAME, dataCond)
+
+	err = forEachRow(logger, conn, query, func(row []string) error {
+		paths = append(paths, row[0])
+		return nil
+	})
+	return paths, err
+}
+
+// registerRequest is a request to register a physical file as a data object,
+// for which go-irodsclient has no message of its own. It has the same form as
+// other data object requests.
+type registerRequest message.IRODSMessageDataObjectRequest
+
+func newRegisterRequest(iPath string, physicalPath string, resource string) *registerRequest {
+	request := &registerRequest{
+		Path: iPath,
+		Size: -1,
+	}
+	request.KeyVals.Add(string(common.FILE_PATH_KW), physicalPath)
+	request.KeyVals.Add(string(common.DEST_RESC_NAME_KW), resource)
+	return request
+}
+
+// GetMessage builds the message of the request.
+func (request *registerRequest) GetMessage() (*message.IRODSMessage, error) {
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal register request: %w", err)
+	}
+
+	msgBody := message.IRODSMessageBody{
+		Type:    message.RODS_MESSAGE_API_REQ_TYPE,
+		Message: body,
+		IntInfo: int32(common.PHY_PATH_REG_AN),
+	}
+	msgHeader, err := msgBody.BuildHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build register request header: %w", err)
+	}
+
+	return &message.IRODSMessage{Header: msgHeader, Body: &msgBody}, nil
+}
+
+// registerResponse is the response to a registerRequest, which carries only its
+// status.
+type registerResponse struct {
+	Result int
+}
+
+// FromMessage reads the status of the response.
+func (response *registerResponse) FromMessage(msg *message.IRODSMessage) error {
+	if msg.Body == nil {
+		return fmt.Errorf("empty register response body")
+	}
+	response.Result = int(msg.Body.IntInfo)
+	return nil
+}
+
+// CheckError returns an error if the registration failed.
+func (response *registerResponse) CheckError() error {
+	if response.Result < 0 {
+		return types.NewIRODSError(common.ErrorCode(response.Result))
+	}
+	return nil
+}
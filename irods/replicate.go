@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Replicate makes a replica of a data object on the resource named in the input.
+// If all is true, the resource is taken to be a resource group and a replica is
+// made on each of its members.
+//
+// Without all, replicating to a resource that already holds a good replica does
+// nothing and is reported as skipped. In either case, the numbers of the
+// replicas on the resource are reported.
+func Replicate(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, all bool) (result *OperationResult, err error) {
+	var iPath, resource string
+	var coll bool
+	var replicas []*types.IRODSReplica
+
+	if err = parsing.Validate(parsing.JSON_REPLICATE_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if coll {
+		return nil, fmt.Errorf("replicate requires a data object, not collection %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+	if resource, err = parsing.GetResourceValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_REPLICATE_OP, iPath, coll)
+	result.Resource = resource
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if replicas, err = listReplicas(filesystem, iPath); err != nil {
+		return result, err
+	}
+
+	existing := replicasOnResource(replicas, resource)
+	if !all && len(existing) > 0 {
+		logger.Info().Msgf("%s already has a good replica on %s", iPath, resource)
+		result.ReplicaNumbers = existing
+		result.Skipped++
+		result.Success = true
+		return result, nil
+	}
+
+	if err = replicateDataObject(filesystem, iPath, resource, all); err != nil {
+		return result, fmt.Errorf("failed to replicate %s to %s: %w", iPath, resource, err)
+	}
+	if replicas, err = listReplicas(filesystem, iPath); err != nil {
+		return result, err
+	}
+
+	result.ReplicaNumbers = replicasOnResource(replicas, resource)
+	result.Transferred = len(result.ReplicaNumbers) - len(existing)
+	logger.Info().Msgf("Replicated %s to %s, replicas %v", iPath, resource,
+		result.ReplicaNumbers)
+
+	result.Success = true
+	return result, nil
+}
+
+// replicasOnResource returns the numbers of the good replicas held on a
+// resource, either directly or as the root of the replica's resource hierarchy.
+func replicasOnResource(replicas []*types.IRODSReplica, resource string) (
+	numbers []int64) {
+	for _, replica := range replicas {
+		if replica.Status != parsing.VALID_REPLICATE {
+			continue
+		}
+		root, _, _ := strings.Cut(replica.ResourceHierarchy, ";")
+		if replica.ResourceName == resource || root == resource {
+			numbers = append(numbers, replica.Number)
+		}
+	}
+	return numbers
+}
+
+// replicateDataObject asks iRODS to replicate a data object to a resource or,
+// if all is true, to every member of a resource group.
+func replicateDataObject(filesystem *fs.FileSystem, iPath string, resource string,
+	all bool) (err error) {
+	var conn *connection.IRODSConnection
+
+	request := message.NewIRODSMessageReplicateDataObjectRequest(iPath, resource)
+	if all {
+		request.AddKeyVal(common.ALL_KW, "")
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	response := message.IRODSMessageReplicateDataObjectResponse{}
+	return conn.RequestAndCheck(request, &response, nil)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+// OperationResult describes the outcome of an operation on a single target.
+// Operations return it to their caller, which is responsible for serialising it;
+// fields that do not apply to an operation are omitted from the JSON.
+type OperationResult struct {
+	Operation        string            `json:"operation"`
+	Collection       string            `json:"collection,omitempty"`
+	DataObject       string            `json:"data_object,omitempty"`
+	Directory        string            `json:"directory,omitempty"`
+	File             string            `json:"file,omitempty"`
+	Destination      string            `json:"destination,omitempty"`
+	Success          bool              `json:"success"`
+	Error            string            `json:"error,omitempty"`
+	Exists           *bool             `json:"exists,omitempty"`
+	Inheritance      *bool             `json:"inheritance,omitempty"`
+	Type             string            `json:"type,omitempty"`
+	Size             *int64            `json:"size,omitempty"`
+	TotalSize        *int64            `json:"total_size,omitempty"`
+	ObjectCount      *int              `json:"object_count,omitempty"`
+	Count            *int              `json:"count,omitempty"`
+	Checksum         string            `json:"checksum,omitempty"`
+	HasChecksum      *bool             `json:"has_checksum,omitempty"`
+	ChecksumStatus   string            `json:"checksum_status,omitempty"`
+	PreviousChecksum string            `json:"previous_checksum,omitempty"`
+	Data             *string           `json:"data,omitempty"`
+	Encoding         string            `json:"encoding,omitempty"`
+	Transferred      int               `json:"transferred,omitempty"`
+	TransferredBytes int64             `json:"transferred_bytes,omitempty"`
+	Skipped          int               `json:"skipped,omitempty"`
+	Trimmed          int               `json:"trimmed,omitempty"`
+	Replicas         *int              `json:"replicas,omitempty"`
+	Resource         string            `json:"resource,omitempty"`
+	ReplicaNumbers   []int64           `json:"replica_numbers,omitempty"`
+	Placements       map[string]string `json:"placements,omitempty"`
+	Renamed          map[string]string `json:"renamed,omitempty"`
+	Timestamps       []Timestamp       `json:"timestamps,omitempty"`
+	AVUs             []AVU             `json:"avus,omitempty"`
+	ACLs             []ACL             `json:"access,omitempty"`
+	Contents         *[]ListEntry      `json:"contents,omitempty"`
+	Result           interface{}       `json:"result,omitempty"`
+}
+
+// AVU is a metadata attribute, value and units triple.
+type AVU struct {
+	Attribute string `json:"attribute"`
+	Value     string `json:"value,omitempty"`
+	Units     string `json:"units,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+}
+
+// Timestamp is a creation or modification time of a data object, of which only
+// one is set, in the shape baton reports them.
+type Timestamp struct {
+	Created  string `json:"created,omitempty"`
+	Modified string `json:"modified,omitempty"`
+}
+
+// ACL is an access control entry granting a user or group an access level. Its
+// type says which of the two the owner is, where that is known.
+type ACL struct {
+	Owner string `json:"owner"`
+	Level string `json:"level"`
+	Zone  string `json:"zone,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// newOperationResult returns an unsuccessful result for an operation on the
+// collection, or data object, at iPath.
+func newOperationResult(operation string, iPath string, coll bool) *OperationResult {
+	result := &OperationResult{Operation: operation}
+	result.setPath(iPath, coll)
+	return result
+}
+
+// setPath sets the collection and data object of a result from an iRODS path.
+func (result *OperationResult) setPath(iPath string, coll bool) {
+	if coll {
+		result.Collection = iPath
+		result.DataObject = ""
+	} else {
+		result.Collection = path.Dir(iPath)
+		result.DataObject = path.Base(iPath)
+	}
+}
+
+// IRODSPath returns the iRODS path of the collection or data object of a result.
+func (result *OperationResult) IRODSPath() string {
+	if result.DataObject == "" {
+		return result.Collection
+	}
+	return path.Join(result.Collection, result.DataObject)
+}
+
+// setLocalPath sets the local directory and file of a result from a local path.
+func (result *OperationResult) setLocalPath(lPath string, dir bool) {
+	if dir {
+		result.Directory = lPath
+		result.File = ""
+	} else {
+		result.Directory = filepath.Dir(lPath)
+		result.File = filepath.Base(lPath)
+	}
+}
+
+// setPlacement records the resource to which a data object was uploaded, if it
+// was not the default.
+func (result *OperationResult) setPlacement(iPath string, resource string) {
+	if resource == "" {
+		return
+	}
+	if result.Placements == nil {
+		result.Placements = make(map[string]string)
+	}
+	result.Placements[iPath] = resource
+}
+
+// addTransfer counts a file transferred between the client and iRODS, and its
+// bytes.
+func (result *OperationResult) addTransfer(transfer *fs.FileTransferResult) {
+	size := transfer.IRODSSize
+	if size == 0 {
+		size = transfer.LocalSize
+	}
+	result.Transferred++
+	result.TransferredBytes += size
+}
+
+// setTransfer records the size and checksum of a transferred file.
+func (result *OperationResult) setTransfer(transfer *fs.FileTransferResult) {
+	size := transfer.IRODSSize
+	if size == 0 {
+		size = transfer.LocalSize
+	}
+	result.Size = &size
+
+	checksum := transfer.IRODSCheckSum
+	if len(checksum) == 0 {
+		checksum = transfer.LocalCheckSum
+	}
+	if len(checksum) > 0 {
+		result.Checksum, _ = types.MakeIRODSChecksumString(transfer.CheckSumAlgorithm, checksum)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// withChecksumRetry performs a transfer that verifies checksums, repeating it up
+// to retries more times while the checksums of its source and destination do not
+// match, since a mismatch is often caused by transient corruption in transit.
+// Once the retries are exhausted, ErrChecksumMismatch is returned. Any other
+// error is returned at once.
+func withChecksumRetry(logger zerolog.Logger, iPath string, retries int,
+	transfer func() (*fs.FileTransferResult, error)) (*fs.FileTransferResult, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := transfer()
+		if result != nil {
+			logger.Debug().Msgf("Transfer attempt %d of %s: local checksum '%s', iRODS checksum '%s'",
+				attempt, iPath, checksumString(result.CheckSumAlgorithm, result.LocalCheckSum),
+				checksumString(result.CheckSumAlgorithm, result.IRODSCheckSum))
+		}
+		if err == nil || !checksumMismatch(result, err) {
+			return result, err
+		}
+		if attempt > retries {
+			return result, fmt.Errorf("checksums of %s still differ after %d attempts (%v): %w",
+				iPath, attempt, err, ErrChecksumMismatch)
+		}
+		logger.Warn().Err(err).Msgf("Checksum mismatch transferring %s, retrying (%d of %d)",
+			iPath, attempt, retries)
+	}
+}
+
+// checksumMismatch returns true if a transfer failed because the checksums of
+// its source and destination differ. The server reports this for an upload; for
+// a download, it is found by comparing the checksums of the result.
+func checksumMismatch(result *fs.FileTransferResult, err error) bool {
+	if types.GetIRODSErrorCode(err) == common.USER_CHKSUM_MISMATCH {
+		return true
+	}
+	return result != nil && len(result.LocalCheckSum) > 0 && len(result.IRODSCheckSum) > 0 &&
+		!bytes.Equal(result.LocalCheckSum, result.IRODSCheckSum)
+}
+
+// checksumString returns a checksum in the form iRODS reports it, or an empty
+// string if there is none.
+func checksumString(algorithm types.ChecksumAlgorithm, checksum []byte) string {
+	if len(checksum) == 0 {
+		return ""
+	}
+	str, err := types.MakeIRODSChecksumString(algorithm, checksum)
+	if err != nil {
+		return fmt.Sprintf("%x", checksum)
+	}
+	return str
+}
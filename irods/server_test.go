@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// testAccount returns an account for the iRODS server named by the iRODS
+// environment file, such as the one started by docker-compose.yml. The test is
+// skipped in short mode or if there is no usable server.
+func testAccount(t *testing.T) *types.IRODSAccount {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping test against an iRODS server in short mode")
+	}
+
+	logger := zerolog.Nop()
+	manager, err := NewICommandsEnvironmentManager(logger, IRODSEnvFilePath(), nil)
+	if err != nil {
+		t.Skipf("no iRODS environment: %v", err)
+	}
+	account, err := NewIRODSAccount(logger, manager)
+	if err != nil {
+		t.Skipf("no iRODS account: %v", err)
+	}
+	if err = VerifyIRODSAccount(logger, account, "~"); err != nil {
+		t.Skipf("no usable iRODS server: %v", err)
+	}
+	return account
+}
+
+// testCollection returns the path of a new collection in the home collection of
+// the account, which is removed with its contents when the test ends.
+func testCollection(t *testing.T, account *types.IRODSAccount) string {
+	t.Helper()
+	logger := zerolog.Nop()
+	coll := path.Join(HomeCollection(account),
+		fmt.Sprintf("go-baton-test-%d", time.Now().UnixNano()))
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		t.Fatalf("newFileSystem() error = %v", err)
+	}
+	defer releaseFileSystem(filesystem)
+
+	if err = filesystem.MakeDir(coll, true); err != nil {
+		t.Fatalf("MakeDir(%s) error = %v", coll, err)
+	}
+	t.Cleanup(func() {
+		filesystem, err := newFileSystem(logger, account)
+		if err != nil {
+			t.Errorf("newFileSystem() error = %v", err)
+			return
+		}
+		defer releaseFileSystem(filesystem)
+
+		if err = filesystem.RemoveDir(coll, true, true); err != nil {
+			t.Errorf("RemoveDir(%s) error = %v", coll, err)
+		}
+	})
+	return coll
+}
+
+// testACLLevel returns the access level that owner of zone has to a collection,
+// or the null level if it has none.
+func testACLLevel(t *testing.T, account *types.IRODSAccount, coll string,
+	owner string, zone string) types.IRODSAccessLevelType {
+	t.Helper()
+	filesystem, err := newFileSystem(zerolog.Nop(), account)
+	if err != nil {
+		t.Fatalf("newFileSystem() error = %v", err)
+	}
+	defer releaseFileSystem(filesystem)
+
+	accesses, err := filesystem.ListACLs(coll)
+	if err != nil {
+		t.Fatalf("ListACLs(%s) error = %v", coll, err)
+	}
+	for _, access := range accesses {
+		if access.UserName == owner && access.UserZone == zone {
+			return access.AccessLevel
+		}
+	}
+	return types.IRODSAccessLevelNull
+}
+
+// testStat returns the entry of an iRODS path, read afresh from the server.
+func testStat(t *testing.T, account *types.IRODSAccount, iPath string) *fs.Entry {
+	t.Helper()
+	filesystem, err := newFileSystem(zerolog.Nop(), account)
+	if err != nil {
+		t.Fatalf("newFileSystem() error = %v", err)
+	}
+	defer releaseFileSystem(filesystem)
+
+	entry, err := filesystem.Stat(iPath)
+	if err != nil {
+		t.Fatalf("Stat(%s) error = %v", iPath, err)
+	}
+	return entry
+}
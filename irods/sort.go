@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/util"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// sortKey holds the fields of a result entry by which it may be sorted.
+type sortKey struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// checkSortField returns an error if field is not one by which result entries may
+// be sorted, or empty to leave them unsorted.
+func checkSortField(field string) error {
+	if field != "" && field != parsing.JSON_ARG_SORT_PATH &&
+		field != parsing.JSON_ARG_SORT_SIZE && field != parsing.JSON_ARG_SORT_MODIFIED {
+		return fmt.Errorf("invalid sort field '%s'; must be one of %s, %s or %s: %w",
+			field, parsing.JSON_ARG_SORT_PATH, parsing.JSON_ARG_SORT_SIZE,
+			parsing.JSON_ARG_SORT_MODIFIED, ErrInvalidArgument)
+	}
+	return nil
+}
+
+// compareSortKeys compares a and b by field, ascending. Entries that are equal
+// by field are ordered by path, so that the order is deterministic. A collection
+// sorts by its own path alongside data objects, and has a size of zero.
+func compareSortKeys(field string, a sortKey, b sortKey) int {
+	var c int
+	switch field {
+	case parsing.JSON_ARG_SORT_SIZE:
+		c = cmp.Compare(a.size, b.size)
+	case parsing.JSON_ARG_SORT_MODIFIED:
+		c = a.modified.Compare(b.modified)
+	}
+	return cmp.Or(c, cmp.Compare(a.path, b.path))
+}
+
+// sortByField sorts items in place by field, using keyOf to get the sort key of
+// each. The sort is stable and does nothing if field is empty.
+func sortByField[T any](items []T, field string, keyOf func(item T) sortKey) {
+	if field == "" {
+		return
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		return compareSortKeys(field, keyOf(a), keyOf(b))
+	})
+}
+
+// sortColumn returns the genquery column holding the value to sort by field,
+// for data objects or collections, or zero if there is none. Paths are already
+// selected, and collections have no size.
+func sortColumn(field string, objects bool) common.ICATColumnNumber {
+	switch {
+	case field == parsing.JSON_ARG_SORT_SIZE && objects:
+		return common.ICAT_COLUMN_DATA_SIZE
+	case field == parsing.JSON_ARG_SORT_MODIFIED && objects:
+		return common.ICAT_COLUMN_D_MODIFY_TIME
+	case field == parsing.JSON_ARG_SORT_MODIFIED:
+		return common.ICAT_COLUMN_COLL_MODIFY_TIME
+	default:
+		return 0
+	}
+}
+
+// setSortValue sets the field of key from value, as returned by genquery for the
+// column given by sortColumn.
+func (key *sortKey) setSortValue(field string, value string) (err error) {
+	switch field {
+	case parsing.JSON_ARG_SORT_SIZE:
+		if key.size, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid size '%s' for %s: %w", value, key.path, err)
+		}
+	case parsing.JSON_ARG_SORT_MODIFIED:
+		if key.modified, err = util.GetIRODSDateTime(value); err != nil {
+			return fmt.Errorf("invalid modify time '%s' for %s: %w", value, key.path, err)
+		}
+	}
+	return nil
+}
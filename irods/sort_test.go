@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+func TestCheckSortField(t *testing.T) {
+	for _, field := range []string{"", parsing.JSON_ARG_SORT_PATH,
+		parsing.JSON_ARG_SORT_SIZE, parsing.JSON_ARG_SORT_MODIFIED} {
+		if err := checkSortField(field); err != nil {
+			t.Errorf("checkSortField(%q) error = %v, want none", field, err)
+		}
+	}
+	if err := checkSortField("owner"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("checkSortField(\"owner\") error = %v, want %v", err, ErrInvalidArgument)
+	}
+}
+
+func TestCompareSortKeysTies(t *testing.T) {
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		field string
+		a, b  sortKey
+		want  int
+	}{
+		{"path", parsing.JSON_ARG_SORT_PATH,
+			sortKey{path: "/z/a"}, sortKey{path: "/z/b"}, -1},
+		{"size before path", parsing.JSON_ARG_SORT_SIZE,
+			sortKey{path: "/z/a", size: 2}, sortKey{path: "/z/b", size: 1}, 1},
+		{"size tie broken by path", parsing.JSON_ARG_SORT_SIZE,
+			sortKey{path: "/z/b", size: 1}, sortKey{path: "/z/a", size: 1}, 1},
+		{"modified before path", parsing.JSON_ARG_SORT_MODIFIED,
+			sortKey{path: "/z/a", modified: late}, sortKey{path: "/z/b", modified: early}, 1},
+		{"modified tie broken by path", parsing.JSON_ARG_SORT_MODIFIED,
+			sortKey{path: "/z/a", modified: early}, sortKey{path: "/z/b", modified: early}, -1},
+		{"identical", parsing.JSON_ARG_SORT_SIZE,
+			sortKey{path: "/z/a", size: 1}, sortKey{path: "/z/a", size: 1}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := compareSortKeys(test.field, test.a, test.b); got != test.want {
+				t.Errorf("compareSortKeys(%q, %+v, %+v) = %d, want %d",
+					test.field, test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortByFieldMixed(t *testing.T) {
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	// Collections have no size, so sort as zero-sized alongside data objects
+	entries := []*fs.Entry{
+		{Path: "/z/c/obj2", Type: fs.FileEntry, Size: 10, ModifyTime: early},
+		{Path: "/z/c/sub", Type: fs.DirectoryEntry, ModifyTime: late},
+		{Path: "/z/c/obj1", Type: fs.FileEntry, Size: 10, ModifyTime: late},
+		{Path: "/z/c/empty", Type: fs.FileEntry, Size: 0, ModifyTime: early},
+		{Path: "/z/c/a", Type: fs.DirectoryEntry, ModifyTime: early},
+	}
+	keyOf := func(entry *fs.Entry) sortKey {
+		return sortKey{path: entry.Path, size: entry.Size, modified: entry.ModifyTime}
+	}
+	paths := func(entries []*fs.Entry) []string {
+		var p []string
+		for _, entry := range entries {
+			p = append(p, entry.Path)
+		}
+		return p
+	}
+
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"", []string{"/z/c/obj2", "/z/c/sub", "/z/c/obj1", "/z/c/empty", "/z/c/a"}},
+		{parsing.JSON_ARG_SORT_PATH,
+			[]string{"/z/c/a", "/z/c/empty", "/z/c/obj1", "/z/c/obj2", "/z/c/sub"}},
+		{parsing.JSON_ARG_SORT_SIZE,
+			[]string{"/z/c/a", "/z/c/empty", "/z/c/sub", "/z/c/obj1", "/z/c/obj2"}},
+		{parsing.JSON_ARG_SORT_MODIFIED,
+			[]string{"/z/c/a", "/z/c/empty", "/z/c/obj2", "/z/c/obj1", "/z/c/sub"}},
+	}
+	for _, test := range tests {
+		t.Run(test.field, func(t *testing.T) {
+			sorted := slices.Clone(entries)
+			sortByField(sorted, test.field, keyOf)
+			if got := paths(sorted); !slices.Equal(got, test.want) {
+				t.Errorf("sortByField(%q) = %v, want %v", test.field, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// Stat reports whether an iRODS path exists and, if it does, whether it is a
+// collection or a data object, along with the size of a data object. A path that
+// does not exist is not an error; it is reported with exists set to false.
+//
+// If totalSize is true and the path is a collection, the total size and number of
+// the data objects in the collection and all its sub-collections are also reported.
+func Stat(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, totalSize bool) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var entry *fs.Entry
+
+	if err = parsing.Validate(parsing.JSON_STAT_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_STAT_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	exists := false
+	result.Exists = &exists
+
+	if entry, err = filesystem.Stat(iPath); err != nil {
+		if !types.IsFileNotFoundError(err) {
+			logger.Err(err).Msgf("Error while stating %s", iPath)
+			return result, err
+		}
+		logger.Debug().Msgf("%s does not exist", iPath)
+		result.setPath(iPath, true)
+	} else if entry.IsDir() {
+		exists = true
+		result.Type = parsing.JSON_COLLECTION_KEY
+		result.setPath(entry.Path, true)
+		if totalSize {
+			var size int64
+			var count int
+			if size, count, err = collectionSize(logger, filesystem, entry.Path); err != nil {
+				return result, err
+			}
+			result.TotalSize = &size
+			result.ObjectCount = &count
+		}
+	} else {
+		exists = true
+		result.Type = parsing.JSON_DATA_OBJECT_KEY
+		result.setPath(entry.Path, false)
+		size := entry.Size
+		result.Size = &size
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// collectionSize returns the total size and number of the data objects in a
+// collection and all its sub-collections. Each data object is counted once
+// however many replicas it has, taking the size of its largest replica, so that
+// replication does not inflate the total.
+func collectionSize(logger zerolog.Logger, filesystem *fs.FileSystem,
+	path string) (size int64, count int, err error) {
+	var conn *connection.IRODSConnection
+	var rows [][]string
+	var scope string
+
+	if scope, err = collectionScopeCondition(path); err != nil {
+		return 0, 0, err
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return 0, 0, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_D_DATA_ID, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_DATA_SIZE, selectMax)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+
+	if rows, err = executeQuery(logger, conn, query); err != nil {
+		return 0, 0, err
+	}
+
+	for _, row := range rows {
+		if !inCollectionScope(path, row[2]) {
+			continue
+		}
+		var objSize int64
+		if objSize, err = strconv.ParseInt(row[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid size '%s' for data object %s: %w",
+				row[1], row[0], err)
+		}
+		size += objSize
+		count++
+	}
+	logger.Debug().Msgf("%s contains %d data objects totalling %d bytes",
+		path, count, size)
+
+	return size, count, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// PathFields are the fields available to a put path template for each file
+// uploaded. A template is a Go text/template, e.g.
+//
+//	/zone/data/{{.AVU "sample"}}/{{.Stem}}
+//
+// where AVU gives the value of an AVU of the put input by attribute.
+type PathFields struct {
+	Basename string // Name of the local file, e.g. reads.cram
+	Stem     string // Name of the local file without its extension, e.g. reads
+	Ext      string // Extension of the local file, with its dot, e.g. .cram
+
+	avus []AVU
+}
+
+// AVU returns the value of the first of the AVUs of the put input with the
+// attribute, or an error if there is none.
+func (fields PathFields) AVU(attribute string) (string, error) {
+	for _, avu := range fields.avus {
+		if avu.Attribute == attribute {
+			return avu.Value, nil
+		}
+	}
+	return "", fmt.Errorf("no AVU with attribute '%s' in the input", attribute)
+}
+
+// newPathFields returns the path fields of a local file.
+func newPathFields(lPath string, avus []AVU) PathFields {
+	base := filepath.Base(lPath)
+	ext := filepath.Ext(base)
+	return PathFields{Basename: base, Stem: strings.TrimSuffix(base, ext), Ext: ext, avus: avus}
+}
+
+// pathTemplate computes the iRODS path of each file of a put from the templated
+// collection, and data object, of its input.
+type pathTemplate struct {
+	collection *template.Template
+	dataObject *template.Template // nil if the input gives no data object
+}
+
+// isPathTemplate returns true if s is a template rather than a literal path.
+func isPathTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// parsePathTemplate returns the path template of a put input, or nil if neither
+// its collection nor its data object is a template. The template is tried on an
+// example file, so that an unknown field, or an AVU missing from avus, is
+// reported before anything is uploaded. Errors wrap ErrInvalidArgument.
+func parsePathTemplate(logger zerolog.Logger, jsonContents map[string]interface{},
+	avus []AVU) (tmpl *pathTemplate, err error) {
+	var coll, obj string
+
+	if coll, err = parsing.GetCollectionValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	obj, _ = parsing.GetDataObjectValue(logger, jsonContents)
+	if !isPathTemplate(coll) && !isPathTemplate(obj) {
+		return nil, nil
+	}
+
+	tmpl = &pathTemplate{}
+	if tmpl.collection, err = template.New("collection").Option("missingkey=error").Parse(coll); err != nil {
+		return nil, fmt.Errorf("invalid collection template: %v: %w", err, ErrInvalidArgument)
+	}
+	if obj != "" {
+		if tmpl.dataObject, err = template.New("data_object").Option("missingkey=error").Parse(obj); err != nil {
+			return nil, fmt.Errorf("invalid data object template: %v: %w", err, ErrInvalidArgument)
+		}
+	}
+	if _, err = tmpl.resolve(newPathFields("example.txt", avus)); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// resolve returns the iRODS path of a file with the given fields, which must be
+// absolute. Errors wrap ErrInvalidArgument.
+func (tmpl *pathTemplate) resolve(fields PathFields) (iPath string, err error) {
+	var coll, obj strings.Builder
+
+	if err = tmpl.collection.Execute(&coll, fields); err != nil {
+		return "", fmt.Errorf("collection template: %v: %w", err, ErrInvalidArgument)
+	}
+	iPath = coll.String()
+	if tmpl.dataObject != nil {
+		if err = tmpl.dataObject.Execute(&obj, fields); err != nil {
+			return "", fmt.Errorf("data object template: %v: %w", err, ErrInvalidArgument)
+		}
+		iPath = path.Join(iPath, obj.String())
+	}
+	if !path.IsAbs(iPath) {
+		return "", fmt.Errorf("template gives relative path '%s' for %s: %w",
+			iPath, fields.Basename, ErrInvalidArgument)
+	}
+	return path.Clean(iPath), nil
+}
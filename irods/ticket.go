@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+// ticketPattern matches a well-formed iRODS ticket string. iRODS generates
+// tickets of letters and digits; a ticket chosen by its creator may also hold
+// dots, hyphens and underscores.
+var ticketPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,63}$`)
+
+// ticketCodes are the iRODS error codes reporting that a ticket may not be used.
+var ticketCodes = map[common.ErrorCode]bool{
+	common.CAT_TICKET_INVALID:        true,
+	common.CAT_TICKET_EXPIRED:        true,
+	common.CAT_TICKET_USES_EXCEEDED:  true,
+	common.CAT_TICKET_USER_EXCLUDED:  true,
+	common.CAT_TICKET_HOST_EXCLUDED:  true,
+	common.CAT_TICKET_GROUP_EXCLUDED: true,
+}
+
+// WithTicket returns a copy of an account that presents an iRODS ticket on each
+// connection, granting the access of the ticket, e.g. to download data shared
+// with someone who has no permission on it themselves. A ticket that is not
+// well-formed gives an error wrapping ErrInvalidArgument. A ticket that iRODS
+// does not accept, because it is unknown, has expired, has been used up or
+// excludes the user, gives an error wrapping ErrInvalidTicket when used.
+func WithTicket(account *types.IRODSAccount, ticket string) (*types.IRODSAccount, error) {
+	if !ticketPattern.MatchString(ticket) {
+		return nil, fmt.Errorf("ticket is not 1 to 63 letters, digits, dots, "+
+			"hyphens or underscores: %w", ErrInvalidArgument)
+	}
+	ticketAccount := *account
+	ticketAccount.Ticket = ticket
+	return &ticketAccount, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/rs/zerolog"
+)
+
+// operationTimeout is the longest an operation may run before it is aborted, or
+// 0 for no limit.
+var operationTimeout time.Duration
+
+// SetOperationTimeout sets the longest an operation may run before it is
+// aborted; see WithOperationTimeout. A timeout of 0 removes the limit.
+func SetOperationTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("operation timeout %s is negative: %w", timeout, ErrInvalidArgument)
+	}
+	operationTimeout = timeout
+	return nil
+}
+
+// operationDeadline tracks the file systems opened by the running operation, so
+// that they can be released to abort it once it has run for too long.
+type operationDeadline struct {
+	mutex       sync.Mutex
+	filesystems map[*fs.FileSystem]bool
+	expired     bool
+}
+
+// currentDeadline is the deadline of the running operation, or nil if there is
+// none.
+var currentDeadline *operationDeadline
+
+// track adds a file system to those of the operation, returning an error
+// wrapping ErrOperationTimeout if the operation has already expired.
+func (d *operationDeadline) track(filesystem *fs.FileSystem) error {
+	if d == nil {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.expired {
+		return fmt.Errorf("operation aborted after %s: %w", operationTimeout,
+			ErrOperationTimeout)
+	}
+	d.filesystems[filesystem] = true
+	return nil
+}
+
+// untrack removes a released file system from those of the operation.
+func (d *operationDeadline) untrack(filesystem *fs.FileSystem) {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.filesystems, filesystem)
+}
+
+// expire marks the operation as expired and releases its file systems, which
+// disconnects them so that their next request fails.
+func (d *operationDeadline) expire() {
+	d.mutex.Lock()
+	d.expired = true
+	filesystems := make([]*fs.FileSystem, 0, len(d.filesystems))
+	for filesystem := range d.filesystems {
+		filesystems = append(filesystems, filesystem)
+	}
+	d.mutex.Unlock()
+
+	// Releasing waits for any request in progress on each connection, so is done
+	// without holding the lock the operation needs to release its file systems
+	for _, filesystem := range filesystems {
+		filesystem.Release()
+	}
+}
+
+// hasExpired returns true if the operation has been aborted.
+func (d *operationDeadline) hasExpired() bool {
+	if d == nil {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.expired
+}
+
+// WithOperationTimeout performs the named operation, aborting it if it runs for
+// longer than the operation timeout. The operation is aborted by disconnecting
+// the file systems it has opened, which fails the transfer or query in progress
+// at its next request; no single request may take longer than the timeout
+// either. An aborted operation returns an error wrapping ErrOperationTimeout,
+// along with its result, if it has one. The partial local file of an aborted
+// download is removed.
+//
+// Operations must be performed one at a time.
+func WithOperationTimeout(logger zerolog.Logger, name string,
+	op func() (*OperationResult, error)) (result *OperationResult, err error) {
+	if operationTimeout == 0 {
+		return op()
+	}
+
+	deadline := &operationDeadline{filesystems: make(map[*fs.FileSystem]bool)}
+	currentDeadline = deadline
+	defer func() { currentDeadline = nil }()
+
+	timer := time.AfterFunc(operationTimeout, func() {
+		logger.Warn().Msgf("Aborting %s operation, which has run for more than %s",
+			name, operationTimeout)
+		deadline.expire()
+	})
+	result, err = op()
+	timer.Stop()
+
+	if err != nil && deadline.hasExpired() {
+		if result != nil {
+			result.Success = false
+		}
+		return result, fmt.Errorf("%s operation did not finish within %s (%v): %w",
+			name, operationTimeout, err, ErrOperationTimeout)
+	}
+	return result, err
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cyverse/go-irodsclient/icommands"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+// requestServerNegotiation is the environment file value that enables
+// client-server negotiation.
+const requestServerNegotiation = "request_server_negotiation"
+
+// SSLOverrides holds TLS settings that take precedence over those in the iRODS
+// environment file. An empty field leaves the environment's setting in place.
+type SSLOverrides struct {
+	CACertificateFile   string // Path of a CA certificate file
+	CSNegotiationPolicy string // One of CS_NEG_REQUIRE, CS_NEG_REFUSE, CS_NEG_DONT_CARE
+	EncryptionAlgorithm string // e.g. AES-256-CBC
+}
+
+// ApplySSLOverrides replaces the TLS settings of an environment manager with any
+// set in overrides. It must be called before the manager is used to create an
+// account. Settings that cannot take effect together, such as a CA certificate
+// with a policy that refuses TLS, are rejected.
+func ApplySSLOverrides(logger zerolog.Logger,
+	manager *icommands.ICommandsEnvironmentManager, overrides SSLOverrides) error {
+	env := manager.Environment
+
+	if overrides.CSNegotiationPolicy != "" {
+		policy, err := types.GetCSNegotiationRequire(overrides.CSNegotiationPolicy)
+		if err != nil {
+			return fmt.Errorf("invalid SSL negotiation policy '%s', expected one of "+
+				"%s, %s or %s: %w", overrides.CSNegotiationPolicy,
+				types.CSNegotiationRequireSSL, types.CSNegotiationRequireTCP,
+				types.CSNegotiationDontCare, ErrInvalidArgument)
+		}
+		env.ClientServerPolicy = string(policy)
+		if policy != types.CSNegotiationRequireTCP {
+			env.ClientServerNegotiation = requestServerNegotiation
+		}
+	}
+
+	if overrides.EncryptionAlgorithm != "" {
+		algorithm := types.GetEncryptionAlgorithm(overrides.EncryptionAlgorithm)
+		if algorithm == types.EncryptionAlgorithmUnknown {
+			return fmt.Errorf("invalid encryption algorithm '%s': %w",
+				overrides.EncryptionAlgorithm, ErrInvalidArgument)
+		}
+		env.EncryptionAlgorithm = string(algorithm)
+	}
+
+	if overrides.CACertificateFile != "" {
+		info, err := os.Stat(overrides.CACertificateFile)
+		if err != nil {
+			return fmt.Errorf("CA certificate file '%s' is not usable: %w",
+				overrides.CACertificateFile, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("CA certificate file '%s' is a directory: %w",
+				overrides.CACertificateFile, ErrInvalidArgument)
+		}
+		env.SSLCACertificateFile = overrides.CACertificateFile
+	}
+
+	policy, _ := types.GetCSNegotiationRequire(env.ClientServerPolicy)
+	tlsOverridden := overrides.CACertificateFile != "" || overrides.EncryptionAlgorithm != ""
+	if policy == types.CSNegotiationRequireTCP && tlsOverridden {
+		return fmt.Errorf("TLS settings were given, but the SSL negotiation policy "+
+			"%s refuses TLS: %w", policy, ErrInvalidArgument)
+	}
+	// An environment that gives no scheme uses native authentication
+	if policy == types.CSNegotiationRequireTCP && env.AuthenticationScheme != "" &&
+		types.GetAuthScheme(env.AuthenticationScheme) != types.AuthSchemeNative {
+		return fmt.Errorf("the %s authentication scheme requires TLS, but the SSL "+
+			"negotiation policy %s refuses it: %w", env.AuthenticationScheme, policy,
+			ErrInvalidArgument)
+	}
+
+	logger.Debug().
+		Str("cs_neg_policy", env.ClientServerPolicy).
+		Str("ca_cert_file", env.SSLCACertificateFile).
+		Str("enc_alg", env.EncryptionAlgorithm).
+		Msg("Applied SSL overrides")
+
+	return nil
+}
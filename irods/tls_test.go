@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyverse/go-irodsclient/icommands"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+)
+
+func TestApplySSLOverrides(t *testing.T) {
+	dir := t.TempDir()
+	caCert := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caCert, []byte("certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	refuse := string(types.CSNegotiationRequireTCP)
+	require := string(types.CSNegotiationRequireSSL)
+
+	tests := []struct {
+		name      string
+		scheme    string // Authentication scheme of the environment
+		policy    string // Negotiation policy of the environment
+		overrides SSLOverrides
+		want      error
+	}{
+		{"none", "native", "", SSLOverrides{}, nil},
+		{"require with CA cert", "native", "",
+			SSLOverrides{CSNegotiationPolicy: require, CACertificateFile: caCert}, nil},
+		{"CA cert under environment policy", "native", require,
+			SSLOverrides{CACertificateFile: caCert}, nil},
+		{"refuse with native", "native", "",
+			SSLOverrides{CSNegotiationPolicy: refuse}, nil},
+		{"refuse without a scheme", "", "",
+			SSLOverrides{CSNegotiationPolicy: refuse}, nil},
+		{"refuse with CA cert", "native", "",
+			SSLOverrides{CSNegotiationPolicy: refuse, CACertificateFile: caCert},
+			ErrInvalidArgument},
+		{"CA cert under refusing environment", "native", refuse,
+			SSLOverrides{CACertificateFile: caCert}, ErrInvalidArgument},
+		{"refuse with encryption algorithm", "native", "",
+			SSLOverrides{CSNegotiationPolicy: refuse, EncryptionAlgorithm: "AES-256-CBC"},
+			ErrInvalidArgument},
+		{"refuse with PAM", "pam_password", "",
+			SSLOverrides{CSNegotiationPolicy: refuse}, ErrInvalidArgument},
+		{"PAM under refusing environment", "pam", refuse,
+			SSLOverrides{EncryptionAlgorithm: "AES-256-CBC"}, ErrInvalidArgument},
+		{"PAM with require", "pam_password", "",
+			SSLOverrides{CSNegotiationPolicy: require}, nil},
+		{"invalid policy", "native", "",
+			SSLOverrides{CSNegotiationPolicy: "CS_NEG_MAYBE"}, ErrInvalidArgument},
+		{"invalid algorithm", "native", "",
+			SSLOverrides{EncryptionAlgorithm: "ROT13"}, ErrInvalidArgument},
+		{"missing CA cert", "native", "",
+			SSLOverrides{CACertificateFile: filepath.Join(dir, "missing.pem")}, fs.ErrNotExist},
+		{"CA cert is a directory", "native", "",
+			SSLOverrides{CACertificateFile: dir}, ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager, err := icommands.CreateIcommandsEnvironmentManager()
+			if err != nil {
+				t.Fatal(err)
+			}
+			manager.Environment.AuthenticationScheme = test.scheme
+			manager.Environment.ClientServerPolicy = test.policy
+
+			err = ApplySSLOverrides(zerolog.Nop(), manager, test.overrides)
+			if test.want == nil && err != nil {
+				t.Errorf("ApplySSLOverrides() error = %v, want none", err)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("ApplySSLOverrides() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestApplySSLOverridesSetsEnvironment(t *testing.T) {
+	manager, err := icommands.CreateIcommandsEnvironmentManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	if err = os.WriteFile(caCert, []byte("certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	overrides := SSLOverrides{
+		CACertificateFile:   caCert,
+		CSNegotiationPolicy: string(types.CSNegotiationRequireSSL),
+		EncryptionAlgorithm: "AES-256-CBC",
+	}
+	if err = ApplySSLOverrides(zerolog.Nop(), manager, overrides); err != nil {
+		t.Fatal(err)
+	}
+
+	env := manager.Environment
+	if env.SSLCACertificateFile != caCert ||
+		env.ClientServerPolicy != string(types.CSNegotiationRequireSSL) ||
+		env.ClientServerNegotiation != requestServerNegotiation ||
+		env.EncryptionAlgorithm != "AES-256-CBC" {
+		t.Errorf("environment after overrides = %+v", env)
+	}
+}
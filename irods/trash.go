@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// trashPath returns the trash collection of the user of an account, where iRODS
+// moves the data objects and collections that the user removes.
+func trashPath(account *types.IRODSAccount) string {
+	return path.Join("/", account.ClientZone, "trash", "home", account.ClientUser)
+}
+
+// Trash reports the data objects in the trash of the user of the account, with
+// their sizes, and their number. The input may give a collection within the
+// trash, to report only those beneath it, or none, for the whole trash. Any
+// other collection is rejected, so that Trash cannot be turned on data outside
+// the user's own trash.
+//
+// If empty is true, the contents of the collection are then removed
+// permanently; the collection itself, like the trash, is kept. If dryRun is
+// true, the data objects that would be removed are reported, but none is.
+func Trash(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, empty bool, dryRun bool) (
+	result *OperationResult, err error) {
+	var conn *connection.IRODSConnection
+	var rows [][]string
+	var children []*fs.Entry
+	var scope string
+
+	if err = parsing.Validate(parsing.JSON_TRASH_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	trash := trashPath(account)
+	collPath := trash
+	if coll, cerr := parsing.GetCollectionValue(logger, jsonContents); cerr == nil {
+		collPath = path.Clean(coll)
+	} else if !errors.Is(cerr, parsing.ErrMissingKey) {
+		return nil, cerr
+	}
+	if collPath != trash && !strings.HasPrefix(collPath, trash+"/") {
+		return nil, fmt.Errorf("collection %s is not within the trash %s: %w",
+			collPath, trash, ErrInvalidArgument)
+	}
+
+	if scope, err = collectionScopeCondition(collPath); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_TRASH_OP, collPath, true)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	conn.Lock()
+
+	// A data object with several replicas is reported once, with the size of
+	// its largest
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, account.ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_DATA_NAME, selectNormal)
+	query.AddSelect(common.ICAT_COLUMN_DATA_SIZE, selectMax)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+	rows, err = executeQuery(logger, conn, query)
+
+	conn.Unlock()
+	filesystem.ReturnMetadataConnection(conn)
+
+	if err != nil {
+		return result, err
+	}
+
+	trashed := make([]ListEntry, 0, len(rows))
+	for _, row := range rows {
+		if !inCollectionScope(collPath, row[0]) {
+			continue
+		}
+		size, perr := strconv.ParseInt(row[2], 10, 64)
+		if perr != nil {
+			return result, fmt.Errorf("invalid size %q of %s: %w",
+				row[2], path.Join(row[0], row[1]), perr)
+		}
+		trashed = append(trashed, ListEntry{Collection: row[0], DataObject: row[1], Size: &size})
+	}
+	slices.SortFunc(trashed, func(a, b ListEntry) int {
+		return cmp.Or(cmp.Compare(a.Collection, b.Collection), cmp.Compare(a.DataObject, b.DataObject))
+	})
+	count := len(trashed)
+	result.Count = &count
+	result.Result = trashed
+
+	if empty || dryRun {
+		if children, err = filesystem.List(collPath); err != nil {
+			return result, classifyError(err)
+		}
+	}
+	for _, child := range children {
+		if dryRun {
+			logger.Info().Msgf("Would permanently remove %s from the trash", child.Path)
+			continue
+		}
+		if child.Type == fs.DirectoryEntry {
+			err = filesystem.RemoveDir(child.Path, true, true)
+		} else {
+			err = filesystem.RemoveFile(child.Path, true)
+		}
+		if err != nil {
+			logger.Err(err).Msgf("Error while removing %s from the trash", child.Path)
+			return result, classifyError(err)
+		}
+		logger.Info().Msgf("Permanently removed %s from the trash", child.Path)
+	}
+
+	result.Success = true
+	return result, nil
+}
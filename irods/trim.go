@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	irods_fs "github.com/cyverse/go-irodsclient/irods/fs"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// NoReplica is the replica number given to Trim when no specific replica is to be
+// removed.
+const NoReplica = -1
+
+// Trim removes excess replicas of a data object. Either the replicas are trimmed
+// down to copies, or a specific replica, or those on a specific resource, are
+// removed.
+//
+// As a safety guard, iRODS is asked to keep at least minReplicas replicas,
+// which must be at least 1. When removing a replica would leave fewer, iRODS
+// either refuses, in which case its error is returned, or leaves the replica in
+// place, which is also reported as an error.
+func Trim(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, copies int, replica int, resource string,
+	minReplicas int) (result *OperationResult, err error) {
+	var iPath string
+	var coll bool
+	var before, after []*types.IRODSReplica
+
+	if err = parsing.Validate(parsing.JSON_TRIM_OP, jsonContents); err != nil {
+		return nil, err
+	}
+	if copies <= 0 && replica == NoReplica && resource == "" {
+		return nil, fmt.Errorf("trim requires a number of copies to keep, a replica "+
+			"or a resource: %w", ErrMissingArgument)
+	}
+	if replica != NoReplica && resource != "" {
+		return nil, fmt.Errorf("trim accepts a replica or a resource, not both: %w",
+			ErrInvalidArgument)
+	}
+	if minReplicas < 1 {
+		return nil, fmt.Errorf("minimum replicas %d must be at least 1: %w",
+			minReplicas, ErrInvalidArgument)
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if coll {
+		return nil, fmt.Errorf("trim requires a data object, not collection %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+
+	result = newOperationResult(parsing.JSON_TRIM_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	keep := max(copies, minReplicas)
+
+	if before, err = listReplicas(filesystem, iPath); err != nil {
+		return result, err
+	}
+	if err = trimDataObject(filesystem, iPath, resource, replica, keep); err != nil {
+		return result, fmt.Errorf("failed to trim %s, keeping at least %d replicas: %w",
+			iPath, keep, err)
+	}
+	if after, err = listReplicas(filesystem, iPath); err != nil {
+		return result, err
+	}
+
+	remaining := len(after)
+	result.Replicas = &remaining
+	result.Trimmed = len(before) - len(after)
+	logger.Info().Msgf("Trimmed %d of %d replicas of %s", result.Trimmed, len(before), iPath)
+
+	if replica != NoReplica {
+		for _, r := range after {
+			if r.Number == int64(replica) {
+				return result, fmt.Errorf("replica %d of %s was not trimmed, "+
+					"as that would leave fewer than %d replicas: %w",
+					replica, iPath, keep, ErrInvalidArgument)
+			}
+		}
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// listReplicas returns the replicas of a data object.
+func listReplicas(filesystem *fs.FileSystem, iPath string) (
+	replicas []*types.IRODSReplica, err error) {
+	var conn *connection.IRODSConnection
+	var collection *types.IRODSCollection
+	var dataObject *types.IRODSDataObject
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return nil, err
+	}
+
+	// Not locked here; the irods_fs functions lock the connection themselves
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	if collection, err = irods_fs.GetCollection(conn, path.Dir(iPath)); err != nil {
+		return nil, err
+	}
+	if dataObject, err = irods_fs.GetDataObject(conn, collection, path.Base(iPath)); err != nil {
+		return nil, err
+	}
+	return dataObject.Replicas, nil
+}
+
+// trimDataObject asks iRODS to trim the replicas of a data object, keeping at
+// least keep of them. Unlike irods_fs.TrimDataObject, it does not restrict the
+// trim to the default resource when no resource is given.
+func trimDataObject(filesystem *fs.FileSystem, iPath string, resource string,
+	replica int, keep int) (err error) {
+	var conn *connection.IRODSConnection
+
+	request := message.NewIRODSMessageTrimDataObjectRequest(iPath, resource, keep, 0)
+	if replica != NoReplica {
+		request.AddKeyVal(common.REPL_NUM_KW, strconv.Itoa(replica))
+	}
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	response := message.IRODSMessageTrimDataObjectResponse{}
+	return conn.RequestAndCheck(request, &response, nil)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package irods
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/rs/zerolog"
+	"github.com/wtsi-npg/go-baton/parsing"
+)
+
+// AttributeValue is a distinct value of a metadata attribute, with the number of
+// data objects that have it, where that was counted.
+type AttributeValue struct {
+	Value string `json:"value"`
+	Count *int   `json:"count,omitempty"`
+}
+
+// Values reports the distinct values that the attribute named in the input takes
+// on the data objects in a collection, in value order, along with their number.
+// If recurse is true, the data objects in all its sub-collections are also
+// included. If count is true, the number of data objects with each value is
+// also reported.
+func Values(logger zerolog.Logger, account *types.IRODSAccount,
+	jsonContents map[string]interface{}, recurse bool, count bool) (
+	result *OperationResult, err error) {
+	var iPath, attr, attrCond string
+	var coll bool
+	var conn *connection.IRODSConnection
+
+	if err = parsing.Validate(parsing.JSON_VALUES_OP, jsonContents); err != nil {
+		return nil, err
+	}
+
+	if iPath, coll, err = parsing.GetiRODSPath(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if !coll {
+		return nil, fmt.Errorf("values requires a collection, not data object %s: %w",
+			iPath, ErrInvalidArgument)
+	}
+	if attr, err = parsing.GetAttributeValue(logger, jsonContents); err != nil {
+		return nil, err
+	}
+	if attrCond, err = valueCondition("=", attr); err != nil {
+		return nil, err
+	}
+
+	result = newOperationResult(parsing.JSON_VALUES_OP, iPath, coll)
+
+	filesystem, err := newFileSystem(logger, account)
+	if err != nil {
+		return result, err
+	}
+
+	defer releaseFileSystem(filesystem)
+
+	if conn, err = getMetadataConnection(filesystem); err != nil {
+		return result, err
+	}
+
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+
+	defer conn.Unlock()
+
+	var scope string
+	if recurse {
+		scope, err = collectionScopeCondition(iPath)
+	} else {
+		scope, err = valueCondition("=", iPath)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// Genquery returns distinct rows, so selecting the data object ID as well
+	// gives one row for each data object with a value, however many replicas
+	// it has, which are counted here
+	query := newQuery()
+	query.AddKeyVal(common.ZONE_KW, conn.GetAccount().ClientZone)
+	query.AddSelect(common.ICAT_COLUMN_META_DATA_ATTR_VALUE, selectNormal)
+	if count {
+		query.AddSelect(common.ICAT_COLUMN_D_DATA_ID, selectNormal)
+	}
+	query.AddSelect(common.ICAT_COLUMN_COLL_NAME, selectNormal)
+	query.AddCondition(common.ICAT_COLUMN_META_DATA_ATTR_NAME, attrCond)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, scope)
+
+	counts := make(map[string]int)
+	if err = forEachRow(logger, conn, query, func(row []string) error {
+		if !inCollectionScope(iPath, row[len(row)-1]) {
+			return nil
+		}
+		counts[row[0]]++
+		return nil
+	}); err != nil {
+		return result, err
+	}
+
+	values := make([]AttributeValue, 0, len(counts))
+	for value, n := range counts {
+		v := AttributeValue{Value: value}
+		if count {
+			v.Count = &n
+		}
+		values = append(values, v)
+	}
+	slices.SortFunc(values, func(a, b AttributeValue) int {
+		return cmp.Compare(a.Value, b.Value)
+	})
+	logger.Debug().Msgf("Found %d values of attribute %s in %s", len(values), attr, iPath)
+
+	valueCount := len(values)
+	result.Count = &valueCount
+	result.Result = values
+
+	result.Success = true
+	return result, nil
+}
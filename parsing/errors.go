@@ -25,4 +25,8 @@ import (
 var (
 	ErrJSON       = errors.New("JSON Error")
 	ErrMissingKey = fmt.Errorf("%w: missing key", ErrJSON)
+	ErrWrongType  = fmt.Errorf("%w: wrong type", ErrJSON)
+	ErrBadValue   = fmt.Errorf("%w: bad value", ErrJSON)
+
+	ErrInvalidMetadataValue = fmt.Errorf("%w: invalid metadata value", ErrBadValue)
 )
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parsing
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normaliseMetadata is true if metadata strings are normalised to Unicode NFC.
+var normaliseMetadata bool
+
+// SetNormaliseMetadata sets whether the attribute, value and units of each AVU
+// are normalised to Unicode NFC, so that text composed differently, e.g. an
+// accented letter typed as a letter and a combining accent, is stored and
+// matched the same way.
+func SetNormaliseMetadata(normalise bool) {
+	normaliseMetadata = normalise
+}
+
+// checkMetadataString returns a metadata string, normalised if
+// SetNormaliseMetadata is set, or an error wrapping ErrInvalidMetadataValue if it
+// is not valid UTF-8 or contains a control character. iRODS may store such a
+// string mangled, or reject it with an error that does not say why.
+func checkMetadataString(key string, value string) (string, error) {
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if r == utf8.RuneError && size == 1 {
+			return "", fmt.Errorf("%s %q has invalid UTF-8 byte 0x%02x at offset %d: %w",
+				key, value, value[i], i, ErrInvalidMetadataValue)
+		}
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("%s %q has control character %U at offset %d: %w",
+				key, value, r, i, ErrInvalidMetadataValue)
+		}
+		i += size
+	}
+
+	if normaliseMetadata {
+		return norm.NFC.String(value), nil
+	}
+	return value, nil
+}
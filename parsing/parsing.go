@@ -17,12 +17,15 @@
 package parsing
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cyverse/go-irodsclient/irods/common"
 	"github.com/cyverse/go-irodsclient/irods/message"
@@ -41,16 +44,34 @@ const (
 	JSON_DATA_OBJECT_KEY       = "data_object"
 	JSON_DATA_OBJECT_SHORT_KEY = "obj"
 	JSON_DATA_KEY              = "data"
+	JSON_ENCODING_KEY          = "encoding"
+	JSON_ENCODING_UTF8         = "utf-8"
+	JSON_ENCODING_BASE64       = "base64"
 	JSON_CONTENTS_KEY          = "contents"
 	JSON_SIZE_KEY              = "size"
 	JSON_CHECKSUM_KEY          = "checksum"
 	JSON_TIMESTAMPS_KEY        = "timestamps"
 	JSON_TIMESTAMPS_SHORT_KEY  = "time"
+	JSON_EXISTS_KEY            = "exists"
+	JSON_TYPE_KEY              = "type"
+	JSON_TOTAL_SIZE_KEY        = "total_size"
+	JSON_OBJECT_COUNT_KEY      = "object_count"
+	JSON_RESOURCE_KEY          = "resource"
+	JSON_PHYSICAL_PATH_KEY     = "physical_path"
+	JSON_TICKET_KEY            = "ticket"
+
+	// Checksum statuses, comparing a recomputed checksum with the registered one
+	JSON_CHECKSUM_MATCH        = "match"
+	JSON_CHECKSUM_MISMATCH     = "mismatch"
+	JSON_CHECKSUM_UNREGISTERED = "unregistered"
 
 	// Permissions
 	JSON_ACCESS_KEY = "access"
 	JSON_OWNER_KEY  = "owner"
 	JSON_LEVEL_KEY  = "level"
+	JSON_LEVEL_NONE = "none"
+	JSON_USER       = "user"
+	JSON_GROUP      = "group"
 
 	// Metadata attributes, values
 	JSON_AVUS_KEY            = "avus"
@@ -71,8 +92,19 @@ const (
 	JSON_OPERATOR_SHORT_KEY = "o"
 	JSON_ARGS_KEY           = "args"
 	JSON_ARGS_SHORT_KEY     = "?"
+	JSON_KEYWORDS_KEY       = "keywords"
 	JSON_ARG_META_ADD       = "add"
 	JSON_ARG_META_REM       = "rem"
+	JSON_ARG_META_UNITS     = "units"
+	JSON_ARG_SORT_PATH      = "path"
+	JSON_ARG_SORT_SIZE      = "size"
+	JSON_ARG_SORT_MODIFIED  = "modified"
+
+	// Strategies for a get whose local file already exists
+	JSON_ARG_CONFLICT_ERROR     = "error"
+	JSON_ARG_CONFLICT_SKIP      = "skip"
+	JSON_ARG_CONFLICT_OVERWRITE = "overwrite"
+	JSON_ARG_CONFLICT_RENAME    = "rename"
 
 	// SQL specific query operations
 	JSON_SPECIFIC_KEY  = "specific"
@@ -87,38 +119,88 @@ const (
 	JSON_OP_KEY              = "operation"
 	JSON_OP_SHORT_KEY        = "op"
 
-	JSON_CHMOD_OP     = "chmod"
-	JSON_CHECKSUM_OP  = "checksum"
-	JSON_GET_OP       = "get"
-	JSON_LIST_OP      = "list"
-	JSON_METAMOD_OP   = "metamod"
-	JSON_METAQUERY_OP = "metaquery"
-	JSON_PUT_OP       = "put"
-	JSON_MOVE_OP      = "move"
-	JSON_RM_OP        = "remove"
-	JSON_MKCOLL_OP    = "mkdir"
-	JSON_RMCOLL_OP    = "rmdir"
+	JSON_ATTRIBUTES_OP = "attributes"
+	JSON_CHMOD_OP      = "chmod"
+	JSON_CHECKSUM_OP   = "checksum"
+	JSON_COPY_OP       = "copy"
+	JSON_DUPLICATES_OP = "duplicates"
+	JSON_FIND_OP       = "find"
+	JSON_GET_OP        = "get"
+	JSON_LIST_OP       = "list"
+	JSON_MANIFEST_OP   = "manifest"
+	JSON_METACOPY_OP   = "metacopy"
+	JSON_METAMOD_OP    = "metamod"
+	JSON_METAQUERY_OP  = "metaquery"
+	JSON_PRUNE_OP      = "prune"
+	JSON_PUT_OP        = "put"
+	JSON_REPLICATE_OP  = "replicate"
+	JSON_MOVE_OP       = "move"
+	JSON_RM_OP         = "remove"
+	JSON_MKCOLL_OP     = "mkdir"
+	JSON_REGISTER_OP   = "register"
+	JSON_RMCOLL_OP     = "rmdir"
+	JSON_STAT_OP       = "stat"
+	JSON_TRASH_OP      = "trash"
+	JSON_TRIM_OP       = "trim"
+	JSON_VALUES_OP     = "values"
 
 	JSON_OP_ARGS_KEY       = "arguments"
 	JSON_OP_ARGS_SHORT_KEY = "args"
 
-	JSON_OP_ACL           = "acl"
-	JSON_OP_AVU           = "avu"
-	JSON_OP_CHECKSUM      = "checksum"
-	JSON_OP_VERIFY        = "verify"
-	JSON_OP_FORCE         = "force"
-	JSON_OP_COLLECTION    = "collection"
-	JSON_OP_CONTENTS      = "contents"
-	JSON_OP_OBJECT        = "object"
-	JSON_OP_OPERATION     = "operation"
-	JSON_OP_RAW           = "raw"
-	JSON_OP_RECURSE       = "recurse"
-	JSON_OP_REPLICATE     = "replicate"
-	JSON_OP_SAVE          = "save"
-	JSON_OP_SINGLE_SERVER = "single-server"
-	JSON_OP_SIZE          = "size"
-	JSON_OP_TIMESTAMP     = "timestamp"
-	JSON_OP_PATH          = "path"
+	JSON_OP_ACL               = "acl"
+	JSON_OP_ALL               = "all"
+	JSON_OP_ALL_ZONES         = "all-zones"
+	JSON_OP_AVU               = "avu"
+	JSON_OP_CHECKSUM          = "checksum"
+	JSON_OP_CHECKSUM_RETRY    = "checksum-retry"
+	JSON_OP_CHECKSUM_WORKERS  = "checksum-workers"
+	JSON_OP_VERIFY            = "verify"
+	JSON_OP_FORCE             = "force" // Deprecated: use JSON_OP_OVERWRITE or JSON_OP_NO_TRASH
+	JSON_OP_FORCE_RECOMPUTE   = "force-recompute-checksum"
+	JSON_OP_IGNORE_CASE       = "ignore-case"
+	JSON_OP_INCLUDE           = "include"
+	JSON_OP_INCLUDE_CHECKSUM  = "include-checksum"
+	JSON_OP_MAX_DEPTH         = "max-depth"
+	JSON_OP_MAX_INLINE_SIZE   = "max-inline-size"
+	JSON_OP_MAX_OBJECT_SIZE   = "max-object-size"
+	JSON_OP_MIN_REPLICAS      = "min-replicas"
+	JSON_OP_EXCLUDE           = "exclude"
+	JSON_OP_FOLLOW_REDIRECT   = "follow-redirect"
+	JSON_OP_FOLLOW_SYMLINKS   = "follow-symlinks"
+	JSON_OP_COLLECTION        = "collection"
+	JSON_OP_CONTENTS          = "contents"
+	JSON_OP_COPIES            = "copies"
+	JSON_OP_COUNT             = "count"
+	JSON_OP_DEFAULT_UNITS     = "default-units"
+	JSON_OP_DRY_RUN           = "dry-run"
+	JSON_OP_EMPTY_TRASH       = "empty-trash"
+	JSON_OP_NO_TRASH          = "no-trash"
+	JSON_OP_OBJECT            = "object"
+	JSON_OP_ON_CONFLICT       = "on-conflict"
+	JSON_OP_OPERATION         = "operation"
+	JSON_OP_OVERWRITE         = "overwrite"
+	JSON_OP_PRESERVE          = "preserve"
+	JSON_OP_PRESERVE_ACLS     = "preserve-acls"
+	JSON_OP_PRUNE_EMPTY       = "prune-empty-collections"
+	JSON_OP_RAW               = "raw"
+	JSON_OP_RECURSE           = "recurse"
+	JSON_OP_REDIRECT_FALLBACK = "redirect-fallback"
+	JSON_OP_REPLICA           = "replica"
+	JSON_OP_REPLICATE         = "replicate"
+	JSON_OP_REQUIRE_CHECKSUM  = "require-checksum"
+	JSON_OP_RESOURCE          = "resource"
+	JSON_OP_RESOURCE_POOL     = "resource-pool"
+	JSON_OP_SAVE              = "save"
+	JSON_OP_SINGLE_SERVER     = "single-server"
+	JSON_OP_SKIP_UNCHANGED    = "skip-unchanged"
+	JSON_OP_SIZE              = "size"
+	JSON_OP_SORT              = "sort"
+	JSON_OP_STRICT            = "strict"
+	JSON_OP_TICKET            = "ticket"
+	JSON_OP_TIMESTAMP         = "timestamp"
+	JSON_OP_TOTAL_SIZE        = "total-size"
+	JSON_OP_UPDATE_CATALOG    = "update-catalog"
+	JSON_OP_PATH              = "path"
 
 	VALID_REPLICATE   = "1"
 	INVALID_REPLICATE = "0"
@@ -127,24 +209,48 @@ const (
 type MetaQueryColumns struct {
 	AttributeCondition common.ICATColumnNumber
 	ValueCondition     common.ICATColumnNumber
+	UnitsCondition     common.ICATColumnNumber
+	OwnerCondition     common.ICATColumnNumber
+	OwnerZoneCondition common.ICATColumnNumber
 	ReturnColumns      []common.ICATColumnNumber
 	JSONKeys           []string
 }
 
+// ParseStdin reads a stream of JSON objects from stdin, returning them in the
+// order they were read. Each object is the input for one operation.
 func ParseStdin(logger zerolog.Logger, args []string) (
-	inputContents map[string]interface{}) {
-	input, err := io.ReadAll(os.Stdin)
-	if err != nil {
+	inputContents []map[string]interface{}) {
+	inputContents, err := ParseInput(logger, os.Stdin)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		logger.Err(err).Msg("Failed to decode json")
+		os.Exit(1)
+	} else if err != nil {
 		logger.Err(err).Msg("Failed to read stdin")
 		os.Exit(74)
 	}
+	return inputContents
+}
 
-	err = json.Unmarshal(input, &inputContents)
-	if err != nil {
-		logger.Err(err).Msg("Failed to decode json")
-		os.Exit(1)
+// ParseInput returns the stream of JSON objects read from r, in order. An error
+// decoding them is a *json.SyntaxError or *json.UnmarshalTypeError.
+func ParseInput(logger zerolog.Logger, r io.Reader) (
+	inputContents []map[string]interface{}, err error) {
+	decoder := json.NewDecoder(r)
+	for {
+		var envelope map[string]interface{}
+		err = decoder.Decode(&envelope)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputContents = append(inputContents, envelope)
 	}
-	return inputContents
+	logger.Debug().Msgf("Read %d inputs", len(inputContents))
+	return inputContents, nil
 }
 
 func ExtractJSONValue(logger zerolog.Logger, value interface{}, extracted any) (
@@ -162,14 +268,43 @@ func ExtractJSONValue(logger zerolog.Logger, value interface{}, extracted any) (
 	return nil
 }
 
+// scalarToString returns the string form of a JSON scalar. Numbers and booleans
+// are coerced to their JSON text; any other non-string type is rejected with
+// ErrWrongType naming the key and the type encountered.
+func scalarToString(key string, raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("key %s is an object, expected a string: %w",
+			key, ErrWrongType)
+	case []interface{}:
+		return "", fmt.Errorf("key %s is an array, expected a string: %w",
+			key, ErrWrongType)
+	default:
+		return "", fmt.Errorf("key %s has type %T, expected a string: %w",
+			key, raw, ErrWrongType)
+	}
+}
+
 func getStringValue(logger zerolog.Logger, object map[string]interface{},
 	key string, short_key string) (value string, err error) {
-	if err = ExtractJSONValue(logger, object[key], &value); err != nil {
+	if value, err = scalarToString(key, object[key]); err != nil {
+		logger.Err(err).Msg("Invalid value in json")
 		return "", err
 	}
-	if value == "" {
+	if value == "" && short_key != "" {
 		logger.Debug().Msgf("No key %s, looking for short key %s", key, short_key)
-		if err = ExtractJSONValue(logger, object[short_key], &value); err != nil {
+		if value, err = scalarToString(short_key, object[short_key]); err != nil {
+			logger.Err(err).Msg("Invalid value in json")
 			return "", err
 		}
 	}
@@ -182,6 +317,139 @@ func getStringValue(logger zerolog.Logger, object map[string]interface{},
 
 }
 
+func getBoolValue(logger zerolog.Logger, object map[string]interface{},
+	key string) (value bool, err error) {
+	switch v := object[key].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		logger.Debug().Msgf("Found %s: %t", key, v)
+		return v, nil
+	default:
+		return false, fmt.Errorf("key %s has type %T, expected a boolean: %w",
+			key, v, ErrWrongType)
+	}
+}
+
+func getObjectValue(object map[string]interface{}, key string,
+	short_key string) (value map[string]interface{}, err error) {
+	raw, ok := object[key]
+	if !ok && short_key != "" {
+		raw, ok = object[short_key]
+	}
+	if !ok || raw == nil {
+		return nil, fmt.Errorf("no %s key found: %w", key, ErrMissingKey)
+	}
+	if value, ok = raw.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("key %s has type %T, expected an object: %w",
+			key, raw, ErrWrongType)
+	}
+	return value, nil
+}
+
+// GetOperation returns the name of the operation requested by a baton-do
+// style envelope.
+func GetOperation(logger zerolog.Logger, envelope map[string]interface{}) (
+	string, error) {
+	return getStringValue(logger, envelope, JSON_OP_KEY, JSON_OP_SHORT_KEY)
+}
+
+// GetTarget returns the target of a baton-do style envelope i.e. the path
+// and metadata the operation acts on.
+func GetTarget(logger zerolog.Logger, envelope map[string]interface{}) (
+	map[string]interface{}, error) {
+	return getObjectValue(envelope, JSON_TARGET_KEY, "")
+}
+
+// GetArguments returns the arguments of a baton-do style envelope. The
+// arguments are optional, so an envelope without them yields an empty map.
+func GetArguments(logger zerolog.Logger, envelope map[string]interface{}) (
+	args map[string]interface{}, err error) {
+	if args, err = getObjectValue(envelope, JSON_OP_ARGS_KEY,
+		JSON_OP_ARGS_SHORT_KEY); errors.Is(err, ErrMissingKey) {
+		logger.Debug().Msg("No arguments in envelope")
+		return map[string]interface{}{}, nil
+	}
+	return args, err
+}
+
+// GetBoolArgument returns the value of a boolean operation argument, which
+// is false when absent.
+func GetBoolArgument(logger zerolog.Logger, args map[string]interface{},
+	key string) (bool, error) {
+	return getBoolValue(logger, args, key)
+}
+
+// GetBoolArgumentDefault returns the value of a boolean operation argument,
+// which is defaultValue when absent.
+func GetBoolArgumentDefault(logger zerolog.Logger, args map[string]interface{},
+	key string, defaultValue bool) (bool, error) {
+	if args[key] == nil {
+		return defaultValue, nil
+	}
+	return getBoolValue(logger, args, key)
+}
+
+// GetIntArgument returns the value of an operation argument that is an integer,
+// which is defaultValue when absent.
+func GetIntArgument(logger zerolog.Logger, args map[string]interface{},
+	key string, defaultValue int) (int, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return defaultValue, nil
+	case int:
+		return v, nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("key %s has value %v, expected an integer: %w",
+				key, v, ErrWrongType)
+		}
+		logger.Debug().Msgf("Found %s: %d", key, int(v))
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("key %s has type %T, expected an integer: %w",
+			key, v, ErrWrongType)
+	}
+}
+
+// GetStringListArgument returns the value of an operation argument that is a
+// list of strings, which is empty when absent.
+func GetStringListArgument(logger zerolog.Logger, args map[string]interface{},
+	key string) (values []string, err error) {
+	raw, ok := args[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch v := raw.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		for i, elt := range v {
+			str, ok := elt.(string)
+			if !ok {
+				return nil, fmt.Errorf("element %d of key %s has type %T, expected a string: %w",
+					i, key, elt, ErrWrongType)
+			}
+			values = append(values, str)
+		}
+		logger.Debug().Msgf("Found %s: %v", key, values)
+		return values, nil
+	default:
+		return nil, fmt.Errorf("key %s has type %T, expected an array: %w",
+			key, raw, ErrWrongType)
+	}
+}
+
+// GetStringArgument returns the value of a string operation argument, which
+// is empty when absent.
+func GetStringArgument(logger zerolog.Logger, args map[string]interface{},
+	key string) (value string, err error) {
+	if value, err = getStringValue(logger, args, key, ""); errors.Is(err, ErrMissingKey) {
+		return "", nil
+	}
+	return value, err
+}
+
 func GetCollectionValue(logger zerolog.Logger, object map[string]interface{}) (
 	string, error) {
 	return getStringValue(logger, object, JSON_COLLECTION_KEY, JSON_COLLECTION_SHORT_KEY)
@@ -209,6 +477,33 @@ func GetiRODSPath(logger zerolog.Logger, object map[string]interface{}) (
 	return filepath.Clean(fmt.Sprintf("%s/%s", coll, obj)), false, nil
 }
 
+func GetResourceValue(logger zerolog.Logger, object map[string]interface{}) (
+	string, error) {
+	return getStringValue(logger, object, JSON_RESOURCE_KEY, "")
+}
+
+// GetTicketValue returns the iRODS ticket of an object, which may be either a
+// target or operation arguments, since JSON_TICKET_KEY and JSON_OP_TICKET are the
+// same. Unlike other values, the ticket is not logged, since it grants access
+// to data.
+func GetTicketValue(object map[string]interface{}) (string, error) {
+	ticket, err := scalarToString(JSON_TICKET_KEY, object[JSON_TICKET_KEY])
+	if err != nil {
+		return "", err
+	}
+	if ticket == "" {
+		return "", fmt.Errorf("no %s key found: %w", JSON_TICKET_KEY, ErrMissingKey)
+	}
+	return ticket, nil
+}
+
+// GetPhysicalPathValue returns the path of a file on the filesystem of a
+// resource.
+func GetPhysicalPathValue(logger zerolog.Logger, object map[string]interface{}) (
+	string, error) {
+	return getStringValue(logger, object, JSON_PHYSICAL_PATH_KEY, "")
+}
+
 func GetDirectoryValue(logger zerolog.Logger, object map[string]interface{}) (
 	string, error) {
 	return getStringValue(logger, object, JSON_DIRECTORY_KEY, JSON_DIRECTORY_SHORT_KEY)
@@ -235,9 +530,37 @@ func GetLocalPath(logger zerolog.Logger, object map[string]interface{}) (
 	return filepath.Clean(fmt.Sprintf("%s/%s", dir, file)), false, nil
 }
 
+// GetInlineData returns the content of a data object given inline, as a string
+// under the data key. The string is taken as UTF-8 text, unless the encoding key
+// is base64, in which case it is decoded.
+func GetInlineData(logger zerolog.Logger, object map[string]interface{}) (
+	data []byte, err error) {
+	raw, ok := object[JSON_DATA_KEY].(string)
+	if !ok {
+		return nil, fmt.Errorf("key %s has type %T, expected a string: %w",
+			JSON_DATA_KEY, object[JSON_DATA_KEY], ErrWrongType)
+	}
+
+	switch encoding := object[JSON_ENCODING_KEY]; encoding {
+	case nil, JSON_ENCODING_UTF8:
+		data = []byte(raw)
+	case JSON_ENCODING_BASE64:
+		if data, err = base64.StdEncoding.DecodeString(raw); err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64 (%v): %w",
+				JSON_DATA_KEY, err, ErrWrongType)
+		}
+	default:
+		return nil, fmt.Errorf("key %s has value '%v', expected %s or %s: %w",
+			JSON_ENCODING_KEY, encoding, JSON_ENCODING_UTF8, JSON_ENCODING_BASE64,
+			ErrWrongType)
+	}
+	logger.Debug().Msgf("Found %d bytes of inline data", len(data))
+	return data, nil
+}
+
 func GetACLList(logger zerolog.Logger, object map[string]interface{}) (
 	acls []interface{}, err error) {
-	if err = ExtractJSONValue(logger, object[JSON_ACCESS_KEY], acls); err != nil {
+	if err = ExtractJSONValue(logger, object[JSON_ACCESS_KEY], &acls); err != nil {
 		return nil, err
 	}
 
@@ -252,6 +575,14 @@ func GetAVUsList(logger zerolog.Logger, object map[string]interface{}) (
 	return avus, nil
 }
 
+// GetAttributeValue returns the metadata attribute named by an object.
+func GetAttributeValue(logger zerolog.Logger, object map[string]interface{}) (
+	string, error) {
+	return getStringValue(logger, object, JSON_ATTRIBUTE_KEY, JSON_ATTRIBUTE_SHORT_KEY)
+}
+
+// GetAVUValues returns the attribute, value and units of an AVU. Each is checked
+// and normalised as described for checkMetadataString.
 func GetAVUValues(logger zerolog.Logger, object map[string]interface{}) (
 	attr string, value string, units string, err error) {
 	if attr, err = getStringValue(
@@ -273,38 +604,165 @@ func GetAVUValues(logger zerolog.Logger, object map[string]interface{}) (
 	); err != nil && !errors.Is(err, ErrMissingKey) {
 		return "", "", "", err
 	}
+
+	if attr, err = checkMetadataString(JSON_ATTRIBUTE_KEY, attr); err != nil {
+		return "", "", "", err
+	}
+	if value, err = checkMetadataString(JSON_VALUE_KEY, value); err != nil {
+		return "", "", "", err
+	}
+	if units, err = checkMetadataString(JSON_UNITS_KEY, units); err != nil {
+		return "", "", "", err
+	}
 	return attr, value, units, nil
 }
 
+// GetAVUOperator returns the metamod operation of an AVU, which is empty when the
+// AVU does not have one.
+func GetAVUOperator(logger zerolog.Logger, object map[string]interface{}) (
+	op string, err error) {
+	if op, err = getStringValue(logger, object, JSON_OPERATOR_KEY,
+		JSON_OPERATOR_SHORT_KEY); errors.Is(err, ErrMissingKey) {
+		return "", nil
+	}
+	return op, err
+}
+
+// GetQueryKeywords returns the extra genquery keywords of a metadata query, which
+// are optional, as an object mapping each keyword to its value.
+func GetQueryKeywords(logger zerolog.Logger, object map[string]interface{}) (
+	keywords map[string]string, err error) {
+	var raw map[string]interface{}
+	if raw, err = getObjectValue(object, JSON_KEYWORDS_KEY, ""); errors.Is(err, ErrMissingKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keywords = make(map[string]string, len(raw))
+	for keyword, value := range raw {
+		if keywords[keyword], err = scalarToString(keyword, value); err != nil {
+			return nil, err
+		}
+	}
+	logger.Debug().Msgf("Found %s: %v", JSON_KEYWORDS_KEY, keywords)
+	return keywords, nil
+}
+
+// GetAVUQuery returns the attribute, value, units and operator of an AVU query
+// condition. The units are empty if the condition does not give them, when the
+// query matches AVUs with any units.
 func GetAVUQuery(logger zerolog.Logger, object map[string]interface{}) (
-	attr string, value string, op string, err error) {
-	if attr, value, _, err = GetAVUValues(logger, object); err != nil {
-		return "", "", "", err
+	attr string, value string, units string, op string, err error) {
+	if attr, value, units, err = GetAVUValues(logger, object); err != nil {
+		return "", "", "", "", err
 	}
 
 	// operator defaults to equals
 	if op, err = getStringValue(logger, object, JSON_OPERATOR_KEY,
 		JSON_OPERATOR_SHORT_KEY); err != nil && !errors.Is(err, ErrMissingKey) {
-		return "", "", "", err
+		return "", "", "", "", err
 	}
 
-	return attr, value, op, nil
+	return attr, value, units, op, nil
 }
 
+// GetACLQuery returns the owner, access level and zone of an ACL. A level of
+// null, as either JSON null or the string "null", or of "none" is the null access
+// level, which revokes the owner's access. Any other level must be one that
+// iRODS recognises.
+//
+// The owner may be given as user#zone, as iRODS writes a user of another zone,
+// in which case the zone key may be omitted, or must agree.
 func GetACLQuery(logger zerolog.Logger, object map[string]interface{}) (
 	owner string, level types.IRODSAccessLevelType, zone string, err error) {
-	var levelstr string
 	if owner, err = getStringValue(logger, object, JSON_OWNER_KEY, ""); err != nil {
 		return "", "", "", err
 	}
-	if levelstr, err = getStringValue(logger, object, JSON_LEVEL_KEY, ""); err != nil {
+	if level, err = getAccessLevel(logger, object); err != nil {
 		return "", "", "", err
 	}
 	if zone, err = getStringValue(logger, object, JSON_ZONE_KEY, ""); err != nil &&
 		!errors.Is(err, ErrMissingKey) {
 		return "", "", "", err
 	}
-	return owner, types.IRODSAccessLevelType(levelstr), zone, err
+
+	if name, ownerZone, found := strings.Cut(owner, "#"); found {
+		if name == "" || ownerZone == "" || strings.Contains(ownerZone, "#") {
+			return "", "", "", fmt.Errorf("ACL owner '%s' is not of the form user#zone: %w",
+				owner, ErrBadValue)
+		}
+		if zone != "" && zone != ownerZone {
+			return "", "", "", fmt.Errorf("ACL owner '%s' is in a different zone to the "+
+				"ACL zone '%s': %w", owner, zone, ErrBadValue)
+		}
+		owner, zone = name, ownerZone
+	}
+	return owner, level, zone, nil
+}
+
+// GetOwnerQuery returns the user and, if given, zone of the owner key of a query,
+// which matches the objects that user owns. The owner may be given as user#zone,
+// as iRODS writes a user of another zone. An error wrapping ErrMissingKey is
+// returned if the query has no owner.
+func GetOwnerQuery(logger zerolog.Logger, object map[string]interface{}) (
+	owner string, zone string, err error) {
+	if owner, err = getStringValue(logger, object, JSON_OWNER_KEY, ""); err != nil {
+		return "", "", err
+	}
+	if name, ownerZone, found := strings.Cut(owner, "#"); found {
+		if name == "" || ownerZone == "" || strings.Contains(ownerZone, "#") {
+			return "", "", fmt.Errorf("owner '%s' is not of the form user#zone: %w",
+				owner, ErrBadValue)
+		}
+		owner, zone = name, ownerZone
+	}
+	return owner, zone, nil
+}
+
+// GetACLOwnerType returns whether the owner of an ACL is a user or a group, if the
+// ACL says so under the type key, or an empty string if it does not.
+func GetACLOwnerType(logger zerolog.Logger, object map[string]interface{}) (
+	ownerType string, err error) {
+	ownerType, err = getStringValue(logger, object, JSON_TYPE_KEY, "")
+	if errors.Is(err, ErrMissingKey) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if ownerType != JSON_USER && ownerType != JSON_GROUP {
+		return "", fmt.Errorf("ACL owner type '%s' is not %s or %s: %w",
+			ownerType, JSON_USER, JSON_GROUP, ErrBadValue)
+	}
+	return ownerType, nil
+}
+
+// getAccessLevel returns the access level of an ACL, as described for
+// GetACLQuery.
+func getAccessLevel(logger zerolog.Logger, object map[string]interface{}) (
+	types.IRODSAccessLevelType, error) {
+	if raw, ok := object[JSON_LEVEL_KEY]; ok && raw == nil {
+		return types.IRODSAccessLevelNull, nil
+	}
+
+	levelstr, err := getStringValue(logger, object, JSON_LEVEL_KEY, "")
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(levelstr, JSON_LEVEL_NONE) {
+		return types.IRODSAccessLevelNull, nil
+	}
+
+	// The client maps any level it does not recognise to null, which would
+	// silently revoke access, so only an explicit null is allowed to map there
+	if types.GetIRODSAccessLevelType(levelstr) != types.IRODSAccessLevelNull {
+		return types.IRODSAccessLevelType(levelstr), nil
+	}
+	if !strings.EqualFold(levelstr, string(types.IRODSAccessLevelNull)) {
+		return "", fmt.Errorf("unknown access level '%s': %w", levelstr, ErrBadValue)
+	}
+	return types.IRODSAccessLevelNull, nil
 }
 
 func IRODSXMLToJSON(logger zerolog.Logger,
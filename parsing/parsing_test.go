@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parsing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestScalarToString(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"string", "abc", "abc"},
+		{"empty string", "", ""},
+		{"integer", float64(42), "42"},
+		{"negative", float64(-7), "-7"},
+		{"fraction", float64(1.5), "1.5"},
+		{"large integer", float64(12345678901), "12345678901"},
+		{"json number", json.Number("3.14159"), "3.14159"},
+		{"true", true, "true"},
+		{"false", false, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := scalarToString("value", test.raw)
+			if err != nil {
+				t.Fatalf("scalarToString(%v) error = %v", test.raw, err)
+			}
+			if got != test.want {
+				t.Errorf("scalarToString(%v) = %q, want %q", test.raw, got, test.want)
+			}
+		})
+	}
+}
+
+func TestScalarToStringWrongType(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  interface{}
+		want string
+	}{
+		{"object", map[string]interface{}{"a": "b"},
+			"key value is an object, expected a string: JSON Error: wrong type"},
+		{"array", []interface{}{"a"},
+			"key value is an array, expected a string: JSON Error: wrong type"},
+		{"other", 42,
+			"key value has type int, expected a string: JSON Error: wrong type"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := scalarToString("value", test.raw)
+			if !errors.Is(err, ErrWrongType) {
+				t.Fatalf("scalarToString(%v) error = %v, want %v", test.raw, err, ErrWrongType)
+			}
+			if err.Error() != test.want {
+				t.Errorf("scalarToString(%v) error = %q, want %q", test.raw, err, test.want)
+			}
+		})
+	}
+}
+
+func TestGetCollectionValueCoercesScalars(t *testing.T) {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"collection": 2024, "data_object": true}`), &object); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := GetCollectionValue(zerolog.Nop(), object)
+	if err != nil || coll != "2024" {
+		t.Errorf("GetCollectionValue() = %q, %v, want \"2024\"", coll, err)
+	}
+	obj, err := GetDataObjectValue(zerolog.Nop(), object)
+	if err != nil || obj != "true" {
+		t.Errorf("GetDataObjectValue() = %q, %v, want \"true\"", obj, err)
+	}
+}
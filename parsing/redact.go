@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package parsing
+
+import "regexp"
+
+// RedactedValue replaces the value of a sensitive key in redacted input.
+const RedactedValue = "<redacted>"
+
+// sensitiveKey matches the keys of input values that may hold credentials.
+var sensitiveKey = regexp.MustCompile(`(?i)passw(or)?d|secret|token|credential|api[_-]?key|private[_-]?key|ticket`)
+
+// Redact returns a copy of a JSON object, suitable for logging, in which the
+// value of each key matching sensitiveKey is replaced with RedactedValue,
+// however deeply nested within objects and arrays it is. The original is not
+// modified.
+func Redact(object map[string]interface{}) map[string]interface{} {
+	if object == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		if value != nil && sensitiveKey.MatchString(key) {
+			redacted[key] = RedactedValue
+		} else {
+			redacted[key] = redactValue(value)
+		}
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Redact(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, elt := range v {
+			redacted[i] = redactValue(elt)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parsing
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// envelopeSchema is the name of the schema for a baton-do style envelope. The
+// other schemas are named for the operation whose target they describe.
+const envelopeSchema = "envelope"
+
+// definitionsSchema is the name of the schema holding the definitions shared by
+// the others, such as those of AVUs and ACLs. It describes no input itself.
+const definitionsSchema = "definitions"
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schema is the subset of JSON Schema used to describe operation inputs: the
+// type, enum, required, properties, items, minItems, allOf, anyOf and $ref
+// keywords, where $ref may only refer to the definitions of the same schema, as
+// "#/definitions/name", or to the shared definitions, as
+// "definitions.json#/definitions/name".
+// Unlike JSON Schema, a property whose value is null is treated as absent, as
+// it is by the rest of the parsing package.
+type schema struct {
+	Type        interface{}        `json:"type"`
+	Enum        []interface{}      `json:"enum"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*schema `json:"properties"`
+	Items       *schema            `json:"items"`
+	MinItems    *int               `json:"minItems"`
+	AllOf       []*schema          `json:"allOf"`
+	AnyOf       []*schema          `json:"anyOf"`
+	Ref         string             `json:"$ref"`
+	Definitions map[string]*schema `json:"definitions"`
+}
+
+// schemas holds the embedded schemas, keyed by name.
+var schemas = loadSchemas()
+
+func loadSchemas() map[string]*schema {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*schema, len(entries))
+	for _, entry := range entries {
+		contents, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var s schema
+		if err = json.Unmarshal(contents, &s); err != nil {
+			panic(fmt.Sprintf("invalid schema %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = &s
+	}
+	return loaded
+}
+
+// validateSchema checks a value against a schema, returning an error naming the
+// path to the first part of the value that does not conform, e.g.
+// "avus[1].attribute is required". Missing values are reported with
+// ErrMissingKey and values of the wrong type with ErrWrongType.
+func validateSchema(root *schema, s *schema, value interface{}, at string) error {
+	if s.Ref != "" {
+		refRoot, def, err := resolveRef(root, s.Ref)
+		if err != nil {
+			return err
+		}
+		return validateSchema(refRoot, def, value, at)
+	}
+
+	if s.Type != nil {
+		if err := checkType(s.Type, value, at); err != nil {
+			return err
+		}
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		return fmt.Errorf("%s must be one of %v: %w", describe(at), s.Enum, ErrWrongType)
+	}
+
+	for _, sub := range s.AllOf {
+		if err := validateSchema(root, sub, value, at); err != nil {
+			return err
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		var first error
+		for _, sub := range s.AnyOf {
+			err := validateSchema(root, sub, value, at)
+			if err == nil {
+				first = nil
+				break
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return first
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// A required key given as null is missing, unless its property allows
+		// null, as the ACL level does
+		for _, key := range s.Required {
+			val, ok := v[key]
+			if !ok || (val == nil && !allowsNull(root, s.Properties[key])) {
+				return fmt.Errorf("%s is required: %w", join(at, key), ErrMissingKey)
+			}
+		}
+		// Check properties in a fixed order so that the error reported for
+		// an input with several faults does not vary
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if v[key] == nil && !slices.Contains(s.Required, key) {
+				continue
+			}
+			if err := validateSchema(root, s.Properties[key], v[key], join(at, key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s must have at least %d element(s): %w",
+				describe(at), *s.MinItems, ErrMissingKey)
+		}
+		if s.Items != nil {
+			for i, elt := range v {
+				if err := validateSchema(root, s.Items, elt, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveRef returns the definition to which ref refers, and the root schema
+// holding it, against which any references within the definition resolve.
+func resolveRef(root *schema, ref string) (refRoot *schema, def *schema, err error) {
+	file, fragment, _ := strings.Cut(ref, "#")
+	switch file {
+	case "":
+		refRoot = root
+	case definitionsSchema + ".json":
+		refRoot = schemas[definitionsSchema]
+	}
+	name, ok := strings.CutPrefix(fragment, "/definitions/")
+	if !ok || refRoot == nil || refRoot.Definitions[name] == nil {
+		return nil, nil, fmt.Errorf("unresolvable schema reference %s", ref)
+	}
+	return refRoot, refRoot.Definitions[name], nil
+}
+
+// allowsNull returns true if a property schema, which may be nil, has a type
+// that includes null.
+func allowsNull(root *schema, s *schema) bool {
+	if s == nil {
+		return false
+	}
+	if s.Ref != "" {
+		refRoot, def, err := resolveRef(root, s.Ref)
+		if err != nil {
+			return false
+		}
+		return allowsNull(refRoot, def)
+	}
+	return s.Type != nil && checkType(s.Type, nil, "") == nil
+}
+
+// checkType checks that a value has the JSON type, or one of the JSON types,
+// named by a schema's type keyword.
+func checkType(schemaType interface{}, value interface{}, at string) error {
+	var allowed []string
+	switch t := schemaType.(type) {
+	case string:
+		allowed = []string{t}
+	case []interface{}:
+		for _, elt := range t {
+			if name, ok := elt.(string); ok {
+				allowed = append(allowed, name)
+			}
+		}
+	}
+
+	actual := jsonType(value)
+	if slices.Contains(allowed, actual) {
+		return nil
+	}
+	return fmt.Errorf("%s must be of type %s, not %s: %w", describe(at),
+		strings.Join(allowed, " or "), actual, ErrWrongType)
+}
+
+// jsonType returns the JSON type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func join(at string, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+func describe(at string) string {
+	if at == "" {
+		return "input"
+	}
+	return at
+}
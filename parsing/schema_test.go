@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parsing
+
+import (
+	"errors"
+	"testing"
+)
+
+// refs returns the references made by a schema and its subschemas.
+func refs(s *schema) (found []string) {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		found = append(found, s.Ref)
+	}
+	subs := append(append([]*schema{s.Items}, s.AllOf...), s.AnyOf...)
+	for _, sub := range s.Properties {
+		subs = append(subs, sub)
+	}
+	for _, sub := range s.Definitions {
+		subs = append(subs, sub)
+	}
+	for _, sub := range subs {
+		found = append(found, refs(sub)...)
+	}
+	return found
+}
+
+func TestSchemaReferences(t *testing.T) {
+	for name, s := range schemas {
+		used := make(map[string]bool)
+		for _, ref := range refs(s) {
+			if _, _, err := resolveRef(s, ref); err != nil {
+				t.Errorf("schema %s: %v", name, err)
+			}
+			used[ref] = true
+		}
+		if name == definitionsSchema {
+			continue
+		}
+		for def := range s.Definitions {
+			if !used["#/definitions/"+def] {
+				t.Errorf("schema %s: definition %s is unused", name, def)
+			}
+		}
+	}
+}
+
+func TestValidateSharedDefinitions(t *testing.T) {
+	avu := map[string]interface{}{"attribute": "a", "value": float64(1)}
+	acl := map[string]interface{}{"owner": "user", "level": "read"}
+	coll := "/zone/coll"
+
+	tests := []struct {
+		name      string
+		operation string
+		input     map[string]interface{}
+		want      error
+	}{
+		{"put AVUs and ACLs", JSON_PUT_OP, map[string]interface{}{
+			"collection": coll, "directory": "/tmp",
+			"avus": []interface{}{avu}, "access": []interface{}{acl}}, nil},
+		{"find AVU", JSON_FIND_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{avu}}, nil},
+		{"find AVU without attribute", JSON_FIND_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{map[string]interface{}{"value": "v"}}},
+			ErrMissingKey},
+		{"metaquery AVU of wrong type", JSON_METAQUERY_OP, map[string]interface{}{
+			"avus": []interface{}{map[string]interface{}{"attribute": []interface{}{}}}},
+			ErrWrongType},
+		{"chmod ACL", JSON_CHMOD_OP, map[string]interface{}{
+			"collection": coll, "access": []interface{}{acl}}, nil},
+		{"chmod ACL without level", JSON_CHMOD_OP, map[string]interface{}{
+			"collection": coll, "access": []interface{}{map[string]interface{}{"owner": "user"}}},
+			ErrMissingKey},
+		{"chmod ACL with null level", JSON_CHMOD_OP, map[string]interface{}{
+			"collection": coll, "access": []interface{}{map[string]interface{}{
+				"owner": "user", "level": nil}}}, nil},
+		{"find AVU with null attribute", JSON_FIND_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{map[string]interface{}{
+				"attribute": nil, "value": "v"}}}, ErrMissingKey},
+		{"chmod ACL of unknown type", JSON_CHMOD_OP, map[string]interface{}{
+			"collection": coll, "access": []interface{}{map[string]interface{}{
+				"owner": "user", "level": "read", "type": "robot"}}},
+			ErrWrongType},
+		{"metamod operator", JSON_METAMOD_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{map[string]interface{}{
+				"attribute": "a", "value": "v", "operator": "add"}}}, nil},
+		{"metamod unknown operator", JSON_METAMOD_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{map[string]interface{}{
+				"attribute": "a", "value": "v", "o": "replace"}}}, ErrWrongType},
+		{"metamod AVU without attribute", JSON_METAMOD_OP, map[string]interface{}{
+			"collection": coll, "avus": []interface{}{map[string]interface{}{
+				"value": "v", "operator": "add"}}}, ErrMissingKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.operation, test.input)
+			if test.want == nil && err != nil {
+				t.Errorf("Validate() error = %v, want none", err)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("Validate() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package parsing
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// ParseMetadataTable reads a table of metadata, such as a spreadsheet exported
+// as CSV or TSV, and returns a metamod input for each row. The fields of each
+// row are separated by comma.
+//
+// The first row is a header naming the columns. It must have a collection
+// column and may have a data_object column, which together give the target of
+// each row; a row with no data object targets the collection. Every other
+// column is an attribute, and each non-empty value in it becomes an AVU of that
+// attribute. An attribute may head more than one column, to give it several
+// values.
+//
+// The whole table is checked before any input is returned, so that a malformed
+// table is rejected before any metadata is changed.
+func ParseMetadataTable(logger zerolog.Logger, r io.Reader, comma rune) (
+	inputContents []map[string]interface{}, err error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("metadata table is empty: %w", ErrMissingKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	collColumn, objColumn := -1, -1
+	var attrColumns []int
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case JSON_COLLECTION_KEY:
+			collColumn = i
+		case JSON_DATA_OBJECT_KEY:
+			objColumn = i
+		case "":
+			return nil, fmt.Errorf("column %d of the metadata table header has no name: %w",
+				i+1, ErrBadValue)
+		default:
+			attrColumns = append(attrColumns, i)
+		}
+	}
+	if collColumn < 0 {
+		return nil, fmt.Errorf("metadata table header has no %s column: %w",
+			JSON_COLLECTION_KEY, ErrMissingKey)
+	}
+	if len(attrColumns) == 0 {
+		return nil, fmt.Errorf("metadata table header has no attribute columns: %w",
+			ErrMissingKey)
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d of the metadata table: %w", row, err)
+		}
+
+		target := map[string]interface{}{}
+		if record[collColumn] == "" {
+			return nil, fmt.Errorf("row %d of the metadata table has no %s: %w",
+				row, JSON_COLLECTION_KEY, ErrMissingKey)
+		}
+		target[JSON_COLLECTION_KEY] = record[collColumn]
+		if objColumn >= 0 && record[objColumn] != "" {
+			target[JSON_DATA_OBJECT_KEY] = record[objColumn]
+		}
+
+		var avus []interface{}
+		for _, i := range attrColumns {
+			if record[i] == "" {
+				continue
+			}
+			avus = append(avus, map[string]interface{}{
+				JSON_ATTRIBUTE_KEY: strings.TrimSpace(header[i]),
+				JSON_VALUE_KEY:     record[i],
+			})
+		}
+		if len(avus) == 0 {
+			return nil, fmt.Errorf("row %d of the metadata table has no values: %w",
+				row, ErrMissingKey)
+		}
+		target[JSON_AVUS_KEY] = avus
+
+		if err = Validate(JSON_METAMOD_OP, target); err != nil {
+			return nil, fmt.Errorf("row %d of the metadata table: %w", row, err)
+		}
+		inputContents = append(inputContents, target)
+	}
+	logger.Debug().Msgf("Read %d rows of metadata", len(inputContents))
+
+	return inputContents, nil
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2024. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parsing
+
+import (
+	"fmt"
+)
+
+// Validate checks the input for an operation against the operation's embedded
+// JSON schema, which describes the keys it requires and the types of their
+// values. It does no network I/O, so operations should call it before connecting
+// to iRODS in order to fail fast on bad input.
+func Validate(operation string, object map[string]interface{}) error {
+	if object == nil {
+		return fmt.Errorf("no input for %s operation: %w", operation, ErrMissingKey)
+	}
+
+	if s, ok := schemas[operation]; ok {
+		if err := validateSchema(s, s, object, ""); err != nil {
+			return fmt.Errorf("invalid input for %s operation: %w", operation, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateEnvelope checks a baton-do style envelope and, if its operation is
+// known, its target, reporting the path to any fault within the envelope.
+func ValidateEnvelope(envelope map[string]interface{}) error {
+	s := schemas[envelopeSchema]
+	if err := validateSchema(s, s, envelope, ""); err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+
+	operation, _ := envelope[JSON_OP_KEY].(string)
+	if operation == "" {
+		operation, _ = envelope[JSON_OP_SHORT_KEY].(string)
+	}
+	if ts, ok := schemas[operation]; ok {
+		if err := validateSchema(ts, ts, envelope[JSON_TARGET_KEY], JSON_TARGET_KEY); err != nil {
+			return fmt.Errorf("invalid input for %s operation: %w", operation, err)
+		}
+	}
+
+	return nil
+}